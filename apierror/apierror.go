@@ -0,0 +1,213 @@
+// Package apierror classifies the failures of the backends into a stable
+// set of categories, so callers get the same kind of error from every client
+// whatever the backend returned.
+package apierror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mcp-server/ratelimit"
+	"mcp-server/resilience"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Category is the machine-readable code of a failure
+type Category string
+
+const (
+	NotFound            Category = "not_found"
+	Unauthorized        Category = "unauthorized"
+	Forbidden           Category = "forbidden"
+	RateLimited         Category = "rate_limited"
+	Validation          Category = "validation"
+	Conflict            Category = "conflict"
+	UpstreamUnavailable Category = "upstream_unavailable"
+)
+
+// Error is a classified backend failure
+type Error struct {
+	Category Category
+	// Service is the backend that failed: github, jira or notion
+	Service string
+	// Status is the HTTP status the backend returned, 0 without a response
+	Status int
+	// Message is a short human readable description of the failure
+	Message string
+	// RetryAfter is how long to wait before retrying, 0 when unknown or
+	// when retrying the same call cannot help
+	RetryAfter time.Duration
+	// Remediation suggests how to fix the failure
+	Remediation string
+	// Err is the underlying error, if any
+	Err error
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New creates an error of a category with the default remediation of the
+// service for it
+func New(service string, category Category, message string) *Error {
+	return &Error{
+		Category:    category,
+		Service:     service,
+		Message:     message,
+		Remediation: remediation(service, category),
+	}
+}
+
+// Invalid creates a validation error for bad arguments of a call
+func Invalid(service string, format string, args ...interface{}) *Error {
+	return New(service, Validation, fmt.Sprintf(format, args...))
+}
+
+// FromResponse creates the error of a failed response, classified by its
+// status code and carrying the delay of its Retry-After header
+func FromResponse(service string, resp *http.Response, message string) *Error {
+	e := New(service, CategoryOf(resp.StatusCode), message)
+	e.Status = resp.StatusCode
+	e.RetryAfter = retryAfter(resp.Header)
+	return e
+}
+
+// CategoryOf classifies an HTTP status code
+func CategoryOf(status int) Category {
+	switch {
+	case status == http.StatusUnauthorized:
+		return Unauthorized
+	case status == http.StatusForbidden:
+		return Forbidden
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return NotFound
+	case status == http.StatusConflict || status == http.StatusPreconditionFailed:
+		return Conflict
+	case status == http.StatusTooManyRequests:
+		return RateLimited
+	case status >= 500:
+		return UpstreamUnavailable
+	}
+	return Validation
+}
+
+// Wrap classifies the failures common to every backend: the local rate
+// limit, an open circuit, timeouts and requests that got no response. An error wrapping
+// one already classified returns it, errors of other kinds are returned
+// unchanged.
+func Wrap(service string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		// Classified by a transport, e.g. when minting an app token
+		return apiErr
+	}
+
+	var limitErr *ratelimit.LimitError
+	var openErr *resilience.OpenError
+	var netErr interface{ Timeout() bool }
+	switch {
+	case errors.As(err, &limitErr):
+		e := New(service, RateLimited, fmt.Sprintf("%s rate limit exceeded", displayName(service)))
+		e.RetryAfter = time.Until(limitErr.Until).Round(time.Second)
+		e.Err = err
+		return e
+	case errors.As(err, &openErr):
+		e := New(service, UpstreamUnavailable, fmt.Sprintf("%s is currently unavailable", displayName(service)))
+		e.RetryAfter = time.Until(openErr.Until).Round(time.Second)
+		e.Remediation = fmt.Sprintf("%s keeps failing, calls fail fast until it recovers: retry later", displayName(service))
+		e.Err = err
+		return e
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+		e := New(service, UpstreamUnavailable, fmt.Sprintf("%s did not respond in time", displayName(service)))
+		e.Remediation = fmt.Sprintf("%s is slow to answer: retry later, or raise the timeout of the backend or tool", displayName(service))
+		e.Err = err
+		return e
+	}
+	if netErr != nil {
+		e := New(service, UpstreamUnavailable, fmt.Sprintf("%s is unreachable: %v", displayName(service), err))
+		e.Err = err
+		return e
+	}
+	return err
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date).Round(time.Second); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// displayName returns the product name of a service
+func displayName(service string) string {
+	switch service {
+	case "github":
+		return "GitHub"
+	case "jira":
+		return "Jira"
+	case "notion":
+		return "Notion"
+	}
+	return service
+}
+
+// remediation returns the default remediation of a category for a service
+func remediation(service string, category Category) string {
+	name := displayName(service)
+	switch category {
+	case NotFound:
+		switch service {
+		case "github":
+			return "Check the owner, repository and number; private repositories also answer 404 when the token cannot see them"
+		case "jira":
+			return "Check the issue or project key, and that the account can browse the project"
+		case "notion":
+			return "Check the ID, and share the page or database with the integration"
+		}
+		return "Check the identifiers of the call"
+	case Unauthorized:
+		return fmt.Sprintf("Check that the %s credentials are valid and not expired", name)
+	case Forbidden:
+		switch service {
+		case "github":
+			return "Grant the token access to the repository and the permissions the call needs"
+		case "jira":
+			return "Ask a Jira administrator for the project permissions the call needs"
+		case "notion":
+			return "Share the page or database with the integration and enable the capabilities the call needs"
+		}
+		return "Check the permissions of the credentials"
+	case RateLimited:
+		return "Wait before retrying, and reduce the request rate"
+	case Validation:
+		return "Fix the arguments of the call and retry"
+	case Conflict:
+		return "The entity already exists or changed meanwhile: fetch its current state before retrying"
+	case UpstreamUnavailable:
+		return fmt.Sprintf("%s is having problems, retry later", name)
+	}
+	return ""
+}
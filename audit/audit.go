@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of an audited call
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	// OutcomeDryRun is a call that validated its targets but sent no write
+	OutcomeDryRun = "dry_run"
+	// OutcomeDenied is a call the scopes of the caller or the policy denied
+	OutcomeDenied = "denied"
+	// OutcomeReplayed is a create call answered with the entity of an
+	// earlier call instead of creating another
+	OutcomeReplayed = "replayed"
+)
+
+// Entry is one audit record, written as a line of JSON
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Transport is "stdio" or "http"
+	Transport string `json:"transport"`
+	Session   string `json:"session,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	// Client is the MCP client name and version sent on initialize
+	Client  string                 `json:"client,omitempty"`
+	Tool    string                 `json:"tool"`
+	Account string                 `json:"account,omitempty"`
+	Args    map[string]interface{} `json:"args"`
+	// Target identifies the entity acted on, e.g. owner/repo#12, PROJ-34 or a Notion ID
+	Target   string   `json:"target,omitempty"`
+	Outcome  string   `json:"outcome"`
+	Error    string   `json:"error,omitempty"`
+	URLs     []string `json:"urls,omitempty"`
+	Duration float64  `json:"duration_ms"`
+}
+
+// Filter selects entries returned by Recent. Empty fields match everything.
+type Filter struct {
+	Tool    string
+	Target  string
+	Outcome string
+	Subject string
+	Since   time.Time
+	Limit   int
+}
+
+// matches reports whether entry passes the filter
+func (f Filter) matches(entry Entry) bool {
+	if f.Tool != "" && entry.Tool != f.Tool {
+		return false
+	}
+	if f.Target != "" && !strings.Contains(entry.Target, f.Target) {
+		return false
+	}
+	if f.Outcome != "" && entry.Outcome != f.Outcome {
+		return false
+	}
+	if f.Subject != "" && entry.Subject != f.Subject {
+		return false
+	}
+	return f.Since.IsZero() || !entry.Time.Before(f.Since)
+}
+
+// Log is an append-only JSONL audit log rotated by size. The current file
+// is rotated to path.1, path.1 to path.2 and so on, keeping MaxFiles
+// rotated files.
+type Log struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens the audit log at path for appending, creating it if needed.
+// A maxBytes of zero disables rotation.
+func Open(path string, maxBytes int64, maxFiles int) (*Log, error) {
+	l := &Log{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the current file; the caller holds the lock or owns l
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Record appends an entry to the log
+func (l *Log) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// rotate shifts the rotated files and starts a new current file; the caller holds the lock
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	if l.maxFiles > 0 {
+		os.Remove(l.rotated(l.maxFiles))
+		for i := l.maxFiles - 1; i >= 1; i-- {
+			os.Rename(l.rotated(i), l.rotated(i+1))
+		}
+		if err := os.Rename(l.path, l.rotated(1)); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return l.open()
+}
+
+// rotated returns the path of the i-th rotated file
+func (l *Log) rotated(i int) string {
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
+
+// Recent returns the newest entries matching filter, newest first.
+// The current file is read first, then the rotated files.
+func (l *Log) Recent(filter Filter) ([]Entry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 20
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []Entry
+	paths := []string{l.path}
+	for i := 1; i <= l.maxFiles; i++ {
+		paths = append(paths, l.rotated(i))
+	}
+	for _, path := range paths {
+		fileEntries, err := readEntries(path, filter)
+		if err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return nil, err
+		}
+		// Files are oldest first; walk them backwards
+		for i := len(fileEntries) - 1; i >= 0; i-- {
+			entries = append(entries, fileEntries[i])
+			if len(entries) == filter.Limit {
+				return entries, nil
+			}
+		}
+	}
+	return entries, nil
+}
+
+// readEntries reads the entries of one file matching filter, oldest first.
+// Malformed lines are skipped.
+func readEntries(path string, filter Filter) ([]Entry, error) {
+	file, err := os.Open(path) // #nosec G304 -- configured audit log path
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"fmt"
+	"mcp-server/logging"
+	"strings"
+)
+
+// maxArgLength is how many characters of a long text argument are kept
+const maxArgLength = 200
+
+// sensitiveKeys are argument name fragments whose values are never logged
+var sensitiveKeys = []string{"token", "password", "secret", "credential", "apikey", "api_key", "private_key"}
+
+// RedactArgs returns a copy of tool arguments safe to write to the audit
+// log: values of sensitive arguments are replaced, credentials in texts
+// are masked and long texts such as issue bodies are truncated.
+func RedactArgs(args map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		if isSensitive(name) {
+			redacted[name] = "[REDACTED]"
+			continue
+		}
+		if text, ok := value.(string); ok {
+			text = logging.Mask(text)
+			// Cut on a character boundary, so the log stays valid UTF-8
+			if runes := []rune(text); len(runes) > maxArgLength {
+				text = fmt.Sprintf("%s... (%d chars)", string(runes[:maxArgLength]), len(runes))
+			}
+			value = text
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
+
+// isSensitive reports whether an argument name looks like it holds a secret
+func isSensitive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, key := range sensitiveKeys {
+		if strings.Contains(lower, key) {
+			return true
+		}
+	}
+	return false
+}
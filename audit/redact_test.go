@@ -0,0 +1,35 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRedactArgs(t *testing.T) {
+	body := strings.Repeat("é", maxArgLength+50)
+	redacted := RedactArgs(map[string]interface{}{
+		"owner":   "octo",
+		"number":  float64(12),
+		"token":   "ghp-secret-value",
+		"body":    body,
+		"comment": strings.Repeat("a", maxArgLength),
+	})
+
+	if redacted["owner"] != "octo" || redacted["number"] != float64(12) {
+		t.Errorf("plain arguments changed: %v", redacted)
+	}
+	if redacted["token"] != "[REDACTED]" {
+		t.Errorf("token = %v, want it redacted", redacted["token"])
+	}
+	if redacted["comment"] != strings.Repeat("a", maxArgLength) {
+		t.Errorf("comment of %d characters was truncated", maxArgLength)
+	}
+
+	truncated, _ := redacted["body"].(string)
+	want := fmt.Sprintf("%s... (%d chars)", strings.Repeat("é", maxArgLength), maxArgLength+50)
+	if !utf8.ValidString(truncated) || truncated != want {
+		t.Errorf("body = %q, want %q", truncated, want)
+	}
+}
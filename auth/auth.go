@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrMissingToken is returned when a request carries no bearer token
+var ErrMissingToken = errors.New("missing bearer token")
+
+// ErrInvalidToken is returned when a bearer token is malformed, expired,
+// not signed by the issuer or not meant for this resource
+var ErrInvalidToken = errors.New("invalid token")
+
+// Info describes the authenticated caller of a request
+type Info struct {
+	Subject   string
+	ClientID  string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether the caller was granted scope
+func (i *Info) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Validator validates bearer tokens and returns the caller they identify
+type Validator interface {
+	Validate(ctx context.Context, token string) (*Info, error)
+}
+
+// ResourceServer implements the OAuth 2.1 resource server side of the MCP
+// authorization flow: it publishes the protected resource metadata
+// (RFC 9728) and authenticates bearer tokens.
+type ResourceServer struct {
+	// Resource is the canonical URI of the MCP endpoint, e.g. https://mcp.example.com/mcp
+	Resource string
+	// AuthorizationServers lists the issuers clients can obtain tokens from
+	AuthorizationServers []string
+	// ScopesSupported lists the scopes advertised in the metadata
+	ScopesSupported []string
+	Validator       Validator
+}
+
+// Authenticate validates the bearer token of r
+func (rs *ResourceServer) Authenticate(r *http.Request) (*Info, error) {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return nil, ErrMissingToken
+	}
+	return rs.Validator.Validate(r.Context(), strings.TrimSpace(token))
+}
+
+// MetadataPath returns the well-known path the protected resource metadata is served on
+func (rs *ResourceServer) MetadataPath() string {
+	path := "/.well-known/oauth-protected-resource"
+	if u, err := url.Parse(rs.Resource); err == nil && strings.Trim(u.Path, "/") != "" {
+		path += "/" + strings.Trim(u.Path, "/")
+	}
+	return path
+}
+
+// MetadataURL returns the absolute URL of the protected resource metadata
+func (rs *ResourceServer) MetadataURL() string {
+	u, err := url.Parse(rs.Resource)
+	if err != nil {
+		return rs.MetadataPath()
+	}
+	return u.Scheme + "://" + u.Host + rs.MetadataPath()
+}
+
+// ServeMetadata serves the protected resource metadata document
+func (rs *ResourceServer) ServeMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	metadata := map[string]interface{}{
+		"resource":                 rs.Resource,
+		"authorization_servers":    rs.AuthorizationServers,
+		"bearer_methods_supported": []string{"header"},
+	}
+	if len(rs.ScopesSupported) > 0 {
+		metadata["scopes_supported"] = rs.ScopesSupported
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metadata)
+}
+
+// Unauthorized writes a 401 response with the WWW-Authenticate challenge
+// pointing the client at the protected resource metadata
+func (rs *ResourceServer) Unauthorized(w http.ResponseWriter, err error) {
+	challenge := fmt.Sprintf(`Bearer resource_metadata=%q`, rs.MetadataURL())
+	if !errors.Is(err, ErrMissingToken) {
+		challenge += `, error="invalid_token", error_description="` + sanitizeDescription(err.Error()) + `"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// Forbidden writes a 403 response telling the client which scope is missing
+func (rs *ResourceServer) Forbidden(w http.ResponseWriter, scope string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q, resource_metadata=%q`, scope, rs.MetadataURL()))
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the caller info
+func NewContext(ctx context.Context, info *Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the caller info of ctx, if any
+func FromContext(ctx context.Context) (*Info, bool) {
+	info, ok := ctx.Value(contextKey{}).(*Info)
+	return info, ok
+}
+
+// sanitizeDescription makes an error message safe to embed in a quoted header parameter
+func sanitizeDescription(description string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r < 0x20 || r > 0x7e {
+			return ' '
+		}
+		return r
+	}, description)
+}
+
+// audienceMatches reports whether the token audience contains the expected one
+func audienceMatches(audience []string, expected string) bool {
+	if expected == "" {
+		return true
+	}
+	for _, a := range audience {
+		if a == expected || strings.TrimSuffix(a, "/") == strings.TrimSuffix(expected, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList decodes a claim that may be a single string or an array of strings
+type stringList []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = strings.Fields(single)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	jwks, _ := newJWKSServer(t)
+	rs := &ResourceServer{Resource: testResource, Validator: NewJWTValidator(jwks.URL, testIssuer, testResource)}
+
+	tests := []struct {
+		name    string
+		header  string
+		wantErr error
+	}{
+		{"valid", "Bearer " + signToken(t, "rsa", validClaims()), nil},
+		{"lowercase scheme", "bearer " + signToken(t, "rsa", validClaims()), nil},
+		{"missing", "", ErrMissingToken},
+		{"basic", "Basic YWxpY2U6c2VjcmV0", ErrMissingToken},
+		{"empty bearer", "Bearer ", ErrMissingToken},
+		{"invalid", "Bearer not-a-jwt", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			info, err := rs.Authenticate(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && info.Subject != "alice" {
+				t.Errorf("Subject = %q, want alice", info.Subject)
+			}
+		})
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	rs := &ResourceServer{Resource: testResource}
+	metadataURL := "https://mcp.example.com/.well-known/oauth-protected-resource/mcp"
+
+	w := httptest.NewRecorder()
+	rs.Unauthorized(w, ErrMissingToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+	if got, want := w.Header().Get("WWW-Authenticate"), fmt.Sprintf("Bearer resource_metadata=%q", metadataURL); got != want {
+		t.Errorf("WWW-Authenticate = %s, want %s", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	rs.Unauthorized(w, fmt.Errorf("%w: token \"audience\" does not match", ErrInvalidToken))
+	challenge := w.Header().Get("WWW-Authenticate")
+	if !strings.HasPrefix(challenge, fmt.Sprintf("Bearer resource_metadata=%q, error=\"invalid_token\"", metadataURL)) {
+		t.Errorf("WWW-Authenticate = %s, want the metadata URL and invalid_token", challenge)
+	}
+	if strings.Count(challenge, `"`) != 6 {
+		t.Errorf("WWW-Authenticate = %s, want the quotes of the description escaped", challenge)
+	}
+}
+
+func TestForbidden(t *testing.T) {
+	rs := &ResourceServer{Resource: testResource}
+	w := httptest.NewRecorder()
+	rs.Forbidden(w, "github:write")
+	want := `Bearer error="insufficient_scope", scope="github:write", resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource/mcp"`
+	if w.Code != http.StatusForbidden || w.Header().Get("WWW-Authenticate") != want {
+		t.Errorf("got %d %s, want 403 %s", w.Code, w.Header().Get("WWW-Authenticate"), want)
+	}
+}
+
+func TestServeMetadata(t *testing.T) {
+	rs := &ResourceServer{
+		Resource:             testResource,
+		AuthorizationServers: []string{testIssuer},
+		ScopesSupported:      []string{"github:read"},
+	}
+	if path := rs.MetadataPath(); path != "/.well-known/oauth-protected-resource/mcp" {
+		t.Errorf("MetadataPath() = %s", path)
+	}
+
+	w := httptest.NewRecorder()
+	rs.ServeMetadata(w, httptest.NewRequest(http.MethodGet, rs.MetadataPath(), nil))
+	var metadata struct {
+		Resource             string   `json:"resource"`
+		AuthorizationServers []string `json:"authorization_servers"`
+		ScopesSupported      []string `json:"scopes_supported"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Resource != testResource || len(metadata.AuthorizationServers) != 1 || metadata.AuthorizationServers[0] != testIssuer || len(metadata.ScopesSupported) != 1 {
+		t.Errorf("metadata = %+v", metadata)
+	}
+}
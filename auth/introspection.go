@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IntrospectionValidator validates opaque access tokens with the OAuth 2.0
+// token introspection endpoint (RFC 7662) of the authorization server.
+type IntrospectionValidator struct {
+	introspectionURL string
+	clientID         string
+	clientSecret     string
+	audience         string
+	httpClient       *http.Client
+}
+
+// NewIntrospectionValidator creates a new IntrospectionValidator
+// It takes the introspection endpoint, the client credentials of this
+// resource server and the expected audience. An empty audience is not checked.
+func NewIntrospectionValidator(introspectionURL, clientID, clientSecret, audience string) *IntrospectionValidator {
+	return &IntrospectionValidator{
+		introspectionURL: introspectionURL,
+		clientID:         clientID,
+		clientSecret:     clientSecret,
+		audience:         audience,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Validate implements Validator
+func (v *IntrospectionValidator) Validate(ctx context.Context, token string) (*Info, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.introspectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.clientID), url.QueryEscape(v.clientSecret))
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read introspection response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to introspect token (HTTP %d)", resp.StatusCode)
+	}
+
+	var introspection struct {
+		Active    bool       `json:"active"`
+		Scope     stringList `json:"scope"`
+		ClientID  string     `json:"client_id"`
+		Subject   string     `json:"sub"`
+		Audience  stringList `json:"aud"`
+		ExpiresAt int64      `json:"exp"`
+	}
+	if err := json.Unmarshal(body, &introspection); err != nil {
+		return nil, fmt.Errorf("failed to parse introspection response: %w", err)
+	}
+
+	if !introspection.Active {
+		return nil, fmt.Errorf("%w: token is not active", ErrInvalidToken)
+	}
+	if !audienceMatches(introspection.Audience, v.audience) {
+		return nil, fmt.Errorf("%w: token audience does not match this resource", ErrInvalidToken)
+	}
+
+	info := &Info{
+		Subject:  introspection.Subject,
+		ClientID: introspection.ClientID,
+		Scopes:   introspection.Scope,
+	}
+	if introspection.ExpiresAt != 0 {
+		info.ExpiresAt = time.Unix(introspection.ExpiresAt, 0)
+	}
+	return info, nil
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newIntrospectionServer is a stand-in introspection endpoint answering
+// with the response of each token
+func newIntrospectionServer(t *testing.T, responses map[string]map[string]interface{}) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "mcp-server" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.PostFormValue("token_type_hint") != "access_token" {
+			t.Errorf("unexpected introspection request %s %v", r.Method, r.PostForm)
+		}
+		response, ok := responses[r.PostFormValue("token")]
+		if !ok {
+			response = map[string]interface{}{"active": false}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIntrospectionValidator(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	server := newIntrospectionServer(t, map[string]map[string]interface{}{
+		"valid":        {"active": true, "sub": "alice", "client_id": "agent", "scope": "notion:read", "aud": []string{testResource}, "exp": expiresAt},
+		"other":        {"active": true, "sub": "alice", "aud": "https://other.example.com/mcp"},
+		"no-audience":  {"active": true, "sub": "alice"},
+		"inactive-sub": {"active": false, "sub": "alice", "aud": testResource},
+	})
+	v := NewIntrospectionValidator(server.URL, "mcp-server", "secret", testResource)
+
+	info, err := v.Validate(context.Background(), "valid")
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if info.Subject != "alice" || info.ClientID != "agent" || !info.HasScope("notion:read") {
+		t.Errorf("info = %+v", info)
+	}
+	if info.ExpiresAt.Unix() != expiresAt {
+		t.Errorf("ExpiresAt = %s, want the exp of the introspection", info.ExpiresAt)
+	}
+
+	for _, token := range []string{"other", "no-audience", "inactive-sub", "unknown"} {
+		t.Run(token, func(t *testing.T) {
+			if _, err := v.Validate(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Validate() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestIntrospectionValidatorCredentials(t *testing.T) {
+	server := newIntrospectionServer(t, map[string]map[string]interface{}{
+		"valid": {"active": true, "sub": "alice", "aud": testResource},
+	})
+	v := NewIntrospectionValidator(server.URL, "mcp-server", "wrong", testResource)
+
+	_, err := v.Validate(context.Background(), "valid")
+	if err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Validate() error = %v, want a failed introspection rather than an invalid token", err)
+	}
+}
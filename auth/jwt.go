@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksRefreshInterval is how long fetched signing keys are trusted before refetching
+	jwksRefreshInterval = 10 * time.Minute
+	// jwksMinRefetchInterval rate limits refetches triggered by unknown key IDs
+	jwksMinRefetchInterval = 30 * time.Second
+	// clockLeeway tolerates clock drift when checking exp and nbf
+	clockLeeway = 60 * time.Second
+)
+
+// JWTValidator validates JWT access tokens signed with a key published at a JWKS URL.
+// RS256 and ES256 signatures are supported.
+type JWTValidator struct {
+	jwksURL    string
+	issuer     string
+	audience   string
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// attemptedAt and fetchErr are the time and error of the last fetch
+	attemptedAt time.Time
+	fetchErr    error
+	// refreshing is closed when the fetch in progress ends, nil when there
+	// is none
+	refreshing chan struct{}
+}
+
+// NewJWTValidator creates a new JWTValidator
+// It takes the JWKS URL of the authorization server, the expected issuer
+// and the expected audience. Empty issuer or audience are not checked.
+func NewJWTValidator(jwksURL, issuer, audience string) *JWTValidator {
+	return &JWTValidator{
+		jwksURL:  jwksURL,
+		issuer:   issuer,
+		audience: audience,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// jwtClaims holds the registered and OAuth claims read from an access token
+type jwtClaims struct {
+	Issuer    string     `json:"iss"`
+	Subject   string     `json:"sub"`
+	Audience  stringList `json:"aud"`
+	ExpiresAt int64      `json:"exp"`
+	NotBefore int64      `json:"nbf"`
+	ClientID  string     `json:"client_id"`
+	AZP       string     `json:"azp"`
+	Scope     stringList `json:"scope"`
+	SCP       stringList `json:"scp"`
+}
+
+// Validate implements Validator
+func (v *JWTValidator) Validate(ctx context.Context, token string) (*Info, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed JWT", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT signature", ErrInvalidToken)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT claims", ErrInvalidToken)
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(clockLeeway)) {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Add(clockLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+	if v.issuer != "" && strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(v.issuer, "/") {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if !audienceMatches(claims.Audience, v.audience) {
+		return nil, fmt.Errorf("%w: token audience does not match this resource", ErrInvalidToken)
+	}
+
+	clientID := claims.ClientID
+	if clientID == "" {
+		clientID = claims.AZP
+	}
+	scopes := claims.Scope
+	if len(scopes) == 0 {
+		scopes = claims.SCP
+	}
+	return &Info{
+		Subject:   claims.Subject,
+		ClientID:  clientID,
+		Scopes:    scopes,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+// key returns the signing key with the given ID, refetching the JWKS when
+// the cached keys are stale or the ID is unknown. The JWKS is fetched in
+// the background, without holding the lock: calls with a cached key keep
+// using it meanwhile, only calls with an unknown key ID wait for the fetch.
+func (v *JWTValidator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	for {
+		v.mu.Lock()
+		key, ok := v.lookup(kid)
+		stale := time.Since(v.fetchedAt) >= jwksRefreshInterval
+		// Fetches are at most every jwksMinRefetchInterval, so tokens with
+		// unknown key IDs cannot flood the authorization server
+		if (stale || !ok) && v.refreshing == nil && time.Since(v.attemptedAt) >= jwksMinRefetchInterval {
+			v.refresh(ctx)
+		}
+		refreshing, fetchErr := v.refreshing, v.fetchErr
+		v.mu.Unlock()
+
+		switch {
+		case ok:
+			// A stale key is used while the authorization server is unreachable
+			return key, nil
+		case refreshing != nil:
+			select {
+			case <-refreshing:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		case fetchErr != nil:
+			return nil, fetchErr
+		}
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+}
+
+// refresh starts fetching the JWKS. The caller holds v.mu.
+func (v *JWTValidator) refresh(ctx context.Context) {
+	done := make(chan struct{})
+	v.refreshing = done
+	// The fetch outlives the call starting it, as other calls wait for it
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		keys, err := v.fetchKeys(ctx)
+		v.mu.Lock()
+		v.attemptedAt, v.fetchErr = time.Now(), err
+		if err == nil {
+			v.keys, v.fetchedAt = keys, v.attemptedAt
+		}
+		v.refreshing = nil
+		v.mu.Unlock()
+		close(done)
+	}()
+}
+
+// lookup finds a cached key by ID. Tokens without a key ID match a single published key.
+func (v *JWTValidator) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// fetchKeys downloads and parses the JWKS
+func (v *JWTValidator) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS (HTTP %d)", resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := decodeBigInt(k.N)
+			e, errE := decodeBigInt(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, errX := decodeBigInt(k.X)
+			y, errY := decodeBigInt(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		}
+	}
+
+	return keys, nil
+}
+
+// verifySignature checks a JWS signature over signingInput
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: key type does not match algorithm %s", ErrInvalidToken, alg)
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return fmt.Errorf("%w: key type does not match algorithm %s", ErrInvalidToken, alg)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://auth.example.com/"
+	testResource = "https://mcp.example.com/mcp"
+)
+
+// testRSAKey and testECKey sign the tokens of the test issuer
+var (
+	testRSAKey = sync.OnceValue(func() *rsa.PrivateKey {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		return key
+	})
+	testECKey = sync.OnceValue(func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+		return key
+	})
+)
+
+// newJWKSServer serves the public keys of the test issuer and counts the fetches
+func newJWKSServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var fetches atomic.Int32
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kid": "rsa", "kty": "RSA", "use": "sig", "n": encode(testRSAKey().N), "e": encode(big.NewInt(int64(testRSAKey().E)))},
+		{"kid": "ec", "kty": "EC", "crv": "P-256", "x": encode(testECKey().X), "y": encode(testECKey().Y)},
+		{"kid": "enc", "kty": "RSA", "use": "enc", "n": encode(testRSAKey().N), "e": encode(big.NewInt(int64(testRSAKey().E)))},
+	}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+	return server, &fetches
+}
+
+// signToken returns a JWT with the given claims signed with the test key of kid
+func signToken(t *testing.T, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	if kid == "ec" {
+		return sign(t, kid, claims, testECKey())
+	}
+	return sign(t, kid, claims, testRSAKey())
+}
+
+// sign returns a JWT with the given claims signed with an RSA or a P-256 key
+func sign(t *testing.T, kid string, claims map[string]interface{}, key crypto.Signer) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// validClaims returns the claims of a token the test resource accepts
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":       testIssuer,
+		"sub":       "alice",
+		"aud":       testResource,
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"client_id": "agent",
+		"scope":     "github:read jira:write",
+	}
+}
+
+func TestJWTValidator(t *testing.T) {
+	jwks, _ := newJWKSServer(t)
+	v := NewJWTValidator(jwks.URL, testIssuer, testResource)
+
+	for _, kid := range []string{"rsa", "ec"} {
+		t.Run(kid, func(t *testing.T) {
+			info, err := v.Validate(context.Background(), signToken(t, kid, validClaims()))
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if info.Subject != "alice" || info.ClientID != "agent" {
+				t.Errorf("caller = %s/%s, want alice/agent", info.Subject, info.ClientID)
+			}
+			if !info.HasScope("github:read") || !info.HasScope("jira:write") || info.HasScope("notion:read") {
+				t.Errorf("scopes = %v", info.Scopes)
+			}
+		})
+	}
+}
+
+func TestJWTValidatorRejects(t *testing.T) {
+	jwks, _ := newJWKSServer(t)
+	v := NewJWTValidator(jwks.URL, testIssuer, testResource)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(key string, value interface{}) string {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return signToken(t, "rsa", claims)
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"audience mismatch", with("aud", "https://other.example.com/mcp")},
+		{"audience missing", with("aud", nil)},
+		{"issuer mismatch", with("iss", "https://evil.example.com/")},
+		{"expired", with("exp", time.Now().Add(-time.Hour).Unix())},
+		{"without expiry", with("exp", nil)},
+		{"not yet valid", with("nbf", time.Now().Add(time.Hour).Unix())},
+		{"signed with another key", sign(t, "rsa", validClaims(), otherKey)},
+		{"unknown key", signToken(t, "unknown", validClaims())},
+		{"encryption key", signToken(t, "enc", validClaims())},
+		{"malformed", "not.a-jwt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Validate(context.Background(), tt.token)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Validate() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestJWTValidatorAudienceList(t *testing.T) {
+	jwks, _ := newJWKSServer(t)
+	v := NewJWTValidator(jwks.URL, testIssuer, testResource)
+
+	claims := validClaims()
+	claims["aud"] = []string{"https://other.example.com", testResource + "/"}
+	if _, err := v.Validate(context.Background(), signToken(t, "rsa", claims)); err != nil {
+		t.Errorf("Validate() error = %v, want the resource found in the audience list", err)
+	}
+}
+
+func TestJWTValidatorCachesKeys(t *testing.T) {
+	jwks, fetches := newJWKSServer(t)
+	v := NewJWTValidator(jwks.URL, testIssuer, testResource)
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Validate(context.Background(), signToken(t, "rsa", validClaims())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An unknown key ID right after a fetch does not refetch
+	v.Validate(context.Background(), signToken(t, "unknown", validClaims()))
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+}
+
+func TestJWTValidatorFetchesOutsideLock(t *testing.T) {
+	jwks, _ := newJWKSServer(t)
+	var blocked atomic.Bool
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if blocked.Load() {
+			<-release
+		}
+		resp, err := http.Get(jwks.URL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+		io.Copy(w, resp.Body)
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	v := NewJWTValidator(slow.URL, testIssuer, testResource)
+	if _, err := v.Validate(context.Background(), signToken(t, "rsa", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+
+	// The keys are stale and the authorization server hangs
+	blocked.Store(true)
+	v.mu.Lock()
+	v.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	v.attemptedAt = v.fetchedAt
+	v.mu.Unlock()
+
+	// An unknown key ID waits for the fetch, until its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := v.Validate(ctx, signToken(t, "unknown", validClaims())); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Validate() error = %v, want the context error while the JWKS is fetched", err)
+	}
+
+	// Meanwhile, tokens signed with a cached key are validated right away
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.Validate(context.Background(), signToken(t, "ec", validClaims()))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Validate() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Validate() with a cached key waited for the JWKS fetch")
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want a single refetch", n)
+	}
+}
@@ -0,0 +1,65 @@
+package budget
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// CharsPerToken approximates the number of characters of a model token
+const CharsPerToken = 4
+
+// Separators are the record boundaries output is preferably cut at, most
+// significant first. A cut falls after the last newline of a separator.
+type Separators []string
+
+var (
+	// DiffSeparators cut a unified diff between files
+	DiffSeparators = Separators{"\ndiff --git "}
+	// RecordSeparators cut between blank-line separated records, then lines
+	RecordSeparators = Separators{"\n\n", "\n"}
+)
+
+// Cut splits text into a head of at most max bytes and the rest. The head
+// ends at the last record boundary that fits, falling back to less
+// significant separators and finally to a character boundary when a
+// single record is larger than max. The head holds at least one character,
+// even when it is larger than max.
+func Cut(text string, max int, separators Separators) (string, string) {
+	if max <= 0 || len(text) <= max {
+		return text, ""
+	}
+
+	for _, separator := range separators {
+		// The cut falls after the last newline of the separator, so the
+		// next chunk starts with e.g. "diff --git"
+		keep := strings.LastIndex(separator, "\n") + 1
+		if keep == 0 {
+			keep = len(separator)
+		}
+		window := max + len(separator) - keep
+		if window > len(text) {
+			window = len(text)
+		}
+		if i := strings.LastIndex(text[:window], separator); i > 0 && i+keep <= max {
+			return text[:i+keep], text[i+keep:]
+		}
+	}
+
+	cut := max
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	// A head always holds a character, so cutting the rest again makes progress
+	if cut == 0 {
+		_, cut = utf8.DecodeRuneInString(text)
+	}
+	return text[:cut], text[cut:]
+}
+
+// For returns the record boundaries of the output of a tool
+func For(tool string) Separators {
+	if strings.HasSuffix(tool, "_diff") {
+		return append(DiffSeparators, RecordSeparators...)
+	}
+	return RecordSeparators
+}
@@ -0,0 +1,60 @@
+package budget
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCut(t *testing.T) {
+	diff := "diff --git a/a.go b/a.go\n+a\ndiff --git a/b.go b/b.go\n+b\n"
+	tests := []struct {
+		name       string
+		text       string
+		max        int
+		separators Separators
+		wantHead   string
+	}{
+		{"fits", "short text", 20, RecordSeparators, "short text"},
+		{"unlimited", "short text", 0, RecordSeparators, "short text"},
+		{"record boundary", "first record\n\nsecond record", 20, RecordSeparators, "first record\n\n"},
+		{"last record boundary that fits", "one\n\ntwo\n\nthree record", 15, RecordSeparators, "one\n\ntwo\n\n"},
+		// "\n\n" would end at 13, one byte over max, so the cut falls back to the line
+		{"record separator straddling max", "first record\n\nsecond", 13, RecordSeparators, "first record\n"},
+		{"line boundary", "first line\nsecond line is long", 20, RecordSeparators, "first line\n"},
+		{"file boundary", diff, 40, For("github_get_pull_request_diff"), "diff --git a/a.go b/a.go\n+a\n"},
+		// The separator ends past max, but the cut after its newline fits
+		{"file separator straddling max", diff, 28, For("github_get_pull_request_diff"), "diff --git a/a.go b/a.go\n+a\n"},
+		{"file boundary before line boundary", diff, 50, For("github_get_pull_request_diff"), "diff --git a/a.go b/a.go\n+a\n"},
+		{"separator at the start", "\n\nrecord", 5, RecordSeparators, "\n\n"},
+		{"character boundary", "averyveryverylongword", 10, RecordSeparators, "averyveryv"},
+		{"multi-byte character", "ééééé", 5, RecordSeparators, "éé"},
+		{"character larger than max", "éa", 1, RecordSeparators, "é"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head, rest := Cut(tt.text, tt.max, tt.separators)
+			if head != tt.wantHead {
+				t.Errorf("Cut() head = %q, want %q", head, tt.wantHead)
+			}
+			if head+rest != tt.text {
+				t.Errorf("Cut() = %q + %q, want the parts of %q", head, rest, tt.text)
+			}
+		})
+	}
+}
+
+func TestCutPagesThroughText(t *testing.T) {
+	text := strings.Repeat("日本語のテキスト\n", 40)
+	var parts []string
+	for rest := text; rest != ""; {
+		var head string
+		head, rest = Cut(rest, 7, RecordSeparators)
+		if head == "" {
+			t.Fatal("Cut() returned an empty head")
+		}
+		parts = append(parts, head)
+	}
+	if strings.Join(parts, "") != text {
+		t.Error("parts do not add up to the text")
+	}
+}
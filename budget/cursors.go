@@ -0,0 +1,176 @@
+package budget
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxCursors bounds the number of live cursors; the oldest are dropped first
+const maxCursors = 1000
+
+// cursor is the remaining output of a truncated tool call
+type cursor struct {
+	tool      string
+	owner     string
+	rest      string
+	reopen    string
+	total     int
+	part      int
+	expiresAt time.Time
+	// previous is the cursor this one was returned for, dropped once this
+	// one is used
+	previous string
+	// served is the page returned for this cursor and the max it was cut
+	// at, returned again when the cursor is retried
+	served    *Page
+	servedMax int
+}
+
+// Cursors keeps the remaining output of truncated tool calls server-side,
+// so callers can fetch it chunk by chunk with an opaque cursor
+type Cursors struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	cursors map[string]*cursor
+	order   []string
+}
+
+// NewCursors creates a cursor store whose cursors expire after ttl
+func NewCursors(ttl time.Duration) *Cursors {
+	return &Cursors{ttl: ttl, cursors: make(map[string]*cursor)}
+}
+
+// Seal closes what a chunk leaves open, e.g. the fence around untrusted
+// content, and returns the text reopening it at the start of the next chunk
+type Seal func(chunk string) (sealed string, reopen string)
+
+// Page is a chunk of a tool output
+type Page struct {
+	Text string
+	// Cursor fetches the next chunk, empty on the last one
+	Cursor string
+	// Part counts the chunks returned so far, including this one
+	Part int
+	// Offset and End are the position of the chunk in the whole output, in
+	// bytes. Text can be longer, with what seal added.
+	Offset int
+	End    int
+	Total  int
+}
+
+// First returns the first chunk of output of at most max bytes, saving the
+// rest for owner, the caller that may continue it. seal, when set, closes
+// what the chunk leaves open.
+func (c *Cursors) First(tool string, owner string, output string, max int, separators Separators, seal Seal) (Page, error) {
+	head, rest := Cut(output, max, separators)
+	page := Page{Text: head, Part: 1, End: len(head), Total: len(output)}
+	if rest == "" {
+		return page, nil
+	}
+	var reopen string
+	if seal != nil {
+		page.Text, reopen = seal(head)
+	}
+	id, err := c.save(&cursor{tool: tool, owner: owner, rest: rest, reopen: reopen, total: len(output), part: 1})
+	if err != nil {
+		return Page{}, err
+	}
+	page.Cursor = id
+	return page, nil
+}
+
+// Next returns the chunk following cursor id, of at most max bytes; the
+// page carries the cursor of the chunk after. A cursor stays valid until it
+// expires or the cursor after it is used, so a call whose response was lost
+// can be retried with the same cursor and gets the same page.
+func (c *Cursors) Next(id string, tool string, owner string, max int, separators Separators, seal Seal) (Page, error) {
+	c.mu.Lock()
+	cur, ok := c.cursors[id]
+	if ok && cur.tool == tool && cur.owner == owner {
+		// The previous chunk was delivered, as the caller got this cursor
+		delete(c.cursors, cur.previous)
+		if cur.served != nil && cur.servedMax == max {
+			page := *cur.served
+			c.mu.Unlock()
+			return page, nil
+		}
+	}
+	c.mu.Unlock()
+
+	if !ok || time.Now().After(cur.expiresAt) {
+		return Page{}, fmt.Errorf("cursor %q is unknown or expired; call %s again without a cursor", id, tool)
+	}
+	if cur.tool != tool || cur.owner != owner {
+		return Page{}, fmt.Errorf("cursor %q does not belong to %s", id, tool)
+	}
+
+	// The text reopening what the previous chunk left open counts in max
+	limit := max
+	if limit > 0 {
+		limit -= len(cur.reopen)
+		if limit < 1 {
+			limit = 1
+		}
+	}
+	head, rest := Cut(cur.rest, limit, separators)
+	offset := cur.total - len(cur.rest)
+	page := Page{
+		Text:   cur.reopen + head,
+		Part:   cur.part + 1,
+		Offset: offset,
+		End:    offset + len(head),
+		Total:  cur.total,
+	}
+	if rest != "" {
+		var reopen string
+		if seal != nil {
+			page.Text, reopen = seal(page.Text)
+		}
+		next, err := c.save(&cursor{tool: tool, owner: owner, rest: rest, reopen: reopen, total: cur.total, part: page.Part, previous: id})
+		if err != nil {
+			return Page{}, err
+		}
+		page.Cursor = next
+	}
+
+	c.mu.Lock()
+	cur.served, cur.servedMax = &page, max
+	c.mu.Unlock()
+	return page, nil
+}
+
+// save stores a cursor under a new random ID, dropping expired cursors and
+// the oldest ones beyond maxCursors
+func (c *Cursors) save(cur *cursor) (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate cursor: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	cur.expiresAt = now.Add(c.ttl)
+	c.cursors[id] = cur
+
+	live := c.order[:0]
+	for _, other := range c.order {
+		if existing, ok := c.cursors[other]; ok && now.Before(existing.expiresAt) {
+			live = append(live, other)
+		} else {
+			delete(c.cursors, other)
+		}
+	}
+	c.order = append(live, id)
+	for len(c.order) > maxCursors {
+		delete(c.cursors, c.order[0])
+		c.order = c.order[1:]
+	}
+	return id, nil
+}
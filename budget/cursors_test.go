@@ -0,0 +1,83 @@
+package budget
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// records returns n blank-line separated records of about 20 bytes
+func records(n int) string {
+	var parts []string
+	for i := 0; i < n; i++ {
+		parts = append(parts, strings.Repeat(string(rune('a'+i)), 18))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func TestCursorsRetry(t *testing.T) {
+	c := NewCursors(time.Minute)
+	output := records(5)
+	first, err := c.First("tool", "alice", output, 40, RecordSeparators, nil)
+	if err != nil || first.Cursor == "" {
+		t.Fatalf("First() = %+v, %v, want a cursor", first, err)
+	}
+
+	second, err := c.Next(first.Cursor, "tool", "alice", 40, RecordSeparators, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The response was lost: retrying the cursor returns the same page
+	retried, err := c.Next(first.Cursor, "tool", "alice", 40, RecordSeparators, nil)
+	if err != nil {
+		t.Fatalf("Next() retry error = %v", err)
+	}
+	if retried != second {
+		t.Errorf("retried page = %+v, want %+v", retried, second)
+	}
+
+	// Using the next cursor drops the one before
+	if _, err := c.Next(second.Cursor, "tool", "alice", 40, RecordSeparators, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Next(first.Cursor, "tool", "alice", 40, RecordSeparators, nil); err == nil {
+		t.Error("Next() with a cursor whose next one was used succeeded")
+	}
+}
+
+func TestCursorsPages(t *testing.T) {
+	c := NewCursors(time.Minute)
+	output := records(5)
+	page, err := c.First("tool", "alice", output, 40, RecordSeparators, nil)
+	text := page.Text
+	for page.Cursor != "" {
+		if err != nil {
+			t.Fatal(err)
+		}
+		previousEnd := page.End
+		page, err = c.Next(page.Cursor, "tool", "alice", 40, RecordSeparators, nil)
+		if page.Offset != previousEnd {
+			t.Errorf("page offset = %d, want %d", page.Offset, previousEnd)
+		}
+		text += page.Text
+	}
+	if text != output || page.End != page.Total || page.Total != len(output) {
+		t.Errorf("pages add up to %q (end %d of %d), want %q", text, page.End, page.Total, output)
+	}
+}
+
+func TestCursorsOwnerAndExpiry(t *testing.T) {
+	c := NewCursors(20 * time.Millisecond)
+	first, _ := c.First("tool", "alice", records(5), 40, RecordSeparators, nil)
+
+	if _, err := c.Next(first.Cursor, "tool", "mallory", 40, RecordSeparators, nil); err == nil {
+		t.Error("Next() by another owner succeeded")
+	}
+	if _, err := c.Next(first.Cursor, "other_tool", "alice", 40, RecordSeparators, nil); err == nil {
+		t.Error("Next() for another tool succeeded")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := c.Next(first.Cursor, "tool", "alice", 40, RecordSeparators, nil); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Next() error = %v, want the cursor expired", err)
+	}
+}
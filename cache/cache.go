@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxEntryBytes caps the size of a single cached response body
+const maxEntryBytes = 4 << 20
+
+// Mode selects how a Transport keeps cached responses fresh
+type Mode int
+
+const (
+	// Revalidate always sends a conditional request (If-None-Match /
+	// If-Modified-Since) and serves the cached body on 304 Not Modified.
+	// GitHub does not count 304s against the rate limit.
+	Revalidate Mode = iota
+	// TTL serves cached responses without a request until they expire.
+	// The TTL grows with the time since the entity was last updated.
+	TTL
+)
+
+// Options configures a Transport
+type Options struct {
+	Mode Mode
+	// MinTTL and MaxTTL bound the freshness of TTL cached entries
+	MinTTL time.Duration
+	MaxTTL time.Duration
+	// Invalidate returns the URL path prefixes whose cached entries become
+	// stale after a successful write request
+	Invalidate func(req *http.Request) []string
+}
+
+// Stats counts the cache lookups of a Transport
+type Stats struct {
+	Hits        int
+	Revalidated int
+	Misses      int
+}
+
+// Transport is an http.RoundTripper caching the responses of GET requests
+type Transport struct {
+	base    http.RoundTripper
+	store   Store
+	options Options
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewTransport creates a new Transport wrapping base and caching into store
+func NewTransport(base http.RoundTripper, store Store, options Options) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if options.MinTTL <= 0 {
+		options.MinTTL = 30 * time.Second
+	}
+	if options.MaxTTL < options.MinTTL {
+		options.MaxTTL = 10 * time.Minute
+	}
+	return &Transport{base: base, store: store, options: options}
+}
+
+// Stats returns the lookup counters of the transport
+func (t *Transport) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
+
+type bypassKey struct{}
+
+// WithBypass returns a copy of ctx whose reads skip the cache and fetch
+// fresh responses from the backend
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// bypassed reports whether the reads of ctx skip the cache
+func bypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		resp, err := t.base.RoundTrip(req)
+		if err == nil && resp.StatusCode < 400 && t.options.Invalidate != nil {
+			t.invalidate(t.options.Invalidate(req))
+		}
+		return resp, err
+	}
+	if strings.Contains(req.Header.Get("Cache-Control"), "no-cache") || bypassed(req.Context()) {
+		return t.base.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	entry, cached := t.store.Get(key)
+	now := time.Now()
+
+	if cached && t.options.Mode == TTL && now.Before(entry.ExpiresAt) {
+		t.count(func(s *Stats) { s.Hits++ })
+		return entry.response(req), nil
+	}
+
+	outgoing := req
+	if cached && t.options.Mode == Revalidate {
+		outgoing = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			outgoing.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.Header.Get("Last-Modified"); modified != "" {
+			outgoing.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		t.count(func(s *Stats) { s.Revalidated++ })
+		refreshed := *entry
+		refreshed.StoredAt = now
+		t.store.Set(key, &refreshed)
+		return refreshed.response(req), nil
+	}
+
+	t.count(func(s *Stats) { s.Misses++ })
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return resp, nil
+	}
+	if t.options.Mode == Revalidate && resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxEntryBytes+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > maxEntryBytes {
+		// Too large to cache: hand back what was read followed by the rest
+		resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	entry = &Entry{
+		Path:     req.URL.Path,
+		Status:   resp.StatusCode,
+		Header:   resp.Header.Clone(),
+		Body:     body,
+		StoredAt: now,
+	}
+	if t.options.Mode == TTL {
+		entry.ExpiresAt = now.Add(t.ttl(body, now))
+	}
+	t.store.Set(key, entry)
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// ttl returns how long a TTL cached body stays fresh: a tenth of the time
+// since the entity was last updated, bounded by MinTTL and MaxTTL
+func (t *Transport) ttl(body []byte, now time.Time) time.Duration {
+	updated, ok := updatedAt(body)
+	if !ok {
+		return t.options.MinTTL
+	}
+	ttl := now.Sub(updated) / 10
+	if ttl < t.options.MinTTL {
+		return t.options.MinTTL
+	}
+	if ttl > t.options.MaxTTL {
+		return t.options.MaxTTL
+	}
+	return ttl
+}
+
+// invalidate drops the cached entries below any of the path prefixes
+func (t *Transport) invalidate(prefixes []string) {
+	if len(prefixes) == 0 {
+		return
+	}
+	t.store.DeletePaths(func(path string) bool {
+		for _, prefix := range prefixes {
+			if hasPathPrefix(path, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// count updates the lookup counters
+func (t *Transport) count(update func(*Stats)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	update(&t.stats)
+}
+
+// response builds the response served from a cached entry
+func (e *Entry) response(req *http.Request) *http.Response {
+	header := e.Header.Clone()
+	header.Set("X-Cache", "HIT")
+	return &http.Response{
+		Status:        http.StatusText(e.Status),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// readCloser combines a reader with the closer of the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// cacheKey identifies a request by URL, representation and credentials, so
+// users with different tokens never share cached responses
+func cacheKey(req *http.Request) string {
+	credentials := sha256.Sum256([]byte(req.Header.Get("Authorization")))
+	return hex.EncodeToString(credentials[:8]) + " " + req.Header.Get("Accept") + " " + req.URL.String()
+}
+
+// updatedAt extracts the last update time of a Jira issue (fields.updated)
+// or a Notion object (last_edited_time) from a response body
+func updatedAt(body []byte) (time.Time, bool) {
+	var object struct {
+		LastEditedTime string `json:"last_edited_time"`
+		Fields         struct {
+			Updated string `json:"updated"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal(body, &object); err != nil {
+		return time.Time{}, false
+	}
+	for _, value := range []string{object.LastEditedTime, object.Fields.Updated} {
+		if value == "" {
+			continue
+		}
+		// Jira uses a numeric zone offset without a colon
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.000-0700"} {
+			if updated, err := time.Parse(layout, value); err == nil {
+				return updated, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
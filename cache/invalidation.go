@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"net/http"
+	"strings"
+)
+
+// GithubInvalidation invalidates the repository a write targets, along with
+// search results. Writes outside a repository, such as creating one,
+// invalidate the authenticated user's repositories. Installation token
+// requests of a GitHub App change nothing.
+func GithubInvalidation(req *http.Request) []string {
+	path := req.URL.Path
+	if strings.Contains(path, "/app/installations/") {
+		return nil
+	}
+	base := path[:strings.Index(path, "/")+1]
+	if i := strings.Index(path, "/repos/"); i >= 0 {
+		base = path[:i+1]
+		segments := strings.SplitN(strings.TrimPrefix(path[i:], "/"), "/", 4)
+		if len(segments) >= 3 {
+			return []string{base + strings.Join(segments[:3], "/"), base + "search"}
+		}
+	}
+	if i := strings.Index(path, "/user/"); i >= 0 {
+		base = path[:i+1]
+	} else if i := strings.Index(path, "/orgs/"); i >= 0 {
+		base = path[:i+1]
+	}
+	return []string{base + "user/repos", base + "orgs", base + "search"}
+}
+
+// JiraInvalidation invalidates the issue a write targets, along with search
+// results. Searches are sent as POST but do not change anything.
+func JiraInvalidation(req *http.Request) []string {
+	path := req.URL.Path
+	i := strings.Index(path, "/rest/api/")
+	if i < 0 || strings.HasSuffix(path, "/search") {
+		return nil
+	}
+	// api is e.g. /rest/api/3/
+	rest := path[i+len("/rest/api/"):]
+	version, rest, _ := strings.Cut(rest, "/")
+	api := path[:i] + "/rest/api/" + version + "/"
+
+	prefixes := []string{api + "search"}
+	if strings.HasPrefix(rest, "issue/") {
+		segments := strings.SplitN(rest, "/", 3)
+		prefixes = append(prefixes, api+"issue/"+segments[1])
+	}
+	return prefixes
+}
+
+// NotionInvalidation invalidates the page, database or block a write
+// targets, along with search results. Creating an object invalidates the
+// block children lists, since its parent is only known from the body.
+func NotionInvalidation(req *http.Request) []string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(segments) < 2 || segments[0] != "v1" {
+		return nil
+	}
+
+	prefixes := []string{"/v1/search"}
+	if len(segments) == 2 {
+		return append(prefixes, "/v1/blocks")
+	}
+	kind, id := segments[1], segments[2]
+	prefixes = append(prefixes, "/v1/"+kind+"/"+id)
+	if kind == "pages" || kind == "databases" {
+		prefixes = append(prefixes, "/v1/blocks/"+id)
+	}
+	if kind == "blocks" {
+		prefixes = append(prefixes, "/v1/pages/"+id)
+	}
+	return prefixes
+}
@@ -0,0 +1,322 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mcp-server/logging"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logger is the logger of the cache subsystem
+var logger = logging.For("cache")
+
+// Entry is a cached upstream response
+type Entry struct {
+	// Path is the URL path of the request, used for invalidation
+	Path     string      `json:"path"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"stored_at"`
+	// ExpiresAt is when a TTL cached entry stops being served without a request.
+	// Zero means the entry must always be revalidated.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// size approximates the memory used by the entry
+func (e *Entry) size() int {
+	size := len(e.Path) + len(e.Body)
+	for name, values := range e.Header {
+		size += len(name)
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+	return size
+}
+
+// Store keeps cached entries
+type Store interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry)
+	// DeletePaths removes the entries whose request path match returns true for
+	DeletePaths(match func(path string) bool)
+}
+
+// LRU is a size-bounded in-memory Store evicting the least recently used entries
+type LRU struct {
+	maxBytes int
+
+	mu      sync.Mutex
+	bytes   int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// lruItem is an element of the LRU order list
+type lruItem struct {
+	key   string
+	entry *Entry
+}
+
+// NewLRU creates a new LRU holding at most maxBytes of entries
+func NewLRU(maxBytes int) *LRU {
+	return &LRU{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get implements Store
+func (c *LRU) Get(key string) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruItem).entry, true
+}
+
+// Set implements Store. Entries larger than the whole cache are not stored.
+func (c *LRU) Set(key string, entry *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	if entry.size() > c.maxBytes {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruItem{key: key, entry: entry})
+	c.bytes += entry.size()
+	for c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+// DeletePaths implements Store
+func (c *LRU) DeletePaths(match func(path string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, element := range c.entries {
+		if match(element.Value.(*lruItem).entry.Path) {
+			c.remove(element)
+		}
+	}
+}
+
+// remove drops an element; the caller holds the lock
+func (c *LRU) remove(element *list.Element) {
+	item := element.Value.(*lruItem)
+	c.order.Remove(element)
+	delete(c.entries, item.key)
+	c.bytes -= item.entry.size()
+}
+
+// Tiered is a Store backed by an in-memory LRU in front of an on-disk
+// directory, so cached entries survive restarts. The directory holds at
+// most maxBytes of entries, the least recently written evicted first. An
+// index of the files by request path, loaded on creation, serves the
+// invalidations without reading them.
+type Tiered struct {
+	memory   *LRU
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	bytes int64
+	// order lists the files, most recently written first
+	order *list.List
+	files map[string]*list.Element
+}
+
+// diskFile is an element of the Tiered order list
+type diskFile struct {
+	name string
+	path string
+	size int64
+}
+
+// NewTiered creates a Tiered store persisting at most maxBytes of entries
+// in dir
+func NewTiered(memory *LRU, dir string, maxBytes int64) (*Tiered, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	t := &Tiered{memory: memory, dir: dir, maxBytes: maxBytes, order: list.New(), files: make(map[string]*list.Element)}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// load indexes the files of the directory, oldest last, dropping the
+// unreadable ones, the temporary files of interrupted writes and the oldest
+// beyond the size bound
+func (t *Tiered) load() error {
+	temporary, err := filepath.Glob(filepath.Join(t.dir, "*.json.*"))
+	if err != nil {
+		return err
+	}
+	for _, name := range temporary {
+		os.Remove(name)
+	}
+	names, err := filepath.Glob(filepath.Join(t.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	type loaded struct {
+		file     diskFile
+		storedAt time.Time
+	}
+	var files []loaded
+	for _, name := range names {
+		data, err := os.ReadFile(name) // #nosec G304 -- files of the cache directory
+		if err != nil {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			os.Remove(name)
+			continue
+		}
+		files = append(files, loaded{diskFile{name: filepath.Base(name), path: entry.Path, size: int64(len(data))}, entry.StoredAt})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].storedAt.After(files[j].storedAt) })
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, f := range files {
+		file := f.file
+		t.files[file.name] = t.order.PushBack(&file)
+		t.bytes += file.size
+	}
+	t.evict()
+	return nil
+}
+
+// Get implements Store. Entries read from disk are promoted into memory
+// under the index lock, so an invalidation cannot be undone by a read that
+// started before it.
+func (t *Tiered) Get(key string) (*Entry, bool) {
+	if entry, ok := t.memory.Get(key); ok {
+		return entry, true
+	}
+
+	name := t.file(key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.files[name]; !ok {
+		return nil, false
+	}
+	data, err := os.ReadFile(filepath.Join(t.dir, name)) // #nosec G304 -- files of the cache directory
+	if err != nil {
+		return nil, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	t.memory.Set(key, &entry)
+	return &entry, true
+}
+
+// Set implements Store. Entries larger than the whole directory bound are
+// only kept in memory.
+func (t *Tiered) Set(key string, entry *Entry) {
+	data, err := json.Marshal(entry)
+	name := t.file(key)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.memory.Set(key, entry)
+	if err != nil || int64(len(data)) > t.maxBytes {
+		return
+	}
+	if err := t.write(name, data); err != nil {
+		logger.Warn("Error writing cache entry", "error", err)
+		return
+	}
+	if element, ok := t.files[name]; ok {
+		t.forget(element)
+	}
+	t.files[name] = t.order.PushFront(&diskFile{name: name, path: entry.Path, size: int64(len(data))})
+	t.bytes += int64(len(data))
+	t.evict()
+}
+
+// DeletePaths implements Store
+func (t *Tiered) DeletePaths(match func(path string) bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.memory.DeletePaths(match)
+	for _, element := range t.files {
+		if match(element.Value.(*diskFile).path) {
+			t.remove(element)
+		}
+	}
+}
+
+// write atomically replaces the file name with data, so a crash never
+// leaves a partial entry behind; the caller holds the lock
+func (t *Tiered) write(name string, data []byte) error {
+	tmp, err := os.CreateTemp(t.dir, name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(t.dir, name))
+}
+
+// evict removes the least recently written files beyond the size bound;
+// the caller holds the lock
+func (t *Tiered) evict() {
+	for t.bytes > t.maxBytes && t.order.Len() > 0 {
+		t.remove(t.order.Back())
+	}
+}
+
+// remove deletes a file and drops it from the index; the caller holds the lock
+func (t *Tiered) remove(element *list.Element) {
+	os.Remove(filepath.Join(t.dir, element.Value.(*diskFile).name))
+	t.forget(element)
+}
+
+// forget drops a file from the index; the caller holds the lock
+func (t *Tiered) forget(element *list.Element) {
+	file := element.Value.(*diskFile)
+	t.order.Remove(element)
+	delete(t.files, file.name)
+	t.bytes -= file.size
+}
+
+// file returns the name of the file an entry is persisted in
+func (t *Tiered) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+// hasPathPrefix reports whether path is prefix or below it
+func hasPathPrefix(path string, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// entry returns an entry for path with a body of n bytes
+func entry(path string, n int) *Entry {
+	return &Entry{Path: path, Status: 200, Body: []byte(strings.Repeat("x", n)), StoredAt: time.Now()}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU(300)
+	c.Set("a", entry("/a", 90))
+	c.Set("b", entry("/b", 90))
+	c.Set("c", entry("/c", 90))
+	// Reading a makes b the least recently used
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Get(a) found no entry")
+	}
+	c.Set("d", entry("/d", 90))
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, ok := c.Get(key); ok != want {
+			t.Errorf("Get(%s) found = %v, want %v", key, ok, want)
+		}
+	}
+	if c.bytes > c.maxBytes {
+		t.Errorf("cache holds %d bytes, want at most %d", c.bytes, c.maxBytes)
+	}
+
+	c.Set("huge", entry("/huge", 400))
+	if _, ok := c.Get("huge"); ok {
+		t.Error("Get() found an entry larger than the cache")
+	}
+}
+
+func TestLRUDeletePaths(t *testing.T) {
+	c := NewLRU(1 << 20)
+	c.Set("issues", entry("/repos/octo/api/issues", 10))
+	c.Set("issue", entry("/repos/octo/api/issues/12", 10))
+	c.Set("pulls", entry("/repos/octo/api/pulls", 10))
+
+	c.DeletePaths(func(path string) bool { return hasPathPrefix(path, "/repos/octo/api/issues") })
+	for key, want := range map[string]bool{"issues": false, "issue": false, "pulls": true} {
+		if _, ok := c.Get(key); ok != want {
+			t.Errorf("Get(%s) found = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestTieredPersists(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewTiered(NewLRU(1<<20), dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("issue", entry("/repos/octo/api/issues/12", 10))
+
+	// A restarted server reads the entry from disk
+	reopened, err := NewTiered(NewLRU(1<<20), dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := reopened.Get("issue")
+	if !ok || got.Path != "/repos/octo/api/issues/12" {
+		t.Fatalf("Get() = %+v, %v, want the persisted entry", got, ok)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.json.*")); len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
+
+func TestTieredDiskBound(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewTiered(NewLRU(1<<20), dir, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		s.Set(fmt.Sprint(i), entry(fmt.Sprintf("/items/%d", i), 100))
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	var size int64
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += info.Size()
+	}
+	if size > 600 || s.bytes != size {
+		t.Errorf("directory holds %d bytes, index %d, want at most 600", size, s.bytes)
+	}
+
+	// The most recently written entries are kept
+	reopened, _ := NewTiered(NewLRU(1<<20), dir, 600)
+	if _, ok := reopened.Get("9"); !ok {
+		t.Error("Get() lost the most recent entry")
+	}
+	if _, ok := reopened.Get("0"); ok {
+		t.Error("Get() found an entry beyond the bound")
+	}
+}
+
+func TestTieredDeletePaths(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewTiered(NewLRU(1<<20), dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("issue", entry("/repos/octo/api/issues/12", 10))
+	s.Set("pulls", entry("/repos/octo/api/pulls", 10))
+
+	s.DeletePaths(func(path string) bool { return hasPathPrefix(path, "/repos/octo/api/issues") })
+	if _, ok := s.Get("issue"); ok {
+		t.Error("Get() found an invalidated entry")
+	}
+	if _, ok := s.Get("pulls"); !ok {
+		t.Error("Get() lost an entry that was not invalidated")
+	}
+
+	reopened, _ := NewTiered(NewLRU(1<<20), dir, 1<<20)
+	if _, ok := reopened.Get("issue"); ok {
+		t.Error("Get() after reopening found an invalidated entry")
+	}
+}
+
+func TestTieredInvalidationWhileReading(t *testing.T) {
+	dir := t.TempDir()
+	path := "/repos/octo/api/issues/12"
+	for i := 0; i < 50; i++ {
+		// Entries on disk only, so every Get reads the file
+		s, err := NewTiered(NewLRU(1<<20), dir, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Set("issue", entry(path, 10))
+		s.memory.DeletePaths(func(string) bool { return true })
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.Get("issue")
+		}()
+		go func() {
+			defer wg.Done()
+			s.DeletePaths(func(p string) bool { return p == path })
+		}()
+		wg.Wait()
+
+		if _, ok := s.Get("issue"); ok {
+			t.Fatal("Get() found an entry invalidated while it was read")
+		}
+	}
+}
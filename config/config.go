@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,11 +14,422 @@ import (
 // It contains the API tokens for the different services
 // that the MCP server integrates with.
 type Config struct {
-	NotionToken  string `yaml:"notion_token"`
+	NotionToken     string    `yaml:"notion_token"`
+	GithubToken     string    `yaml:"github_token"`
+	GithubBaseURL   string    `yaml:"github_base_url"`
+	GithubUploadURL string    `yaml:"github_upload_url"`
+	GithubApp       GithubApp `yaml:"github_app"`
+	JiraToken       string    `yaml:"jira_token"`
+	JiraURL         string    `yaml:"jira_url"`
+	JiraUsername    string    `yaml:"jira_username"`
+	JiraDeployment  string    `yaml:"jira_deployment"`
+
+	// Transport selects how MCP clients connect: "stdio" (default) or "http"
+	Transport string     `yaml:"transport"`
+	HTTPAddr  string     `yaml:"http_addr"`
+	Auth      AuthConfig `yaml:"auth"`
+	MultiUser MultiUser  `yaml:"multi_user"`
+
+	// RateLimits configures the pacing and retries of each service, keyed by
+	// "github", "jira" or "notion". Missing values use DefaultRateLimits.
+	RateLimits map[string]RateLimitConfig `yaml:"rate_limits"`
+	// Resilience configures the timeout, concurrency cap and circuit breaker
+	// of each service, keyed like RateLimits. Missing values use DefaultResilience.
+	Resilience map[string]Resilience `yaml:"resilience"`
+	// ToolTimeouts maps tool names to the deadline of their calls, spanning
+	// all the upstream requests of a call
+	ToolTimeouts map[string]time.Duration `yaml:"tool_timeouts"`
+	Cache        Cache                    `yaml:"cache"`
+	Audit        Audit                    `yaml:"audit"`
+	Idempotency  Idempotency              `yaml:"idempotency"`
+	Undo         Undo                     `yaml:"undo"`
+	Sanitize     Sanitize                 `yaml:"sanitize"`
+	Metrics      Metrics                  `yaml:"metrics"`
+	Tracing      Tracing                  `yaml:"tracing"`
+	Logging      Logging                  `yaml:"logging"`
+
+	OutputBudget OutputBudget `yaml:"output_budget"`
+	// OutputFormat is the default format of tool outputs: "markdown", "json"
+	// or "text". Calls can override it with their format argument.
+	OutputFormat string `yaml:"output_format"`
+	// Templates maps tool names to Go text/template files rendered over the
+	// tool results instead of the default Markdown or text output
+	Templates map[string]string `yaml:"templates"`
+
+	// ShutdownTimeout is how long in-flight requests may run after a
+	// shutdown signal or the end of stdin, 30s by default
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// Middleware lists the built-in middleware wrapping tool calls,
+	// outermost first, to reorder or leave some out. Empty uses the
+	// default order.
+	Middleware []string `yaml:"middleware"`
+
+	// Policy restricts the tools that may be called and what the write
+	// tools may touch
+	Policy Policy `yaml:"policy"`
+
+	// DryRun makes every write tool validate its arguments and targets and
+	// return the request it would send, without sending it
+	DryRun bool `yaml:"dry_run"`
+
+	// Additional named accounts. The top-level tokens above form the
+	// "default" account of each service.
+	GithubAccounts []GithubAccount `yaml:"github_accounts"`
+	JiraAccounts   []JiraAccount   `yaml:"jira_accounts"`
+	NotionAccounts []NotionAccount `yaml:"notion_accounts"`
+}
+
+// AuthConfig configures OAuth 2.1 authorization of the HTTP transport.
+// Bearer tokens are validated as JWTs against JWKSURL, or with the
+// introspection endpoint when IntrospectionURL is set.
+type AuthConfig struct {
+	// Resource is the canonical URI of the MCP endpoint, also used as the expected audience
+	Resource                  string   `yaml:"resource"`
+	AuthorizationServers      []string `yaml:"authorization_servers"`
+	Issuer                    string   `yaml:"issuer"`
+	Audience                  string   `yaml:"audience"`
+	JWKSURL                   string   `yaml:"jwks_url"`
+	IntrospectionURL          string   `yaml:"introspection_url"`
+	IntrospectionClientID     string   `yaml:"introspection_client_id"`
+	IntrospectionClientSecret string   `yaml:"introspection_client_secret"`
+}
+
+// Enabled reports whether a token validation method is configured
+func (a AuthConfig) Enabled() bool {
+	return a.JWKSURL != "" || a.IntrospectionURL != ""
+}
+
+// ExpectedAudience returns the audience tokens must be issued for
+func (a AuthConfig) ExpectedAudience() string {
+	if a.Audience != "" {
+		return a.Audience
+	}
+	return a.Resource
+}
+
+// validate checks that an enabled authorization has a resource URI: it is
+// published in the protected resource metadata and, without an explicit
+// audience, the audience tokens are checked against
+func (a AuthConfig) validate() error {
+	if a.Enabled() && a.Resource == "" {
+		return fmt.Errorf("auth.resource is required when authorization is enabled")
+	}
+	return nil
+}
+
+// MultiUser configures per-user upstream credentials on the HTTP transport.
+// Users maps authenticated subjects to the credentials they act with;
+// callers can also send their own tokens in request headers.
+type MultiUser struct {
+	Enabled                bool                       `yaml:"enabled"`
+	RequireUserCredentials bool                       `yaml:"require_user_credentials"`
+	IdleTimeout            time.Duration              `yaml:"idle_timeout"`
+	Users                  map[string]UserCredentials `yaml:"users"`
+}
+
+// UserCredentials are the upstream credentials of one user
+type UserCredentials struct {
 	GithubToken  string `yaml:"github_token"`
-	JiraToken    string `yaml:"jira_token"`
-	JiraURL      string `yaml:"jira_url"`
 	JiraUsername string `yaml:"jira_username"`
+	JiraToken    string `yaml:"jira_token"`
+	NotionToken  string `yaml:"notion_token"`
+}
+
+// RateLimit is the token bucket pacing and retries of a service
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+	MaxRetries        int
+	MaxDelay          time.Duration
+}
+
+// RateLimitConfig configures the rate limit of a service. Unset values use
+// the defaults, so a zero requests_per_second disables pacing and a zero
+// max_retries disables retries.
+type RateLimitConfig struct {
+	RequestsPerSecond *float64      `yaml:"requests_per_second"`
+	Burst             int           `yaml:"burst"`
+	MaxRetries        *int          `yaml:"max_retries"`
+	MaxDelay          time.Duration `yaml:"max_delay"`
+}
+
+// DefaultRateLimits are the rate limits used for services without configuration.
+// Notion allows an average of 3 requests per second per integration.
+var DefaultRateLimits = map[string]RateLimit{
+	"github": {RequestsPerSecond: 10, Burst: 10, MaxRetries: 3, MaxDelay: time.Minute},
+	"jira":   {RequestsPerSecond: 10, Burst: 10, MaxRetries: 3, MaxDelay: time.Minute},
+	"notion": {RequestsPerSecond: 3, Burst: 3, MaxRetries: 3, MaxDelay: time.Minute},
+}
+
+// RateLimitFor returns the rate limit of a service, filling unset values with the defaults
+func (c *Config) RateLimitFor(service string) RateLimit {
+	configured := c.RateLimits[service]
+	limit := DefaultRateLimits[service]
+	if configured.RequestsPerSecond != nil {
+		limit.RequestsPerSecond = *configured.RequestsPerSecond
+	}
+	if configured.Burst != 0 {
+		limit.Burst = configured.Burst
+	}
+	if configured.MaxRetries != nil {
+		limit.MaxRetries = *configured.MaxRetries
+	}
+	if configured.MaxDelay != 0 {
+		limit.MaxDelay = configured.MaxDelay
+	}
+	return limit
+}
+
+// Resilience configures how a service is protected when it is slow or failing
+type Resilience struct {
+	// Timeout bounds each upstream request, retries included
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxConcurrent caps the upstream requests in flight across all accounts
+	MaxConcurrent int `yaml:"max_concurrent"`
+	// FailureThreshold is the number of consecutive failures opening the
+	// circuit breaker; a negative value disables the breaker
+	FailureThreshold int `yaml:"failure_threshold"`
+	// Cooldown is how long calls fail fast before the service is probed again
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// DefaultResilience is the resilience configuration of services without one
+var DefaultResilience = Resilience{Timeout: 30 * time.Second, MaxConcurrent: 10, FailureThreshold: 5, Cooldown: 30 * time.Second}
+
+// ResilienceFor returns the resilience configuration of a service, filling
+// unset values with the defaults
+func (c *Config) ResilienceFor(service string) Resilience {
+	r := c.Resilience[service]
+	if r.Timeout == 0 {
+		r.Timeout = DefaultResilience.Timeout
+	}
+	if r.MaxConcurrent == 0 {
+		r.MaxConcurrent = DefaultResilience.MaxConcurrent
+	}
+	if r.FailureThreshold == 0 {
+		r.FailureThreshold = DefaultResilience.FailureThreshold
+	}
+	if r.Cooldown == 0 {
+		r.Cooldown = DefaultResilience.Cooldown
+	}
+	return r
+}
+
+// Cache configures the caching of upstream reads. GitHub responses are
+// revalidated with ETags; Jira and Notion responses are served for a TTL
+// growing with the time since the entity was last updated.
+type Cache struct {
+	Disabled bool `yaml:"disabled"`
+	// MaxBytes bounds the in-memory cache, 64MB by default
+	MaxBytes int `yaml:"max_bytes"`
+	// Dir additionally persists cached responses on disk when set
+	Dir string `yaml:"dir"`
+	// DirMaxBytes bounds the entries persisted in Dir, 512MB by default
+	DirMaxBytes int64         `yaml:"dir_max_bytes"`
+	MinTTL      time.Duration `yaml:"min_ttl"`
+	MaxTTL      time.Duration `yaml:"max_ttl"`
+}
+
+// DefaultCacheMaxBytes is the in-memory cache size used when unset
+const DefaultCacheMaxBytes = 64 << 20
+
+// DefaultCacheDirMaxBytes is the on-disk cache size used when unset
+const DefaultCacheDirMaxBytes = 512 << 20
+
+// Audit configures the audit log of write tool calls. It is written as
+// JSON lines to Path and rotated once it grows past MaxBytes.
+type Audit struct {
+	// Path of the audit log. Empty disables the audit log.
+	Path     string `yaml:"path"`
+	MaxBytes int64  `yaml:"max_bytes"`
+	// MaxFiles is how many rotated files are kept
+	MaxFiles int `yaml:"max_files"`
+}
+
+// Idempotency configures how create calls avoid duplicates: the entities
+// created under an idempotency key are kept for TTL, and calls without a
+// key return an entity with the same title created within DuplicateWindow
+type Idempotency struct {
+	// Path persists the keys to a JSON file when set, else they are kept
+	// in memory
+	Path string        `yaml:"path"`
+	TTL  time.Duration `yaml:"ttl"`
+	// DuplicateWindow is 5m by default; a negative value disables the
+	// detection of duplicates
+	DuplicateWindow time.Duration `yaml:"duplicate_window"`
+}
+
+// Undo configures the journal of the write calls the undo tools revert
+type Undo struct {
+	// Path persists the journal to a JSON file when set, else it is kept
+	// in memory
+	Path string `yaml:"path"`
+	// MaxActions is the number of recent actions kept, 1000 by default
+	MaxActions int `yaml:"max_actions"`
+}
+
+// Sanitize configures the hardening of the untrusted upstream text in tool
+// results: hidden text is stripped and bodies are fenced with their
+// provenance, unless disabled
+type Sanitize struct {
+	Disabled bool `yaml:"disabled"`
+	// FlagInstructions warns about text that looks like instructions to
+	// the agent
+	FlagInstructions bool `yaml:"flag_instructions"`
+	// SkipTools lists the tools whose results are left as they are
+	SkipTools []string `yaml:"skip_tools"`
+}
+
+// Metrics configures the Prometheus metrics endpoint
+type Metrics struct {
+	Enabled bool `yaml:"enabled"`
+	// Addr is a side listener serving /metrics, required on stdio. On the
+	// HTTP transport the endpoint is served on the MCP listener by default.
+	Addr string `yaml:"addr"`
+}
+
+// DefaultMetricsAddr is the metrics listener of the stdio transport
+const DefaultMetricsAddr = "localhost:9464"
+
+// Tracing configures the export of OpenTelemetry traces over OTLP/HTTP
+type Tracing struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the collector base URL, spans are posted to its /v1/traces
+	Endpoint    string            `yaml:"endpoint"`
+	Headers     map[string]string `yaml:"headers"`
+	ServiceName string            `yaml:"service_name"`
+	// SampleRatio is the share of new traces exported, 1 by default. Traces
+	// continued from a client follow its sampling decision.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Logging configures the structured logs written to stderr
+type Logging struct {
+	// Format is "logfmt" (default) or "json"
+	Format string `yaml:"format"`
+	// Level is the minimum level: debug, info (default), warn or error
+	Level string `yaml:"level"`
+	// Levels overrides the level per subsystem: server, github, jira,
+	// notion, cache, render, tracing, resilience, idempotency, undo or main
+	Levels map[string]string `yaml:"levels"`
+}
+
+// OutputBudget caps the size of a single tool output, in characters or
+// approximate tokens. Longer outputs are truncated at a file or record
+// boundary and continued with a cursor that expires after CursorTTL.
+type OutputBudget struct {
+	MaxChars  int           `yaml:"max_chars"`
+	MaxTokens int           `yaml:"max_tokens"`
+	CursorTTL time.Duration `yaml:"cursor_ttl"`
+}
+
+// DefaultOutputBudgetTokens is the output budget used when none is configured
+const DefaultOutputBudgetTokens = 25000
+
+// Chars returns the budget in characters. A negative MaxChars disables truncation.
+func (b OutputBudget) Chars() int {
+	switch {
+	case b.MaxChars != 0:
+		return b.MaxChars
+	case b.MaxTokens != 0:
+		// A token is about four characters
+		return b.MaxTokens * 4
+	default:
+		return DefaultOutputBudgetTokens * 4
+	}
+}
+
+// DefaultAccountName is the name of the account built from the top-level
+// tokens of the configuration.
+const DefaultAccountName = "default"
+
+// Policy configures the guardrails evaluated before every tool call
+type Policy struct {
+	// DenyTools are patterns of tool names that may never be called, e.g.
+	// github_create_repository or notion_*
+	DenyTools []string `yaml:"deny_tools"`
+	// DefaultDeny denies the write tools no rule applies to
+	DefaultDeny bool         `yaml:"default_deny"`
+	Rules       []PolicyRule `yaml:"rules"`
+}
+
+// IsSet reports whether a policy is configured
+func (p Policy) IsSet() bool {
+	return len(p.DenyTools) > 0 || p.DefaultDeny || len(p.Rules) > 0
+}
+
+// PolicyRule restricts the targets of the write tools matching Tools, all
+// of them when empty. A call must satisfy every rule applying to its tool;
+// constraints about another service than the tool's are ignored.
+type PolicyRule struct {
+	Name  string   `yaml:"name"`
+	Tools []string `yaml:"tools"`
+	// Repos are owner/repo patterns, e.g. acme/*
+	Repos []string `yaml:"repos"`
+	// Branches are patterns of the branches created, opened as pull
+	// requests or run workflows on, e.g. agent/*
+	Branches []string `yaml:"branches"`
+	// Projects are Jira project keys
+	Projects []string `yaml:"projects"`
+	// Pages are the IDs or URLs of the Notion pages writes must be under
+	Pages []string `yaml:"pages"`
+}
+
+// GithubAccount is a named GitHub connection profile.
+// Owners lists the repository owners (glob patterns allowed) that are
+// routed to this account when no account is given explicitly.
+type GithubAccount struct {
+	Name      string    `yaml:"name"`
+	Token     string    `yaml:"token"`
+	BaseURL   string    `yaml:"base_url"`
+	UploadURL string    `yaml:"upload_url"`
+	Owners    []string  `yaml:"owners"`
+	App       GithubApp `yaml:"app"`
+}
+
+// GithubApp holds the credentials used to authenticate as a GitHub App
+// installation instead of with a personal access token.
+// The private key can be given inline or as a path to a PEM file.
+type GithubApp struct {
+	ID             int64  `yaml:"app_id"`
+	InstallationID int64  `yaml:"installation_id"`
+	PrivateKey     string `yaml:"private_key"`
+	PrivateKeyPath string `yaml:"private_key_path"`
+}
+
+// IsSet reports whether GitHub App authentication is configured
+func (a GithubApp) IsSet() bool {
+	return a.ID != 0
+}
+
+// PrivateKeyPEM returns the PEM encoded private key of the app
+func (a GithubApp) PrivateKeyPEM() ([]byte, error) {
+	if a.PrivateKey != "" {
+		return []byte(a.PrivateKey), nil
+	}
+	if a.PrivateKeyPath == "" {
+		return nil, fmt.Errorf("private_key or private_key_path is required for GitHub App authentication")
+	}
+	return os.ReadFile(a.PrivateKeyPath)
+}
+
+// JiraAccount is a named Jira connection profile.
+// Projects lists the project keys (glob patterns allowed) that are
+// routed to this account when no account is given explicitly.
+type JiraAccount struct {
+	Name       string   `yaml:"name"`
+	URL        string   `yaml:"url"`
+	Username   string   `yaml:"username"`
+	Token      string   `yaml:"token"`
+	Deployment string   `yaml:"deployment"`
+	Projects   []string `yaml:"projects"`
+}
+
+// NotionAccount is a named Notion connection profile.
+type NotionAccount struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
 }
 
 // LoadConfig loads the configuration with the following priority:
@@ -46,6 +461,32 @@ func LoadConfig(configPath string) (*Config, error) {
 	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
 		cfg.GithubToken = token
 	}
+	if url := os.Getenv("GITHUB_BASE_URL"); url != "" {
+		cfg.GithubBaseURL = url
+	}
+	if url := os.Getenv("GITHUB_UPLOAD_URL"); url != "" {
+		cfg.GithubUploadURL = url
+	}
+	if id := os.Getenv("GITHUB_APP_ID"); id != "" {
+		appID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GITHUB_APP_ID: %w", err)
+		}
+		cfg.GithubApp.ID = appID
+	}
+	if id := os.Getenv("GITHUB_APP_INSTALLATION_ID"); id != "" {
+		installationID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GITHUB_APP_INSTALLATION_ID: %w", err)
+		}
+		cfg.GithubApp.InstallationID = installationID
+	}
+	if key := os.Getenv("GITHUB_APP_PRIVATE_KEY"); key != "" {
+		cfg.GithubApp.PrivateKey = key
+	}
+	if path := os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH"); path != "" {
+		cfg.GithubApp.PrivateKeyPath = path
+	}
 	if token := os.Getenv("JIRA_TOKEN"); token != "" {
 		cfg.JiraToken = token
 	}
@@ -55,6 +496,180 @@ func LoadConfig(configPath string) (*Config, error) {
 	if username := os.Getenv("JIRA_USERNAME"); username != "" {
 		cfg.JiraUsername = username
 	}
+	if deployment := os.Getenv("JIRA_DEPLOYMENT"); deployment != "" {
+		cfg.JiraDeployment = deployment
+	}
+
+	if transport := os.Getenv("MCP_TRANSPORT"); transport != "" {
+		cfg.Transport = transport
+	}
+	if format := os.Getenv("MCP_OUTPUT_FORMAT"); format != "" {
+		cfg.OutputFormat = format
+	}
+	if dryRun, err := strconv.ParseBool(os.Getenv("MCP_DRY_RUN")); err == nil {
+		cfg.DryRun = dryRun
+	}
+	if addr := os.Getenv("MCP_METRICS_ADDR"); addr != "" {
+		cfg.Metrics.Enabled = true
+		cfg.Metrics.Addr = addr
+	}
+	if format := os.Getenv("MCP_LOG_FORMAT"); format != "" {
+		cfg.Logging.Format = format
+	}
+	if level := os.Getenv("MCP_LOG_LEVEL"); level != "" {
+		cfg.Logging.Level = level
+	}
+	if tracing, err := strconv.ParseBool(os.Getenv("MCP_TRACING")); err == nil {
+		cfg.Tracing.Enabled = tracing
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		cfg.Tracing.Endpoint = endpoint
+	}
+	if service := os.Getenv("OTEL_SERVICE_NAME"); service != "" {
+		cfg.Tracing.ServiceName = service
+	}
+	if cfg.Tracing.Endpoint == "" {
+		cfg.Tracing.Endpoint = "http://localhost:4318"
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "mcp-server"
+	}
+	if cfg.Tracing.SampleRatio == 0 {
+		cfg.Tracing.SampleRatio = 1
+	}
+	if path := os.Getenv("MCP_AUDIT_LOG"); path != "" {
+		cfg.Audit.Path = path
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = 30 * time.Second
+	}
+	if cfg.OutputBudget.CursorTTL == 0 {
+		cfg.OutputBudget.CursorTTL = 15 * time.Minute
+	}
+	if cfg.Audit.MaxBytes == 0 {
+		cfg.Audit.MaxBytes = 10 << 20
+	}
+	if cfg.Audit.MaxFiles == 0 {
+		cfg.Audit.MaxFiles = 5
+	}
+	if cfg.Idempotency.TTL == 0 {
+		cfg.Idempotency.TTL = 24 * time.Hour
+	}
+	if cfg.Idempotency.DuplicateWindow == 0 {
+		cfg.Idempotency.DuplicateWindow = 5 * time.Minute
+	}
+	if cfg.Undo.MaxActions == 0 {
+		cfg.Undo.MaxActions = 1000
+	}
+	if addr := os.Getenv("MCP_HTTP_ADDR"); addr != "" {
+		cfg.HTTPAddr = addr
+	}
+	if cfg.HTTPAddr == "" {
+		cfg.HTTPAddr = ":8080"
+	}
+
+	if err := cfg.validateAccounts(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Auth.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Undo.MaxActions < 0 {
+		return nil, fmt.Errorf("undo.max_actions must be positive")
+	}
 
 	return &cfg, nil
 }
+
+// AllGithubAccounts returns the default GitHub account followed by the named ones
+func (c *Config) AllGithubAccounts() []GithubAccount {
+	accounts := []GithubAccount{{
+		Name:      DefaultAccountName,
+		Token:     c.GithubToken,
+		BaseURL:   c.GithubBaseURL,
+		UploadURL: c.GithubUploadURL,
+		App:       c.GithubApp,
+	}}
+	return append(accounts, c.GithubAccounts...)
+}
+
+// AllJiraAccounts returns the default Jira account followed by the named
+// ones. The default account is left out when jira_url is not set, e.g.
+// when only named accounts are configured.
+func (c *Config) AllJiraAccounts() []JiraAccount {
+	var accounts []JiraAccount
+	if c.JiraURL != "" {
+		accounts = append(accounts, JiraAccount{
+			Name:       DefaultAccountName,
+			URL:        c.JiraURL,
+			Username:   c.JiraUsername,
+			Token:      c.JiraToken,
+			Deployment: c.JiraDeployment,
+		})
+	}
+	return append(accounts, c.JiraAccounts...)
+}
+
+// AllNotionAccounts returns the default Notion account followed by the
+// named ones. The default account is left out when notion_token is not set.
+func (c *Config) AllNotionAccounts() []NotionAccount {
+	var accounts []NotionAccount
+	if c.NotionToken != "" {
+		accounts = append(accounts, NotionAccount{
+			Name:  DefaultAccountName,
+			Token: c.NotionToken,
+		})
+	}
+	return append(accounts, c.NotionAccounts...)
+}
+
+// Secrets returns the configured credentials, masked in the logs
+func (c *Config) Secrets() []string {
+	secrets := []string{c.Auth.IntrospectionClientSecret, c.GithubApp.PrivateKey}
+	for _, account := range c.AllGithubAccounts() {
+		secrets = append(secrets, account.Token, account.App.PrivateKey)
+	}
+	for _, account := range c.AllJiraAccounts() {
+		secrets = append(secrets, account.Token)
+	}
+	for _, account := range c.AllNotionAccounts() {
+		secrets = append(secrets, account.Token)
+	}
+	for _, user := range c.MultiUser.Users {
+		secrets = append(secrets, user.GithubToken, user.JiraToken, user.NotionToken)
+	}
+	for _, value := range c.Tracing.Headers {
+		secrets = append(secrets, value)
+	}
+	return secrets
+}
+
+// validateAccounts checks that every named account has a unique, non-reserved name
+func (c *Config) validateAccounts() error {
+	var names []string
+	for _, a := range c.GithubAccounts {
+		names = append(names, "github:"+a.Name)
+	}
+	for _, a := range c.JiraAccounts {
+		names = append(names, "jira:"+a.Name)
+	}
+	for _, a := range c.NotionAccounts {
+		names = append(names, "notion:"+a.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		service, account, _ := strings.Cut(name, ":")
+		if account == "" {
+			return fmt.Errorf("%s account without a name", service)
+		}
+		if account == DefaultAccountName {
+			return fmt.Errorf("%s account name %q is reserved for the top-level configuration", service, account)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate %s account %q", service, account)
+		}
+		seen[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestDefaultAccounts(t *testing.T) {
+	named := &Config{
+		JiraAccounts:   []JiraAccount{{Name: "ops", URL: "https://ops.atlassian.net/", Token: "ops-token"}},
+		NotionAccounts: []NotionAccount{{Name: "marketing", Token: "marketing-token"}},
+	}
+	if accounts := named.AllJiraAccounts(); len(accounts) != 1 || accounts[0].Name != "ops" {
+		t.Errorf("AllJiraAccounts() = %+v, want the named account only", accounts)
+	}
+	if accounts := named.AllNotionAccounts(); len(accounts) != 1 || accounts[0].Name != "marketing" {
+		t.Errorf("AllNotionAccounts() = %+v, want the named account only", accounts)
+	}
+
+	named.JiraURL = "https://acme.atlassian.net/"
+	named.NotionToken = "notion-token"
+	if accounts := named.AllJiraAccounts(); len(accounts) != 2 || accounts[0].Name != DefaultAccountName || accounts[0].URL != named.JiraURL {
+		t.Errorf("AllJiraAccounts() = %+v, want the default account first", accounts)
+	}
+	if accounts := named.AllNotionAccounts(); len(accounts) != 2 || accounts[0].Name != DefaultAccountName {
+		t.Errorf("AllNotionAccounts() = %+v, want the default account first", accounts)
+	}
+}
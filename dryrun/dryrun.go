@@ -0,0 +1,128 @@
+package dryrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type enabledKey struct{}
+type allowKey struct{}
+
+// WithDryRun returns a copy of ctx in which write requests are not sent
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, enabledKey{}, true)
+}
+
+// Enabled reports whether ctx is in dry-run mode
+func Enabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(enabledKey{}).(bool)
+	return enabled
+}
+
+// Allow returns a copy of req that is sent even in dry-run mode, for
+// requests that use a write method without changing anything, such as a
+// search sent as POST or the exchange of an installation token
+func Allow(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), allowKey{}, true))
+}
+
+// Request is a write request intercepted in dry-run mode. It is returned
+// as the error of the round trip, so the client call fails without side
+// effects and the caller can report what would have been sent.
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// Error implements error
+func (r *Request) Error() string {
+	return fmt.Sprintf("dry run: %s %s not sent", r.Method, r.URL)
+}
+
+// String describes the request: the request line, headers without
+// credentials, and the indented JSON body
+func (r *Request) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", r.Method, r.URL)
+
+	names := make([]string, 0, len(r.Header))
+	for name := range r.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(r.Header[name], ", ")
+		if name == "Authorization" {
+			value = "[REDACTED]"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", name, value)
+	}
+
+	if len(r.Body) > 0 {
+		b.WriteString("\n")
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, r.Body, "", "  "); err == nil {
+			b.Write(indented.Bytes())
+		} else {
+			b.Write(r.Body)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Transport is an http.RoundTripper intercepting write requests made with
+// a dry-run context. Reads are sent, so targets can still be resolved.
+type Transport struct {
+	base http.RoundTripper
+}
+
+// NewTransport creates a new Transport wrapping base
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !Enabled(req.Context()) || isRead(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	intercepted := &Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+	}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		intercepted.Body = body
+	}
+	return nil, intercepted
+}
+
+// isRead reports whether req can be sent in dry-run mode
+func isRead(req *http.Request) bool {
+	if allowed, _ := req.Context().Value(allowKey{}).(bool); allowed {
+		return true
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"mcp-server/apierror"
+	"mcp-server/dryrun"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// appJWTLifetime is how long a minted app JWT is valid. GitHub accepts at most 10 minutes.
+	appJWTLifetime = 9 * time.Minute
+	// appJWTClockSkew backdates the JWT issue time to tolerate clock drift
+	appJWTClockSkew = 60 * time.Second
+	// installationTokenRefreshMargin is how long before expiry a cached installation token is refreshed
+	installationTokenRefreshMargin = 5 * time.Minute
+	// installationTokenTTL is the lifetime assumed for an installation token
+	// returned without an expiry, the one GitHub gives them
+	installationTokenTTL = time.Hour
+)
+
+// appTransport authenticates requests as a GitHub App installation.
+// It mints an app JWT, exchanges it for an installation token and caches
+// the token until shortly before it expires.
+type appTransport struct {
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	tokenURL       string
+	base           http.RoundTripper
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	// refreshing is closed when the token request in progress ends, nil
+	// when there is none
+	refreshing chan struct{}
+}
+
+// newAppTransport creates an appTransport from a PEM encoded RSA private key
+func newAppTransport(appID int64, installationID int64, privateKeyPEM []byte) (*appTransport, error) {
+	if appID == 0 {
+		return nil, fmt.Errorf("app ID is required for GitHub App authentication")
+	}
+	if installationID == 0 {
+		return nil, fmt.Errorf("installation ID is required for GitHub App authentication")
+	}
+	key, err := parsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &appTransport{
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		base:           http.DefaultTransport,
+	}, nil
+}
+
+// RoundTrip adds a valid installation token to the request. A token the
+// API rejects, e.g. because it was revoked, is dropped and the request is
+// sent once more with a new one, when its body can be sent again.
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.installationToken(req)
+	if err != nil {
+		return nil, err
+	}
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", "token "+token)
+	resp, err := t.base.RoundTrip(authorized)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	t.invalidate(token)
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	if !replayable {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if token, err = t.installationToken(req); err != nil {
+		return nil, err
+	}
+	retried := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retried.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retried.Header.Set("Authorization", "token "+token)
+	return t.base.RoundTrip(retried)
+}
+
+// invalidate drops the cached token if it is still token, so the next
+// request fetches a new one
+func (t *appTransport) invalidate(token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == token {
+		t.token, t.expiresAt = "", time.Time{}
+	}
+}
+
+// installationToken returns the cached installation token, refreshing it
+// when it is about to expire. A single request is sent at a time, the
+// other calls wait for its token without holding the lock during it.
+func (t *appTransport) installationToken(req *http.Request) (string, error) {
+	ctx := req.Context()
+	for {
+		t.mu.Lock()
+		if t.token != "" && time.Until(t.expiresAt) > installationTokenRefreshMargin {
+			token := t.token
+			t.mu.Unlock()
+			return token, nil
+		}
+		if t.refreshing == nil {
+			done := make(chan struct{})
+			t.refreshing = done
+			t.mu.Unlock()
+
+			token, expiresAt, err := t.fetchToken(ctx)
+			t.mu.Lock()
+			if err == nil {
+				t.token, t.expiresAt = token, expiresAt
+			}
+			t.refreshing = nil
+			t.mu.Unlock()
+			close(done)
+			return token, err
+		}
+		refreshing := t.refreshing
+		t.mu.Unlock()
+
+		// When the request in progress fails, the next waiter sends its own
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// fetchToken exchanges an app JWT for an installation token
+func (t *appTransport) fetchToken(ctx context.Context) (string, time.Time, error) {
+	jwt, err := t.appJWT(time.Now())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	tokenReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.tokenURL, http.NoBody)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create installation token request: %w", err)
+	}
+	tokenReq.Header.Set("Authorization", "Bearer "+jwt)
+	tokenReq.Header.Set("Accept", "application/vnd.github+json")
+	// Exchanging the token changes nothing, so it also happens in dry-run mode
+	tokenReq = dryrun.Allow(tokenReq)
+
+	resp, err := t.base.RoundTrip(tokenReq)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to request installation token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read installation token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		var errBody struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(body, &errBody)
+		if errBody.Message == "" {
+			errBody.Message = http.StatusText(resp.StatusCode)
+		}
+		e := apierror.FromResponse("github", resp, "failed to get installation token: "+errBody.Message)
+		if e.Category == apierror.Unauthorized || e.Category == apierror.NotFound {
+			e.Remediation = "Check the app ID, the installation ID and the private key of the GitHub App"
+		}
+		return "", time.Time{}, e
+	}
+
+	var installationToken struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &installationToken); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse installation token response: %w", err)
+	}
+	if installationToken.Token == "" {
+		return "", time.Time{}, fmt.Errorf("installation token response has no token")
+	}
+	if installationToken.ExpiresAt.IsZero() {
+		installationToken.ExpiresAt = time.Now().Add(installationTokenTTL)
+	}
+	return installationToken.Token, installationToken.ExpiresAt, nil
+}
+
+// appJWT mints the RS256 signed JWT identifying the app
+func (t *appTransport) appJWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(t.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var unsigned bytes.Buffer
+	unsigned.WriteString(base64.RawURLEncoding.EncodeToString(header))
+	unsigned.WriteByte('.')
+	unsigned.WriteString(base64.RawURLEncoding.EncodeToString(claims))
+
+	digest := sha256.Sum256(unsigned.Bytes())
+	signature, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app JWT: %w", err)
+	}
+	return unsigned.String() + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey parses a PKCS#1 or PKCS#8 PEM encoded RSA private key
+func parsePrivateKey(privateKeyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("GitHub App private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key is not an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,368 @@
+package github
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"mcp-server/apierror"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testKey is the private key of the test app, generated once
+var testKey = sync.OnceValue(func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+})
+
+// tokenEndpoint is a stand-in for the installation token endpoint of GitHub
+type tokenEndpoint struct {
+	t     *testing.T
+	calls atomic.Int32
+	// respond writes the response of the nth call, counting from 1
+	respond func(w http.ResponseWriter, n int)
+	// delay is how long each call takes
+	delay time.Duration
+}
+
+func (e *tokenEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := int(e.calls.Add(1))
+	if r.Method != http.MethodPost || r.URL.Path != "/app/installations/42/access_tokens" {
+		e.t.Errorf("unexpected token request %s %s", r.Method, r.URL.Path)
+	}
+	jwt, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		e.t.Errorf("token request without a bearer JWT: %q", r.Header.Get("Authorization"))
+	}
+	if _, err := verifyAppJWT(jwt, &testKey().PublicKey); err != nil {
+		e.t.Errorf("invalid app JWT: %v", err)
+	}
+	time.Sleep(e.delay)
+	e.respond(w, n)
+}
+
+// tokenResponse writes an installation token response
+func tokenResponse(w http.ResponseWriter, token string, expiresAt time.Time) {
+	body := map[string]interface{}{"token": token}
+	if !expiresAt.IsZero() {
+		body["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(body)
+}
+
+// newTestTransport returns an app transport whose token endpoint is served
+// by endpoint, and a client sending requests to an API server echoing the
+// Authorization header of each request
+func newTestTransport(t *testing.T, endpoint *tokenEndpoint) (*appTransport, *http.Client, string) {
+	t.Helper()
+	endpoint.t = t
+	tokens := httptest.NewServer(endpoint)
+	t.Cleanup(tokens.Close)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(api.Close)
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testKey())})
+	transport, err := newAppTransport(7, 42, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport.tokenURL = tokens.URL + "/app/installations/42/access_tokens"
+	return transport, &http.Client{Transport: transport}, api.URL
+}
+
+// authorization sends a request to the API server and returns the
+// Authorization header it received
+func authorization(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// verifyAppJWT checks the RS256 signature of an app JWT and returns its claims
+func verifyAppJWT(jwt string, key *rsa.PublicKey) (map[string]interface{}, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("JWT has %d parts", len(parts))
+	}
+	var header map[string]string
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		return nil, fmt.Errorf("unexpected header %v", header)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	return claims, decodeSegment(parts[1], &claims)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func TestAppJWT(t *testing.T) {
+	transport, _, _ := newTestTransport(t, &tokenEndpoint{})
+	now := time.Unix(1700000000, 0)
+	jwt, err := transport.appJWT(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifyAppJWT(jwt, &testKey().PublicKey)
+	if err != nil {
+		t.Fatalf("verifying app JWT: %v", err)
+	}
+	if claims["iss"] != "7" {
+		t.Errorf("iss = %v, want the app ID 7", claims["iss"])
+	}
+	if iat := int64(claims["iat"].(float64)); iat != now.Add(-appJWTClockSkew).Unix() {
+		t.Errorf("iat = %d, want the time backdated by the clock skew", iat)
+	}
+	if exp := int64(claims["exp"].(float64)); exp != now.Add(appJWTLifetime).Unix() || exp-now.Unix() > 600 {
+		t.Errorf("exp = %d, want within GitHub's 10 minute limit", exp)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyAppJWT(jwt, &other.PublicKey); err == nil {
+		t.Error("app JWT verified with another key")
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		pem     []byte
+		wantErr bool
+	}{
+		{"PKCS#1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testKey())}), false},
+		{"PKCS#8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), false},
+		{"not PEM", []byte("not a key"), true},
+		{"garbage", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parsePrivateKey(tt.pem)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parsePrivateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstallationTokenCached(t *testing.T) {
+	endpoint := &tokenEndpoint{respond: func(w http.ResponseWriter, n int) {
+		tokenResponse(w, fmt.Sprintf("ghs_token%d", n), time.Now().Add(time.Hour))
+	}}
+	_, client, api := newTestTransport(t, endpoint)
+
+	for i := 0; i < 3; i++ {
+		if got := authorization(t, client, api); got != "token ghs_token1" {
+			t.Fatalf("request %d sent Authorization %q, want the first token", i, got)
+		}
+	}
+	if calls := endpoint.calls.Load(); calls != 1 {
+		t.Errorf("token endpoint called %d times, want 1", calls)
+	}
+}
+
+func TestInstallationTokenRefresh(t *testing.T) {
+	// The first token expires within the refresh margin
+	endpoint := &tokenEndpoint{respond: func(w http.ResponseWriter, n int) {
+		expiresAt := time.Now().Add(time.Hour)
+		if n == 1 {
+			expiresAt = time.Now().Add(installationTokenRefreshMargin / 2)
+		}
+		tokenResponse(w, fmt.Sprintf("ghs_token%d", n), expiresAt)
+	}}
+	_, client, api := newTestTransport(t, endpoint)
+
+	if got := authorization(t, client, api); got != "token ghs_token1" {
+		t.Fatalf("first request sent %q", got)
+	}
+	if got := authorization(t, client, api); got != "token ghs_token2" {
+		t.Fatalf("request after the token neared expiry sent %q, want a refreshed token", got)
+	}
+	if got := authorization(t, client, api); got != "token ghs_token2" {
+		t.Fatalf("request with a fresh token sent %q, want it cached", got)
+	}
+	if calls := endpoint.calls.Load(); calls != 2 {
+		t.Errorf("token endpoint called %d times, want 2", calls)
+	}
+}
+
+func TestInstallationTokenWithoutExpiry(t *testing.T) {
+	endpoint := &tokenEndpoint{respond: func(w http.ResponseWriter, n int) {
+		tokenResponse(w, fmt.Sprintf("ghs_token%d", n), time.Time{})
+	}}
+	transport, client, api := newTestTransport(t, endpoint)
+
+	authorization(t, client, api)
+	authorization(t, client, api)
+	if calls := endpoint.calls.Load(); calls != 1 {
+		t.Errorf("token endpoint called %d times, want the token cached for the default TTL", calls)
+	}
+	if ttl := time.Until(transport.expiresAt); ttl < installationTokenTTL-time.Minute || ttl > installationTokenTTL {
+		t.Errorf("token expires in %s, want about %s", ttl, installationTokenTTL)
+	}
+}
+
+func TestInstallationTokenConcurrent(t *testing.T) {
+	endpoint := &tokenEndpoint{delay: 100 * time.Millisecond, respond: func(w http.ResponseWriter, n int) {
+		tokenResponse(w, fmt.Sprintf("ghs_token%d", n), time.Now().Add(time.Hour))
+	}}
+	_, client, api := newTestTransport(t, endpoint)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := authorization(t, client, api); got != "token ghs_token1" {
+				t.Errorf("concurrent request sent %q", got)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls := endpoint.calls.Load(); calls != 1 {
+		t.Errorf("token endpoint called %d times by concurrent requests, want 1", calls)
+	}
+}
+
+func TestInstallationTokenError(t *testing.T) {
+	endpoint := &tokenEndpoint{respond: func(w http.ResponseWriter, n int) {
+		if n == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "A JSON web token could not be decoded"}`)
+			return
+		}
+		tokenResponse(w, "ghs_token", time.Now().Add(time.Hour))
+	}}
+	_, client, api := newTestTransport(t, endpoint)
+
+	_, err := client.Get(api)
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want an apierror", err)
+	}
+	if apiErr.Category != apierror.Unauthorized || !strings.Contains(apiErr.Message, "could not be decoded") {
+		t.Errorf("error = %s (%s), want unauthorized with the GitHub message", apiErr.Message, apiErr.Category)
+	}
+	if !strings.Contains(apiErr.Remediation, "installation ID") {
+		t.Errorf("remediation = %q, want a hint about the app settings", apiErr.Remediation)
+	}
+
+	// A failed exchange is not cached
+	if got := authorization(t, client, api); got != "token ghs_token" {
+		t.Errorf("request after a failed exchange sent %q", got)
+	}
+}
+
+func TestInstallationTokenRevoked(t *testing.T) {
+	endpoint := &tokenEndpoint{respond: func(w http.ResponseWriter, n int) {
+		tokenResponse(w, fmt.Sprintf("ghs_token%d", n), time.Now().Add(time.Hour))
+	}}
+	_, client, _ := newTestTransport(t, endpoint)
+	// The first token was revoked before it expired
+	var bodies []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if r.Header.Get("Authorization") == "token ghs_token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(api.Close)
+
+	resp, err := client.Post(api.URL, "application/json", strings.NewReader(`{"title":"Crash"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "token ghs_token2" {
+		t.Errorf("response = %d %q, want the request sent again with a new token", resp.StatusCode, body)
+	}
+	if len(bodies) != 2 || bodies[1] != `{"title":"Crash"}` {
+		t.Errorf("API received bodies %q, want the body sent twice", bodies)
+	}
+	if got := authorization(t, client, api.URL); got != "token ghs_token2" {
+		t.Errorf("next request sent %q, want the new token cached", got)
+	}
+	if calls := endpoint.calls.Load(); calls != 2 {
+		t.Errorf("token endpoint called %d times, want 2", calls)
+	}
+}
+
+func TestInstallationTokenRevokedNotReplayable(t *testing.T) {
+	endpoint := &tokenEndpoint{respond: func(w http.ResponseWriter, n int) {
+		tokenResponse(w, fmt.Sprintf("ghs_token%d", n), time.Now().Add(time.Hour))
+	}}
+	_, client, _ := newTestTransport(t, endpoint)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "token ghs_token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(api.Close)
+
+	// A body that cannot be read again is not sent twice, but the token is dropped
+	resp, err := client.Post(api.URL, "application/json", io.NopCloser(strings.NewReader("{}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want the 401", resp.StatusCode)
+	}
+	if got := authorization(t, client, api.URL); got != "token ghs_token2" {
+		t.Errorf("next request sent %q, want a new token", got)
+	}
+}
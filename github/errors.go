@@ -0,0 +1,107 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"mcp-server/apierror"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+)
+
+// wrapError classifies an error of the GitHub API. Errors of other kinds
+// are returned unchanged.
+func wrapError(err error) error {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var errResp *github.ErrorResponse
+	switch {
+	case errors.As(err, &rateErr):
+		e := apierror.New("github", apierror.RateLimited, "GitHub API rate limit exceeded")
+		e.Status = statusOf(rateErr.Response)
+		e.RetryAfter = time.Until(rateErr.Rate.Reset.Time).Round(time.Second)
+		e.Remediation = fmt.Sprintf("The token allows %d requests per hour; wait for the reset, or use a GitHub App installation for a higher limit", rateErr.Rate.Limit)
+		e.Err = err
+		return e
+	case errors.As(err, &abuseErr):
+		e := apierror.New("github", apierror.RateLimited, "GitHub secondary rate limit exceeded")
+		e.Status = statusOf(abuseErr.Response)
+		e.RetryAfter = abuseErr.GetRetryAfter()
+		e.Remediation = "Slow down: send fewer concurrent requests and space out writes"
+		e.Err = err
+		return e
+	case errors.As(err, &errResp) && errResp.Response != nil:
+		e := apierror.FromResponse("github", errResp.Response, responseMessage(errResp))
+		if e.Category == apierror.Forbidden {
+			if remediation := scopeRemediation(errResp.Response.Header); remediation != "" {
+				e.Remediation = remediation
+			}
+		}
+		e.Err = err
+		return e
+	}
+	return apierror.Wrap("github", err)
+}
+
+// responseMessage describes an error response by its message, the
+// validation errors it details and the request it answers
+func responseMessage(errResp *github.ErrorResponse) string {
+	message := errResp.Message
+	if message == "" {
+		message = http.StatusText(errResp.Response.StatusCode)
+	}
+	var details []string
+	for _, detail := range errResp.Errors {
+		switch {
+		case detail.Message != "":
+			details = append(details, detail.Message)
+		case detail.Field != "":
+			details = append(details, fmt.Sprintf("%s %s", detail.Field, detail.Code))
+		}
+	}
+	if len(details) > 0 {
+		message += ": " + strings.Join(details, "; ")
+	}
+	if req := errResp.Response.Request; req != nil {
+		message += fmt.Sprintf(" (%s %s)", req.Method, req.URL.Path)
+	}
+	return message
+}
+
+// scopeRemediation names the OAuth scopes a classic token lacks for a
+// request, from the scopes GitHub accepts for it and the ones the token has
+func scopeRemediation(header http.Header) string {
+	accepted := splitScopes(header.Get("X-Accepted-OAuth-Scopes"))
+	if len(accepted) == 0 || header.Values("X-OAuth-Scopes") == nil {
+		return ""
+	}
+	for _, granted := range splitScopes(header.Get("X-OAuth-Scopes")) {
+		for _, scope := range accepted {
+			if granted == scope {
+				return ""
+			}
+		}
+	}
+	return fmt.Sprintf("token lacks %s scope", strings.Join(accepted, " or "))
+}
+
+// splitScopes splits a comma-separated scope header
+func splitScopes(value string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(value, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// statusOf returns the status code of a response, 0 without one
+func statusOf(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
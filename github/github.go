@@ -3,7 +3,12 @@ package github
 import (
 	"context"
 	"fmt"
+	"mcp-server/apierror"
+	"mcp-server/dryrun"
 	"mcp-server/tools"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/google/go-github/v63/github"
 )
@@ -15,317 +20,465 @@ type GithubClient struct {
 }
 
 // NewGithubClient creates a new GithubClient
-// It takes a token as an argument and returns a new GithubClient
-// The token is used to authenticate with the Github API
-func NewGithubClient(token string) *GithubClient {
-	client := github.NewClient(nil).WithAuthToken(token)
-	return &GithubClient{client: client}
+// It takes the HTTP client requests are sent with (nil for a default one), a token and
+// optional GitHub Enterprise Server URLs as arguments and returns a new GithubClient.
+// The token is used to authenticate with the Github API.
+// When baseURL is empty the client targets api.github.com; when only baseURL is set
+// the upload URL is derived from it.
+func NewGithubClient(httpClient *http.Client, token string, baseURL string, uploadURL string) (*GithubClient, error) {
+	client, err := newClient(github.NewClient(httpClient).WithAuthToken(token), baseURL, uploadURL)
+	if err != nil {
+		return nil, err
+	}
+	return &GithubClient{client: client}, nil
+}
+
+// NewGithubAppClient creates a new GithubClient authenticated as a GitHub App installation
+// It takes the HTTP client requests are sent with (nil for a default one), the app ID,
+// installation ID and PEM encoded private key of the app, plus optional GitHub Enterprise
+// Server URLs. Installation tokens are minted and refreshed automatically.
+func NewGithubAppClient(httpClient *http.Client, appID int64, installationID int64, privateKeyPEM []byte, baseURL string, uploadURL string) (*GithubClient, error) {
+	transport, err := newAppTransport(appID, installationID, privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	appClient := &http.Client{Transport: transport}
+	if httpClient != nil {
+		*appClient = *httpClient
+		if httpClient.Transport != nil {
+			transport.base = httpClient.Transport
+		}
+		appClient.Transport = transport
+	}
+	client, err := newClient(github.NewClient(appClient), baseURL, uploadURL)
+	if err != nil {
+		return nil, err
+	}
+	transport.tokenURL = fmt.Sprintf("%sapp/installations/%d/access_tokens", client.BaseURL, installationID)
+	return &GithubClient{client: client}, nil
+}
+
+// newClient points client at the given GitHub Enterprise Server URLs, if any
+func newClient(client *github.Client, baseURL string, uploadURL string) (*github.Client, error) {
+	if baseURL == "" {
+		return client, nil
+	}
+
+	if uploadURL == "" {
+		// Uploads are served from the root of the instance, whatever the
+		// path of the API: https://host/api/uploads/
+		base, err := url.Parse(baseURL)
+		if err != nil || base.Scheme == "" || base.Host == "" {
+			return nil, fmt.Errorf("invalid GitHub Enterprise URL %q", baseURL)
+		}
+		uploadURL = base.Scheme + "://" + base.Host + "/api/uploads/"
+	}
+	client, err := client.WithEnterpriseURLs(baseURL, uploadURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub Enterprise URL: %w", err)
+	}
+	return client, nil
 }
 
 // GetPullRequest gets a pull request from a repository
 // It takes the owner, repo, and pull request number as arguments
-// It returns a string representation of the pull request and an error if any
-func (c *GithubClient) GetPullRequest(owner string, repo string, pullRequestNumber int) (string, error) {
-	pr, _, err := c.client.PullRequests.Get(context.Background(), owner, repo, pullRequestNumber)
+// It returns the pull request and an error if any
+func (c *GithubClient) GetPullRequest(ctx context.Context, owner string, repo string, pullRequestNumber int) (*tools.PullRequest, error) {
+	pr, _, err := c.client.PullRequests.Get(ctx, owner, repo, pullRequestNumber)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	return pr.String(), nil
+	return toPullRequest(pr), nil
 }
 
 // GetPullRequestDiff gets the diff of a pull request from a repository
 // It takes the owner, repo, and pull request number as arguments
-// It returns the diff as a string and an error if any
-func (c *GithubClient) GetPullRequestDiff(owner string, repo string, pullRequestNumber int) (string, error) {
+// It returns the diff and an error if any
+func (c *GithubClient) GetPullRequestDiff(ctx context.Context, owner string, repo string, pullRequestNumber int) (tools.Diff, error) {
 	// GitHub API supports getting PR diff in different formats
 	// We'll use the unified diff format which is most readable for analysis
-	diff, _, err := c.client.PullRequests.GetRaw(context.Background(), owner, repo, pullRequestNumber, github.RawOptions{
+	diff, _, err := c.client.PullRequests.GetRaw(ctx, owner, repo, pullRequestNumber, github.RawOptions{
 		Type: github.Diff,
 	})
 	if err != nil {
-		return "", err
+		return "", wrapError(err)
 	}
-	return string(diff), nil
+	return tools.Diff(diff), nil
 }
 
 // CreateIssue creates an issue in a repository
-func (c *GithubClient) CreateIssue(owner string, repo string, title string, body string) (string, error) {
+func (c *GithubClient) CreateIssue(ctx context.Context, owner string, repo string, title string, body string) (*tools.Issue, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolveRepository(ctx, owner, repo); err != nil {
+			return nil, err
+		}
+	}
 	issueRequest := &github.IssueRequest{
 		Title: &title,
 		Body:  &body,
 	}
-	issue, _, err := c.client.Issues.Create(context.Background(), owner, repo, issueRequest)
+	issue, _, err := c.client.Issues.Create(ctx, owner, repo, issueRequest)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	return issue.String(), nil
+	return toIssue(issue), nil
 }
 
 // CreatePullRequest creates a pull request in a repository
-func (c *GithubClient) CreatePullRequest(owner string, repo string, title string, body string, head string, base string) (string, error) {
+func (c *GithubClient) CreatePullRequest(ctx context.Context, owner string, repo string, title string, body string, head string, base string) (*tools.PullRequest, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolveBranch(ctx, owner, repo, base); err != nil {
+			return nil, err
+		}
+		if err := c.resolveBranch(ctx, owner, repo, head); err != nil {
+			return nil, err
+		}
+	}
 	newPR := &github.NewPullRequest{
 		Title: &title,
 		Body:  &body,
 		Head:  &head,
 		Base:  &base,
 	}
-	pr, _, err := c.client.PullRequests.Create(context.Background(), owner, repo, newPR)
+	pr, _, err := c.client.PullRequests.Create(ctx, owner, repo, newPR)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	return pr.String(), nil
+	return toPullRequest(pr), nil
 }
 
 // GetComments gets the comments from an issue
-func (c *GithubClient) GetComments(owner string, repo string, issueNumber int) (string, error) {
-	comments, _, err := c.client.Issues.ListComments(context.Background(), owner, repo, issueNumber, nil)
+func (c *GithubClient) GetComments(ctx context.Context, owner string, repo string, issueNumber int) ([]tools.Comment, error) {
+	comments, _, err := c.client.Issues.ListComments(ctx, owner, repo, issueNumber, nil)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	var result string
+	result := make([]tools.Comment, 0, len(comments))
 	for _, comment := range comments {
-		result += comment.String() + "\n"
+		result = append(result, *toComment(comment))
 	}
 	return result, nil
 }
 
 // AddComment adds a comment to an issue
-func (c *GithubClient) AddComment(owner string, repo string, issueNumber int, body string) (string, error) {
+func (c *GithubClient) AddComment(ctx context.Context, owner string, repo string, issueNumber int, body string) (*tools.Comment, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolveIssue(ctx, owner, repo, issueNumber); err != nil {
+			return nil, err
+		}
+	}
 	comment := &github.IssueComment{
 		Body: &body,
 	}
-	newComment, _, err := c.client.Issues.CreateComment(context.Background(), owner, repo, issueNumber, comment)
+	newComment, _, err := c.client.Issues.CreateComment(ctx, owner, repo, issueNumber, comment)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
+	}
+	return toComment(newComment), nil
+}
+
+// DeleteComment deletes a comment of an issue or pull request
+func (c *GithubClient) DeleteComment(ctx context.Context, owner string, repo string, commentID int64) error {
+	if _, err := c.client.Issues.DeleteComment(ctx, owner, repo, commentID); err != nil {
+		return wrapError(err)
 	}
-	return newComment.String(), nil
+	return nil
 }
 
 // AssignCopilot assigns copilot to an issue or pull request
-func (c *GithubClient) AssignCopilot(owner string, repo string, issueNumber int, assignees []string) (string, error) {
-	issue, _, err := c.client.Issues.AddAssignees(context.Background(), owner, repo, issueNumber, assignees)
+func (c *GithubClient) AssignCopilot(ctx context.Context, owner string, repo string, issueNumber int, assignees []string) (*tools.Issue, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolveIssue(ctx, owner, repo, issueNumber); err != nil {
+			return nil, err
+		}
+	}
+	issue, _, err := c.client.Issues.AddAssignees(ctx, owner, repo, issueNumber, assignees)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return toIssue(issue), nil
+}
+
+// RemoveAssignees removes assignees from an issue or pull request
+func (c *GithubClient) RemoveAssignees(ctx context.Context, owner string, repo string, issueNumber int, assignees []string) (*tools.Issue, error) {
+	issue, _, err := c.client.Issues.RemoveAssignees(ctx, owner, repo, issueNumber, assignees)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return toIssue(issue), nil
+}
+
+// CloseIssue closes an issue or pull request
+func (c *GithubClient) CloseIssue(ctx context.Context, owner string, repo string, issueNumber int) (*tools.Issue, error) {
+	issue, _, err := c.client.Issues.Edit(ctx, owner, repo, issueNumber, &github.IssueRequest{State: github.String("closed")})
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	return issue.String(), nil
+	return toIssue(issue), nil
 }
 
 // CreateBranch creates a branch in a repository
-func (c *GithubClient) CreateBranch(owner string, repo string, branchName string, sha string) (string, error) {
+func (c *GithubClient) CreateBranch(ctx context.Context, owner string, repo string, branchName string, sha string) (*tools.Branch, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolveNewBranch(ctx, owner, repo, branchName, sha); err != nil {
+			return nil, err
+		}
+	}
 	ref := &github.Reference{
 		Ref: github.String("refs/heads/" + branchName),
 		Object: &github.GitObject{
 			SHA: &sha,
 		},
 	}
-	newRef, _, err := c.client.Git.CreateRef(context.Background(), owner, repo, ref)
+	newRef, _, err := c.client.Git.CreateRef(ctx, owner, repo, ref)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	return newRef.String(), nil
+	return toBranchRef(newRef), nil
+}
+
+// DeleteBranch deletes a branch of a repository
+func (c *GithubClient) DeleteBranch(ctx context.Context, owner string, repo string, branchName string) error {
+	if _, err := c.client.Git.DeleteRef(ctx, owner, repo, "heads/"+branchName); err != nil {
+		return wrapError(err)
+	}
+	return nil
 }
 
 // CreateRepository creates a new repository
-func (c *GithubClient) CreateRepository(name string, description string, private bool) (string, error) {
+func (c *GithubClient) CreateRepository(ctx context.Context, name string, description string, private bool) (*tools.Repository, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolveNewRepository(ctx, name); err != nil {
+			return nil, err
+		}
+	}
 	repo := &github.Repository{
 		Name:        &name,
 		Description: &description,
 		Private:     &private,
 	}
-	newRepo, _, err := c.client.Repositories.Create(context.Background(), "", repo)
+	newRepo, _, err := c.client.Repositories.Create(ctx, "", repo)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	return newRepo.String(), nil
+	return toRepository(newRepo), nil
 }
 
 // GetCommit gets a commit from a repository
-func (c *GithubClient) GetCommit(owner string, repo string, sha string) (string, error) {
-	commit, _, err := c.client.Git.GetCommit(context.Background(), owner, repo, sha)
+func (c *GithubClient) GetCommit(ctx context.Context, owner string, repo string, sha string) (*tools.Commit, error) {
+	commit, _, err := c.client.Git.GetCommit(ctx, owner, repo, sha)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	return commit.String(), nil
+	return toGitCommit(commit), nil
 }
 
 // GetIssue gets an issue from a repository
-func (c *GithubClient) GetIssue(owner string, repo string, issueNumber int) (string, error) {
-	issue, _, err := c.client.Issues.Get(context.Background(), owner, repo, issueNumber)
+func (c *GithubClient) GetIssue(ctx context.Context, owner string, repo string, issueNumber int) (*tools.Issue, error) {
+	issue, _, err := c.client.Issues.Get(ctx, owner, repo, issueNumber)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	return issue.String(), nil
+	return toIssue(issue), nil
+}
+
+// ListRecentIssues lists the issues of a repository created since a time,
+// newest first. Pull requests are left out.
+func (c *GithubClient) ListRecentIssues(ctx context.Context, owner string, repo string, since time.Time) ([]tools.Issue, error) {
+	opts := &github.IssueListByRepoOptions{
+		State:       "all",
+		Sort:        "created",
+		Direction:   "desc",
+		Since:       since,
+		ListOptions: github.ListOptions{PerPage: 50},
+	}
+	issues, _, err := c.client.Issues.ListByRepo(ctx, owner, repo, opts)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	result := []tools.Issue{}
+	for _, issue := range issues {
+		if issue.IsPullRequest() || issue.GetCreatedAt().Before(since) {
+			continue
+		}
+		result = append(result, *toIssue(issue))
+	}
+	return result, nil
 }
 
 // GetReleaseByTag gets a release by tag from a repository
-func (c *GithubClient) GetReleaseByTag(owner string, repo string, tagName string) (string, error) {
-	release, _, err := c.client.Repositories.GetReleaseByTag(context.Background(), owner, repo, tagName)
+func (c *GithubClient) GetReleaseByTag(ctx context.Context, owner string, repo string, tagName string) (*tools.Release, error) {
+	release, _, err := c.client.Repositories.GetReleaseByTag(ctx, owner, repo, tagName)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	return release.String(), nil
+	return toRelease(release), nil
 }
 
 // GetTag gets a tag from a repository
-func (c *GithubClient) GetTag(owner string, repo string, tagName string) (string, error) {
+func (c *GithubClient) GetTag(ctx context.Context, owner string, repo string, tagName string) (*tools.Tag, error) {
 	// There is no direct way to get a tag by name.
 	// We need to list all tags and find the one with the matching name.
-	tags, _, err := c.client.Repositories.ListTags(context.Background(), owner, repo, nil)
+	tags, _, err := c.client.Repositories.ListTags(ctx, owner, repo, nil)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 	for _, tag := range tags {
-		if *tag.Name == tagName {
-			return fmt.Sprintf("Tag: %s\nCommit: %s", *tag.Name, *tag.Commit.SHA), nil
+		if tag.GetName() == tagName {
+			return &tools.Tag{Name: tag.GetName(), SHA: tag.GetCommit().GetSHA()}, nil
 		}
 	}
-	return "Tag not found", nil
+	return nil, apierror.New("github", apierror.NotFound, fmt.Sprintf("tag %s not found in %s/%s", tagName, owner, repo))
 }
 
 // ListBranches lists the branches of a repository
-func (c *GithubClient) ListBranches(owner string, repo string) (string, error) {
-	branches, _, err := c.client.Repositories.ListBranches(context.Background(), owner, repo, nil)
+func (c *GithubClient) ListBranches(ctx context.Context, owner string, repo string) ([]tools.Branch, error) {
+	branches, _, err := c.client.Repositories.ListBranches(ctx, owner, repo, nil)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	var result string
+	result := make([]tools.Branch, 0, len(branches))
 	for _, branch := range branches {
-		result += fmt.Sprintf("Branch: %s\nSHA: %s\n\n", *branch.Name, *branch.Commit.SHA)
+		result = append(result, tools.Branch{
+			Name:      branch.GetName(),
+			SHA:       branch.GetCommit().GetSHA(),
+			Protected: branch.GetProtected(),
+		})
 	}
 	return result, nil
 }
 
 // ListCommits lists the commits of a repository
-func (c *GithubClient) ListCommits(owner string, repo string) (string, error) {
-	commits, _, err := c.client.Repositories.ListCommits(context.Background(), owner, repo, nil)
+func (c *GithubClient) ListCommits(ctx context.Context, owner string, repo string) ([]tools.Commit, error) {
+	commits, _, err := c.client.Repositories.ListCommits(ctx, owner, repo, nil)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	var result string
+	result := make([]tools.Commit, 0, len(commits))
 	for _, commit := range commits {
-		result += commit.String() + "\n"
+		result = append(result, *toRepositoryCommit(commit))
 	}
 	return result, nil
 }
 
 // GetWorkflows gets the workflows of a repository
-func (c *GithubClient) GetWorkflows(owner string, repo string) (string, error) {
-	workflows, _, err := c.client.Actions.ListWorkflows(context.Background(), owner, repo, nil)
+func (c *GithubClient) GetWorkflows(ctx context.Context, owner string, repo string) ([]tools.Workflow, error) {
+	workflows, _, err := c.client.Actions.ListWorkflows(ctx, owner, repo, nil)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
-	var result string
+	result := make([]tools.Workflow, 0, len(workflows.Workflows))
 	for _, workflow := range workflows.Workflows {
-		result += fmt.Sprintf("Workflow: %s\nID: %d\nState: %s\n\n",
-			*workflow.Name, *workflow.ID, *workflow.State)
+		result = append(result, *toWorkflow(workflow))
 	}
 	return result, nil
 }
 
 // RunWorkflow runs a workflow in a repository
-func (c *GithubClient) RunWorkflow(owner string, repo string, workflowID string, ref string) (string, error) {
+func (c *GithubClient) RunWorkflow(ctx context.Context, owner string, repo string, workflowID string, ref string) (tools.Message, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolveWorkflow(ctx, owner, repo, workflowID); err != nil {
+			return "", err
+		}
+	}
 	opts := github.CreateWorkflowDispatchEventRequest{
 		Ref: ref,
 	}
-	_, err := c.client.Actions.CreateWorkflowDispatchEventByFileName(context.Background(), owner, repo, workflowID, opts)
+	_, err := c.client.Actions.CreateWorkflowDispatchEventByFileName(ctx, owner, repo, workflowID, opts)
 	if err != nil {
-		return "", err
+		return "", wrapError(err)
 	}
 	return "Workflow run successfully", nil
 }
 
 // RunFailedJobs runs the failed jobs of a workflow
-func (c *GithubClient) RunFailedJobs(owner string, repo string, runID int64) (string, error) {
+func (c *GithubClient) RunFailedJobs(ctx context.Context, owner string, repo string, runID int64) (tools.Message, error) {
 	// TODO: Implement this method
 	return "", nil
 }
 
 // CreateCommit creates a commit in a repository
-func (c *GithubClient) CreateCommit(owner string, repo string, message string, tree string, parents []string) (string, error) {
+func (c *GithubClient) CreateCommit(ctx context.Context, owner string, repo string, message string, tree string, parents []string) (*tools.Commit, error) {
 	// TODO: Implement this method
-	return "", nil
+	return nil, nil
 }
 
 // Push pushes to a repository
-func (c *GithubClient) Push(owner string, repo string, ref string, sha string) (string, error) {
+func (c *GithubClient) Push(ctx context.Context, owner string, repo string, ref string, sha string) (tools.Message, error) {
 	// TODO: Implement this method
 	return "", nil
 }
 
 // SearchCode searches for code in a repository
-func (c *GithubClient) SearchCode(query string) (string, error) {
+func (c *GithubClient) SearchCode(ctx context.Context, query string) ([]tools.CodeResult, error) {
 	opts := &github.SearchOptions{
 		Sort:  "indexed",
 		Order: "desc",
 	}
-	result, _, err := c.client.Search.Code(context.Background(), query, opts)
+	result, _, err := c.client.Search.Code(ctx, query, opts)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	var output string
+	output := make([]tools.CodeResult, 0, len(result.CodeResults))
 	for _, codeResult := range result.CodeResults {
-		output += fmt.Sprintf("File: %s\nRepo: %s\nURL: %s\n\n",
-			*codeResult.Name, *codeResult.Repository.FullName, *codeResult.HTMLURL)
+		output = append(output, *toCodeResult(codeResult))
 	}
 	return output, nil
 }
 
 // SearchIssues searches for issues in a repository
-func (c *GithubClient) SearchIssues(query string) (string, error) {
+func (c *GithubClient) SearchIssues(ctx context.Context, query string) ([]tools.Issue, error) {
 	opts := &github.SearchOptions{
 		Sort:  "updated",
 		Order: "desc",
 	}
-	result, _, err := c.client.Search.Issues(context.Background(), query, opts)
+	result, _, err := c.client.Search.Issues(ctx, query, opts)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	var output string
+	output := make([]tools.Issue, 0, len(result.Issues))
 	for _, issue := range result.Issues {
-		output += fmt.Sprintf("Title: %s\nNumber: %d\nState: %s\nURL: %s\n\n",
-			*issue.Title, *issue.Number, *issue.State, *issue.HTMLURL)
+		output = append(output, *toIssue(issue))
 	}
 	return output, nil
 }
 
 // SearchPullRequests searches for pull requests in a repository
-func (c *GithubClient) SearchPullRequests(query string) (string, error) {
+func (c *GithubClient) SearchPullRequests(ctx context.Context, query string) ([]tools.Issue, error) {
 	// GitHub API treats pull requests as issues, so we'll search for issues with is:pr
 	fullQuery := query + " is:pr"
 	opts := &github.SearchOptions{
 		Sort:  "updated",
 		Order: "desc",
 	}
-	result, _, err := c.client.Search.Issues(context.Background(), fullQuery, opts)
+	result, _, err := c.client.Search.Issues(ctx, fullQuery, opts)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	var output string
+	output := make([]tools.Issue, 0, len(result.Issues))
 	for _, pr := range result.Issues {
-		output += fmt.Sprintf("Title: %s\nNumber: %d\nState: %s\nURL: %s\n\n",
-			*pr.Title, *pr.Number, *pr.State, *pr.HTMLURL)
+		output = append(output, *toIssue(pr))
 	}
 	return output, nil
 }
 
 // SearchRepositories searches for repositories
-func (c *GithubClient) SearchRepositories(query string) (string, error) {
+func (c *GithubClient) SearchRepositories(ctx context.Context, query string) ([]tools.Repository, error) {
 	opts := &github.SearchOptions{
 		Sort:  "stars",
 		Order: "desc",
 	}
-	result, _, err := c.client.Search.Repositories(context.Background(), query, opts)
+	result, _, err := c.client.Search.Repositories(ctx, query, opts)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	var output string
+	output := make([]tools.Repository, 0, len(result.Repositories))
 	for _, repo := range result.Repositories {
-		output += fmt.Sprintf("Name: %s\nDescription: %s\nStars: %d\nURL: %s\n\n",
-			*repo.FullName, repo.GetDescription(), *repo.StargazersCount, *repo.HTMLURL)
+		output = append(output, *toRepository(repo))
 	}
 	return output, nil
 }
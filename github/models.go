@@ -0,0 +1,163 @@
+package github
+
+import (
+	"mcp-server/tools"
+	"strings"
+
+	"github.com/google/go-github/v63/github"
+)
+
+// The functions below convert go-github objects to the tool models,
+// keeping the fields worth showing. They are nil-safe through the getters.
+
+func toPullRequest(pr *github.PullRequest) *tools.PullRequest {
+	result := &tools.PullRequest{
+		Number:       pr.GetNumber(),
+		Title:        pr.GetTitle(),
+		State:        pr.GetState(),
+		Draft:        pr.GetDraft(),
+		Merged:       pr.GetMerged(),
+		Author:       pr.GetUser().GetLogin(),
+		Head:         pr.GetHead().GetLabel(),
+		Base:         pr.GetBase().GetRef(),
+		Labels:       labelNames(pr.Labels),
+		Assignees:    userLogins(pr.Assignees),
+		Reviewers:    userLogins(pr.RequestedReviewers),
+		Additions:    pr.GetAdditions(),
+		Deletions:    pr.GetDeletions(),
+		ChangedFiles: pr.GetChangedFiles(),
+		CreatedAt:    pr.GetCreatedAt().Time,
+		UpdatedAt:    pr.GetUpdatedAt().Time,
+		URL:          pr.GetHTMLURL(),
+		Body:         pr.GetBody(),
+	}
+	if pr.MergedAt != nil {
+		result.MergedAt = &pr.MergedAt.Time
+	}
+	return result
+}
+
+func toIssue(issue *github.Issue) *tools.Issue {
+	result := &tools.Issue{
+		Number:        issue.GetNumber(),
+		Title:         issue.GetTitle(),
+		State:         issue.GetState(),
+		IsPullRequest: issue.IsPullRequest(),
+		Author:        issue.GetUser().GetLogin(),
+		Labels:        labelNames(issue.Labels),
+		Assignees:     userLogins(issue.Assignees),
+		Comments:      issue.GetComments(),
+		CreatedAt:     issue.GetCreatedAt().Time,
+		UpdatedAt:     issue.GetUpdatedAt().Time,
+		URL:           issue.GetHTMLURL(),
+		Body:          issue.GetBody(),
+	}
+	if issue.ClosedAt != nil {
+		result.ClosedAt = &issue.ClosedAt.Time
+	}
+	return result
+}
+
+func toComment(comment *github.IssueComment) *tools.Comment {
+	return &tools.Comment{
+		ID:        comment.GetID(),
+		Author:    comment.GetUser().GetLogin(),
+		CreatedAt: comment.GetCreatedAt().Time,
+		URL:       comment.GetHTMLURL(),
+		Body:      comment.GetBody(),
+	}
+}
+
+func toRepositoryCommit(commit *github.RepositoryCommit) *tools.Commit {
+	author := commit.GetAuthor().GetLogin()
+	if author == "" {
+		author = commit.GetCommit().GetAuthor().GetName()
+	}
+	return &tools.Commit{
+		SHA:     commit.GetSHA(),
+		Author:  author,
+		Date:    commit.GetCommit().GetAuthor().GetDate().Time,
+		URL:     commit.GetHTMLURL(),
+		Message: commit.GetCommit().GetMessage(),
+	}
+}
+
+func toGitCommit(commit *github.Commit) *tools.Commit {
+	return &tools.Commit{
+		SHA:     commit.GetSHA(),
+		Author:  commit.GetAuthor().GetName(),
+		Date:    commit.GetAuthor().GetDate().Time,
+		URL:     commit.GetHTMLURL(),
+		Message: commit.GetMessage(),
+	}
+}
+
+func toRepository(repo *github.Repository) *tools.Repository {
+	return &tools.Repository{
+		FullName:      repo.GetFullName(),
+		Description:   repo.GetDescription(),
+		Private:       repo.GetPrivate(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		Language:      repo.GetLanguage(),
+		Stars:         repo.GetStargazersCount(),
+		URL:           repo.GetHTMLURL(),
+	}
+}
+
+func toRelease(release *github.RepositoryRelease) *tools.Release {
+	result := &tools.Release{
+		TagName:    release.GetTagName(),
+		Name:       release.GetName(),
+		Draft:      release.GetDraft(),
+		Prerelease: release.GetPrerelease(),
+		Author:     release.GetAuthor().GetLogin(),
+		URL:        release.GetHTMLURL(),
+		Body:       release.GetBody(),
+	}
+	if release.PublishedAt != nil {
+		result.PublishedAt = &release.PublishedAt.Time
+	}
+	return result
+}
+
+func toWorkflow(workflow *github.Workflow) *tools.Workflow {
+	return &tools.Workflow{
+		ID:    workflow.GetID(),
+		Name:  workflow.GetName(),
+		Path:  workflow.GetPath(),
+		State: workflow.GetState(),
+		URL:   workflow.GetHTMLURL(),
+	}
+}
+
+func toCodeResult(result *github.CodeResult) *tools.CodeResult {
+	return &tools.CodeResult{
+		Name:       result.GetName(),
+		Path:       result.GetPath(),
+		Repository: result.GetRepository().GetFullName(),
+		URL:        result.GetHTMLURL(),
+	}
+}
+
+func toBranchRef(ref *github.Reference) *tools.Branch {
+	return &tools.Branch{
+		Name: strings.TrimPrefix(ref.GetRef(), "refs/heads/"),
+		SHA:  ref.GetObject().GetSHA(),
+	}
+}
+
+func labelNames(labels []*github.Label) []string {
+	var names []string
+	for _, label := range labels {
+		names = append(names, label.GetName())
+	}
+	return names
+}
+
+func userLogins(users []*github.User) []string {
+	var logins []string
+	for _, user := range users {
+		logins = append(logins, user.GetLogin())
+	}
+	return logins
+}
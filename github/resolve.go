@@ -0,0 +1,105 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mcp-server/apierror"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v63/github"
+)
+
+// The resolve helpers check that the entities a write refers to exist.
+// They run in dry-run mode, where the write itself is never sent.
+
+// isNotFound reports whether err is a 404 response
+func isNotFound(err error) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
+
+// resolveRepository checks that a repository exists
+func (c *GithubClient) resolveRepository(ctx context.Context, owner string, repo string) error {
+	if _, _, err := c.client.Repositories.Get(ctx, owner, repo); err != nil {
+		if isNotFound(err) {
+			return apierror.New("github", apierror.NotFound, fmt.Sprintf("repository %s/%s not found", owner, repo))
+		}
+		return wrapError(err)
+	}
+	return nil
+}
+
+// resolveBranch checks that a branch exists. The branch may be given as
+// "owner:branch" to refer to a fork, as the head of a pull request.
+func (c *GithubClient) resolveBranch(ctx context.Context, owner string, repo string, branch string) error {
+	if forkOwner, forkBranch, ok := strings.Cut(branch, ":"); ok {
+		owner, branch = forkOwner, forkBranch
+	}
+	if _, _, err := c.client.Repositories.GetBranch(ctx, owner, repo, branch, 0); err != nil {
+		if isNotFound(err) {
+			return apierror.New("github", apierror.NotFound, fmt.Sprintf("branch %s not found in %s/%s", branch, owner, repo))
+		}
+		return wrapError(err)
+	}
+	return nil
+}
+
+// resolveNewBranch checks that a branch does not exist yet and that the
+// commit it would point at does
+func (c *GithubClient) resolveNewBranch(ctx context.Context, owner string, repo string, branch string, sha string) error {
+	_, _, err := c.client.Repositories.GetBranch(ctx, owner, repo, branch, 0)
+	if err == nil {
+		return apierror.New("github", apierror.Conflict, fmt.Sprintf("branch %s already exists in %s/%s", branch, owner, repo))
+	}
+	if !isNotFound(err) {
+		return wrapError(err)
+	}
+	if _, _, err := c.client.Git.GetCommit(ctx, owner, repo, sha); err != nil {
+		if isNotFound(err) {
+			return apierror.New("github", apierror.NotFound, fmt.Sprintf("commit %s not found in %s/%s", sha, owner, repo))
+		}
+		return wrapError(err)
+	}
+	return nil
+}
+
+// resolveIssue checks that an issue or pull request exists
+func (c *GithubClient) resolveIssue(ctx context.Context, owner string, repo string, number int) error {
+	if _, _, err := c.client.Issues.Get(ctx, owner, repo, number); err != nil {
+		if isNotFound(err) {
+			return apierror.New("github", apierror.NotFound, fmt.Sprintf("issue %s/%s#%d not found", owner, repo, number))
+		}
+		return wrapError(err)
+	}
+	return nil
+}
+
+// resolveWorkflow checks that a workflow exists
+func (c *GithubClient) resolveWorkflow(ctx context.Context, owner string, repo string, workflowID string) error {
+	if _, _, err := c.client.Actions.GetWorkflowByFileName(ctx, owner, repo, workflowID); err != nil {
+		if isNotFound(err) {
+			return apierror.New("github", apierror.NotFound, fmt.Sprintf("workflow %s not found in %s/%s", workflowID, owner, repo))
+		}
+		return wrapError(err)
+	}
+	return nil
+}
+
+// resolveNewRepository checks that the authenticated user has no repository
+// with the given name yet
+func (c *GithubClient) resolveNewRepository(ctx context.Context, name string) error {
+	user, _, err := c.client.Users.Get(ctx, "")
+	if err != nil {
+		return wrapError(err)
+	}
+	_, _, err = c.client.Repositories.Get(ctx, user.GetLogin(), name)
+	if err == nil {
+		return apierror.New("github", apierror.Conflict, fmt.Sprintf("repository %s/%s already exists", user.GetLogin(), name))
+	}
+	if !isNotFound(err) {
+		return wrapError(err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Package idempotency remembers the entities created by tool calls under
+// the idempotency key of the call, so a call retried with the same key
+// returns the entity of the first one instead of creating another.
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mcp-server/logging"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// logger is the logger of the idempotency subsystem
+var logger = logging.For("idempotency")
+
+// Entry is the entity created by a call with an idempotency key
+type Entry struct {
+	Tool string `json:"tool"`
+	// Fingerprint identifies the arguments of the call, to detect a key
+	// reused for another call
+	Fingerprint string `json:"fingerprint"`
+	// Result is the created entity, as the JSON of its tools model
+	Result    json.RawMessage `json:"result"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// Store maps idempotency keys to the entities created under them for a
+// TTL. With a path, the entries are persisted to a JSON file rewritten on
+// every change, so they survive restarts.
+type Store struct {
+	path string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*Entry
+	// held are the keys of the calls in progress, closed when they end
+	held map[string]chan struct{}
+}
+
+// Open creates a Store whose entries expire after ttl, loading the entries
+// persisted at path. An empty path keeps the entries in memory.
+func Open(path string, ttl time.Duration) (*Store, error) {
+	s := &Store{path: path, ttl: ttl, entries: make(map[string]*Entry), held: make(map[string]chan struct{})}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		return nil, fmt.Errorf("invalid idempotency store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Acquire waits until no other call holds key, then holds it until the
+// returned release is called, so concurrent retries of a call do not both
+// create the entity
+func (s *Store) Acquire(ctx context.Context, key string) (func(), error) {
+	for {
+		s.mu.Lock()
+		held, ok := s.held[key]
+		if !ok {
+			done := make(chan struct{})
+			s.held[key] = done
+			s.mu.Unlock()
+			return func() {
+				s.mu.Lock()
+				delete(s.held, key)
+				s.mu.Unlock()
+				close(done)
+			}, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Get returns the live entry of key
+func (s *Store) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.ExpiresAt) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Put stores the entity created under key, dropping the expired entries
+func (s *Store) Put(key string, entry Entry) error {
+	now := time.Now()
+	entry.CreatedAt = now
+	entry.ExpiresAt = now.Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for other, existing := range s.entries {
+		if now.After(existing.ExpiresAt) {
+			delete(s.entries, other)
+		}
+	}
+	s.entries[key] = &entry
+	if s.path == "" {
+		return nil
+	}
+	return s.save()
+}
+
+// save writes the entries to a temporary file renamed over the store, so
+// a crash never leaves a partial file
+func (s *Store) save() error {
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	logger.Debug("Saved idempotency store", "path", s.path, "entries", len(s.entries))
+	return nil
+}
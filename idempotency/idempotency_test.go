@@ -0,0 +1,121 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireSerializesCalls(t *testing.T) {
+	s, err := Open("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var holders, maxHolders atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := s.Acquire(context.Background(), "alice/key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := holders.Add(1)
+			for {
+				if m := maxHolders.Load(); n <= m || maxHolders.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			holders.Add(-1)
+			release()
+		}()
+	}
+	wg.Wait()
+	if n := maxHolders.Load(); n != 1 {
+		t.Errorf("%d calls held the key at once, want 1", n)
+	}
+
+	// Other keys are not held up
+	release, err := s.Acquire(context.Background(), "alice/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	other, err := s.Acquire(context.Background(), "alice/other")
+	if err != nil {
+		t.Fatalf("Acquire() of another key error = %v", err)
+	}
+	other()
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	s, _ := Open("", time.Hour)
+	release, err := s.Acquire(context.Background(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() error = %v, want the context error while the key is held", err)
+	}
+}
+
+func TestEntriesExpire(t *testing.T) {
+	s, _ := Open("", 20*time.Millisecond)
+	if err := s.Put("old", Entry{Tool: "github_create_issue", Result: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get("old"); !ok {
+		t.Fatal("Get() found no entry right after Put")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := s.Get("old"); ok {
+		t.Error("Get() returned an expired entry")
+	}
+	// Expired entries are dropped on the next Put
+	s.Put("new", Entry{Tool: "github_create_issue", Result: json.RawMessage(`{}`)})
+	if _, ok := s.entries["old"]; ok || len(s.entries) != 1 {
+		t.Errorf("entries = %v, want the expired entry dropped", s.entries)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.json")
+	s, err := Open(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := Entry{Tool: "jira_create_ticket", Fingerprint: "abc", Result: json.RawMessage(`{"key":"PROJ-1"}`)}
+	if err := s.Put("alice/key", entry); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted server finds the entity created before
+	reopened, err := Open(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := reopened.Get("alice/key")
+	if !ok {
+		t.Fatal("Get() after reopening found no entry")
+	}
+	if got.Tool != entry.Tool || got.Fingerprint != entry.Fingerprint || string(got.Result) != string(entry.Result) {
+		t.Errorf("entry = %+v, want %+v", got, entry)
+	}
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
@@ -2,12 +2,18 @@ package jira
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mcp-server/apierror"
+	"mcp-server/dryrun"
+	"mcp-server/ratelimit"
 	"mcp-server/tools"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -17,27 +23,27 @@ type JiraClient struct {
 	baseURL    string
 	username   string
 	token      string
+	deployment string
 	httpClient *http.Client
 }
 
+// Supported Jira deployment types
+const (
+	// DeploymentCloud is Jira Cloud: Basic auth with email + API token, REST API v3 and ADF descriptions
+	DeploymentCloud = "cloud"
+	// DeploymentServer is Jira Server/Data Center: Bearer PAT auth, REST API v2 and wiki markup descriptions
+	DeploymentServer = "server"
+)
+
 // JiraIssue represents a Jira issue response
 type JiraIssue struct {
 	ID     string `json:"id"`
 	Key    string `json:"key"`
 	Fields struct {
-		Summary     string `json:"summary"`
-		Description struct {
-			Type    string `json:"type"`
-			Version int    `json:"version"`
-			Content []struct {
-				Type    string `json:"type"`
-				Content []struct {
-					Type string `json:"type"`
-					Text string `json:"text"`
-				} `json:"content,omitempty"`
-			} `json:"content"`
-		} `json:"description"`
-		Status struct {
+		Summary string `json:"summary"`
+		// Description is an ADF document on Jira Cloud and a wiki markup string on Jira Server
+		Description json.RawMessage `json:"description"`
+		Status      struct {
 			Name string `json:"name"`
 		} `json:"status"`
 		Assignee *JiraUser `json:"assignee"`
@@ -57,35 +63,61 @@ type JiraSearchResponse struct {
 	Total  int         `json:"total"`
 }
 
+// JiraErrorResponse represents the body of a failed Jira API request
+type JiraErrorResponse struct {
+	ErrorMessages []string          `json:"errorMessages"`
+	Errors        map[string]string `json:"errors"`
+}
+
 // JiraCreateIssueRequest represents a request to create a Jira issue
 type JiraCreateIssueRequest struct {
 	Fields struct {
 		Project struct {
 			Key string `json:"key"`
 		} `json:"project"`
-		Summary     string `json:"summary"`
-		Description struct {
-			Type    string `json:"type"`
-			Version int    `json:"version"`
-			Content []struct {
-				Type    string `json:"type"`
-				Content []struct {
-					Type string `json:"type"`
-					Text string `json:"text"`
-				} `json:"content"`
-			} `json:"content"`
-		} `json:"description"`
-		IssueType struct {
+		Summary string `json:"summary"`
+		// Description is an *ADFDocument on Jira Cloud and a wiki markup string on Jira Server
+		Description interface{} `json:"description,omitempty"`
+		IssueType   struct {
 			Name string `json:"name"`
 		} `json:"issuetype"`
 	} `json:"fields"`
 }
 
+// ADFDocument represents a document in the Atlassian Document Format
+type ADFDocument struct {
+	Type    string    `json:"type"`
+	Version int       `json:"version"`
+	Content []ADFNode `json:"content"`
+}
+
+// ADFNode represents a block or inline node of an ADF document
+type ADFNode struct {
+	Type    string    `json:"type"`
+	Text    string    `json:"text,omitempty"`
+	Content []ADFNode `json:"content,omitempty"`
+}
+
 // NewJiraClient creates a new JiraClient
-// It takes a jira url, username and token as arguments and returns a new JiraClient
-// The token is used to authenticate with the Jira API
-func NewJiraClient(jiraURL, username, token string) (*JiraClient, error) {
-	if username == "" {
+// It takes the HTTP client requests are sent with (nil for a default one with a 30s timeout),
+// a jira url, username, token and deployment type as arguments and returns a new JiraClient
+// The token is used to authenticate with the Jira API: as an API token together with the
+// username on Jira Cloud, and as a personal access token on Jira Server/Data Center.
+// An empty deployment defaults to DeploymentCloud.
+func NewJiraClient(httpClient *http.Client, jiraURL, username, token, deployment string) (*JiraClient, error) {
+	switch deployment {
+	case "":
+		deployment = DeploymentCloud
+	case DeploymentCloud, DeploymentServer:
+	case "datacenter", "data_center":
+		deployment = DeploymentServer
+	default:
+		return nil, fmt.Errorf("unknown Jira deployment type %q (expected %q or %q)", deployment, DeploymentCloud, DeploymentServer)
+	}
+	if jiraURL == "" {
+		return nil, fmt.Errorf("URL is required for Jira")
+	}
+	if deployment == DeploymentCloud && username == "" {
 		return nil, fmt.Errorf("username/email is required for Jira authentication")
 	}
 	if token == "" {
@@ -97,85 +129,175 @@ func NewJiraClient(jiraURL, username, token string) (*JiraClient, error) {
 		jiraURL += "/"
 	}
 
-	return &JiraClient{
-		baseURL:  jiraURL,
-		username: username,
-		token:    token,
-		httpClient: &http.Client{
+	if httpClient == nil {
+		httpClient = &http.Client{
 			Timeout: 30 * time.Second,
-		},
+		}
+	}
+
+	return &JiraClient{
+		baseURL:    jiraURL,
+		username:   username,
+		token:      token,
+		deployment: deployment,
+		httpClient: httpClient,
 	}, nil
 }
 
 // makeRequest makes an authenticated HTTP request to the Jira API
-func (c *JiraClient) makeRequest(method, endpoint string, body []byte) (*http.Response, error) {
-	url := c.baseURL + "rest/api/3/" + endpoint
+func (c *JiraClient) makeRequest(ctx context.Context, method, endpoint string, body []byte) (*http.Response, error) {
+	url := c.baseURL + c.apiPath() + endpoint
 
 	var reqBody io.Reader
 	if body != nil {
 		reqBody = bytes.NewBuffer(body)
 	}
 
-	req, err := http.NewRequest(method, url, reqBody)
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Set up Basic Authentication
-	auth := base64.StdEncoding.EncodeToString([]byte(c.username + ":" + c.token))
-	req.Header.Set("Authorization", "Basic "+auth)
+	if c.deployment == DeploymentServer {
+		// Jira Server/Data Center personal access token
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else {
+		// Jira Cloud Basic Authentication with email + API token
+		auth := base64.StdEncoding.EncodeToString([]byte(c.username + ":" + c.token))
+		req.Header.Set("Authorization", "Basic "+auth)
+	}
 	req.Header.Set("Accept", "application/json")
 	if method == "POST" || method == "PUT" {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if endpoint == "search" {
+		// Searches are sent as POST but are read-only, so they are safe to
+		// retry and to send in dry-run mode
+		req = dryrun.Allow(ratelimit.MarkIdempotent(req))
+	}
 
 	return c.httpClient.Do(req)
 }
 
+// responseError classifies a failed response, described by action and the
+// error messages of its body
+func (c *JiraClient) responseError(response *http.Response, action string) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+
+	var details []string
+	var errResp JiraErrorResponse
+	if json.Unmarshal(body, &errResp) == nil {
+		details = append(details, errResp.ErrorMessages...)
+		fields := make([]string, 0, len(errResp.Errors))
+		for field := range errResp.Errors {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			details = append(details, field+": "+errResp.Errors[field])
+		}
+	}
+	if len(details) == 0 {
+		// Proxies and outages answer with HTML pages, not worth returning
+		details = append(details, http.StatusText(response.StatusCode))
+	}
+
+	e := apierror.FromResponse("jira", response, action+": "+strings.Join(details, "; "))
+	if e.Category == apierror.Unauthorized {
+		if c.deployment == DeploymentServer {
+			e.Remediation = "Check the Jira personal access token"
+		} else {
+			e.Remediation = "Check the Jira email and API token; Jira Cloud does not accept account passwords"
+		}
+	}
+	return e
+}
+
+// apiPath returns the REST API path for the deployment type
+func (c *JiraClient) apiPath() string {
+	if c.deployment == DeploymentServer {
+		return "rest/api/2/"
+	}
+	return "rest/api/3/"
+}
+
+// descriptionText converts an issue description to plain text.
+// Jira Cloud returns an ADF document, Jira Server a wiki markup string.
+func (c *JiraClient) descriptionText(description json.RawMessage) string {
+	if len(description) == 0 || string(description) == "null" {
+		return ""
+	}
+	if c.deployment == DeploymentServer {
+		var text string
+		if err := json.Unmarshal(description, &text); err != nil {
+			return ""
+		}
+		return text
+	}
+
+	var document ADFDocument
+	if err := json.Unmarshal(description, &document); err != nil {
+		return ""
+	}
+	return extractDescriptionText(document)
+}
+
+// descriptionField converts a plain text description to the field value
+// expected by the deployment type
+func (c *JiraClient) descriptionField(description string) interface{} {
+	if c.deployment == DeploymentServer {
+		return description
+	}
+
+	// Set up description in the Atlassian Document Format
+	document := &ADFDocument{Type: "doc", Version: 1, Content: []ADFNode{}}
+	if description != "" {
+		document.Content = append(document.Content, ADFNode{
+			Type:    "paragraph",
+			Content: []ADFNode{{Type: "text", Text: description}},
+		})
+	}
+	return document
+}
+
 // GetTicketByID gets a ticket by its ID
 // It takes a ticketID as an argument
-// It returns a string representation of the ticket and an error if any
-func (c *JiraClient) GetTicketByID(ticketID string) (string, error) {
+// It returns the ticket and an error if any
+func (c *JiraClient) GetTicketByID(ctx context.Context, ticketID string) (*tools.JiraIssue, error) {
 	if ticketID == "" {
-		return "", fmt.Errorf("ticket ID cannot be empty")
+		return nil, apierror.Invalid("jira", "ticket ID cannot be empty")
 	}
 
-	response, err := c.makeRequest("GET", "issue/"+ticketID, nil)
+	response, err := c.makeRequest(ctx, "GET", "issue/"+ticketID, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request for ticket %s: %w", ticketID, err)
+		return nil, apierror.Wrap("jira", fmt.Errorf("failed to make request for ticket %s: %w", ticketID, err))
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(response.Body)
-		return "", fmt.Errorf("failed to get ticket %s (HTTP %d): %s", ticketID, response.StatusCode, string(body))
+		return nil, c.responseError(response, fmt.Sprintf("failed to get ticket %s", ticketID))
 	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var issue JiraIssue
 	if err := json.Unmarshal(body, &issue); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	result := c.toIssue(issue)
 	// Extract description text from the content structure
-	description := extractDescriptionText(issue.Fields.Description)
-
-	return fmt.Sprintf("ID: %s\nSummary: %s\nStatus: %s\nAssignee: %s\nDescription: %s\n",
-		issue.Key,
-		issue.Fields.Summary,
-		issue.Fields.Status.Name,
-		getAssigneeName(issue.Fields.Assignee),
-		description), nil
+	result.Description = c.descriptionText(issue.Fields.Description)
+	return result, nil
 }
 
 // SearchTickets searches for tickets using JQL
-func (c *JiraClient) SearchTickets(jql string) (string, error) {
+func (c *JiraClient) SearchTickets(ctx context.Context, jql string) ([]tools.JiraIssue, error) {
 	if jql == "" {
-		return "", fmt.Errorf("JQL query cannot be empty")
+		return nil, apierror.Invalid("jira", "JQL query cannot be empty")
 	}
 
 	searchRequest := map[string]interface{}{
@@ -186,52 +308,48 @@ func (c *JiraClient) SearchTickets(jql string) (string, error) {
 
 	requestBody, err := json.Marshal(searchRequest)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal search request: %w", err)
+		return nil, fmt.Errorf("failed to marshal search request: %w", err)
 	}
 
-	response, err := c.makeRequest("POST", "search", requestBody)
+	response, err := c.makeRequest(ctx, "POST", "search", requestBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to make search request: %w", err)
+		return nil, apierror.Wrap("jira", fmt.Errorf("failed to make search request: %w", err))
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(response.Body)
-		return "", fmt.Errorf("failed to search tickets with JQL '%s' (HTTP %d): %s", jql, response.StatusCode, string(body))
+		return nil, c.responseError(response, fmt.Sprintf("failed to search tickets with JQL '%s'", jql))
 	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var searchResponse JiraSearchResponse
 	if err := json.Unmarshal(body, &searchResponse); err != nil {
-		return "", fmt.Errorf("failed to parse search response: %w", err)
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
 	}
 
-	if len(searchResponse.Issues) == 0 {
-		return "No tickets found matching the query.", nil
-	}
-
-	var result string
+	result := make([]tools.JiraIssue, 0, len(searchResponse.Issues))
 	for _, issue := range searchResponse.Issues {
-		result += fmt.Sprintf("Key: %s\nSummary: %s\nStatus: %s\nAssignee: %s\n\n",
-			issue.Key,
-			issue.Fields.Summary,
-			issue.Fields.Status.Name,
-			getAssigneeName(issue.Fields.Assignee))
+		result = append(result, *c.toIssue(issue))
 	}
 	return result, nil
 }
 
 // CreateTicket creates a new ticket
-func (c *JiraClient) CreateTicket(projectKey string, summary string, description string) (string, error) {
+func (c *JiraClient) CreateTicket(ctx context.Context, projectKey string, summary string, description string) (*tools.JiraIssue, error) {
 	if projectKey == "" {
-		return "", fmt.Errorf("project key cannot be empty")
+		return nil, apierror.Invalid("jira", "project key cannot be empty")
 	}
 	if summary == "" {
-		return "", fmt.Errorf("summary cannot be empty")
+		return nil, apierror.Invalid("jira", "summary cannot be empty")
+	}
+	if dryrun.Enabled(ctx) {
+		if err := c.resolveProject(ctx, projectKey); err != nil {
+			return nil, err
+		}
 	}
 
 	createRequest := JiraCreateIssueRequest{}
@@ -239,61 +357,93 @@ func (c *JiraClient) CreateTicket(projectKey string, summary string, description
 	createRequest.Fields.Summary = summary
 	createRequest.Fields.IssueType.Name = "Task"
 
-	// Set up description in the Atlassian Document Format
-	createRequest.Fields.Description.Type = "doc"
-	createRequest.Fields.Description.Version = 1
-	if description != "" {
-		createRequest.Fields.Description.Content = []struct {
-			Type    string `json:"type"`
-			Content []struct {
-				Type string `json:"type"`
-				Text string `json:"text"`
-			} `json:"content"`
-		}{
-			{
-				Type: "paragraph",
-				Content: []struct {
-					Type string `json:"type"`
-					Text string `json:"text"`
-				}{
-					{
-						Type: "text",
-						Text: description,
-					},
-				},
-			},
-		}
-	}
+	createRequest.Fields.Description = c.descriptionField(description)
 
 	requestBody, err := json.Marshal(createRequest)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal create request: %w", err)
+		return nil, fmt.Errorf("failed to marshal create request: %w", err)
 	}
 
-	response, err := c.makeRequest("POST", "issue", requestBody)
+	response, err := c.makeRequest(ctx, "POST", "issue", requestBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to make create request: %w", err)
+		return nil, apierror.Wrap("jira", fmt.Errorf("failed to make create request: %w", err))
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(response.Body)
-		return "", fmt.Errorf("failed to create ticket (HTTP %d): %s", response.StatusCode, string(body))
+		return nil, c.responseError(response, "failed to create ticket")
 	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var createdIssue struct {
 		Key string `json:"key"`
 	}
 	if err := json.Unmarshal(body, &createdIssue); err != nil {
-		return "", fmt.Errorf("failed to parse create response: %w", err)
+		return nil, fmt.Errorf("failed to parse create response: %w", err)
+	}
+
+	return &tools.JiraIssue{
+		Key:     createdIssue.Key,
+		Summary: summary,
+		URL:     c.browseURL(createdIssue.Key),
+	}, nil
+}
+
+// DeleteTicket deletes a ticket
+func (c *JiraClient) DeleteTicket(ctx context.Context, ticketID string) error {
+	if ticketID == "" {
+		return apierror.Invalid("jira", "ticket ID cannot be empty")
+	}
+
+	response, err := c.makeRequest(ctx, "DELETE", "issue/"+ticketID, nil)
+	if err != nil {
+		return apierror.Wrap("jira", fmt.Errorf("failed to make delete request for ticket %s: %w", ticketID, err))
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		return c.responseError(response, fmt.Sprintf("failed to delete ticket %s", ticketID))
+	}
+	return nil
+}
+
+// resolveProject checks that a project exists. It runs in dry-run mode,
+// where the ticket is never created.
+func (c *JiraClient) resolveProject(ctx context.Context, projectKey string) error {
+	response, err := c.makeRequest(ctx, "GET", "project/"+projectKey, nil)
+	if err != nil {
+		return apierror.Wrap("jira", fmt.Errorf("failed to make project request: %w", err))
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return apierror.New("jira", apierror.NotFound, fmt.Sprintf("project %s not found", projectKey))
+	default:
+		return c.responseError(response, fmt.Sprintf("failed to get project %s", projectKey))
 	}
+}
+
+// toIssue converts a Jira issue response to the tool model, without its description
+func (c *JiraClient) toIssue(issue JiraIssue) *tools.JiraIssue {
+	return &tools.JiraIssue{
+		Key:      issue.Key,
+		Summary:  issue.Fields.Summary,
+		Status:   issue.Fields.Status.Name,
+		Assignee: getAssigneeName(issue.Fields.Assignee),
+		URL:      c.browseURL(issue.Key),
+	}
+}
 
-	return fmt.Sprintf("Created ticket: %s - %s", createdIssue.Key, summary), nil
+// browseURL returns the web URL of an issue
+func (c *JiraClient) browseURL(key string) string {
+	return c.baseURL + "browse/" + key
 }
 
 // Helper function to safely get assignee name
@@ -308,17 +458,7 @@ func getAssigneeName(assignee *JiraUser) string {
 }
 
 // extractDescriptionText extracts plain text from Jira's Atlassian Document Format
-func extractDescriptionText(description struct {
-	Type    string `json:"type"`
-	Version int    `json:"version"`
-	Content []struct {
-		Type    string `json:"type"`
-		Content []struct {
-			Type string `json:"type"`
-			Text string `json:"text"`
-		} `json:"content,omitempty"`
-	} `json:"content"`
-}) string {
+func extractDescriptionText(description ADFDocument) string {
 	var text string
 	for _, content := range description.Content {
 		if content.Type == "paragraph" {
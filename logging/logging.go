@@ -0,0 +1,287 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Output formats
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// Options configures the loggers
+type Options struct {
+	// Format is FormatLogfmt (default) or FormatJSON
+	Format string
+	// Level is the minimum level of the subsystems without a level of their own
+	Level slog.Level
+	// Levels are the minimum levels per subsystem, e.g. "github" or "server"
+	Levels map[string]slog.Level
+	// Secrets are values masked wherever they appear in a log record
+	Secrets []string
+	// Output defaults to stderr, stdout being the stdio transport
+	Output io.Writer
+}
+
+// settings is the configured state the subsystem loggers resolve on every record
+type settings struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+}
+
+var current atomic.Pointer[settings]
+
+func init() {
+	current.Store(&settings{handler: newRedactor(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))})
+}
+
+// Configure sets the format, levels and secrets of every logger, including
+// those created before, and routes the standard log package through them
+func Configure(opts Options) error {
+	output := opts.Output
+	if output == nil {
+		output = os.Stderr
+	}
+	// Levels are checked per subsystem, the handler takes everything
+	handlerOptions := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var handler slog.Handler
+	switch opts.Format {
+	case "", FormatLogfmt:
+		handler = slog.NewTextHandler(output, handlerOptions)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(output, handlerOptions)
+	default:
+		return fmt.Errorf("unknown log format %q (expected %s or %s)", opts.Format, FormatLogfmt, FormatJSON)
+	}
+
+	redactor := newRedactor(handler)
+	for _, secret := range opts.Secrets {
+		redactor.secrets.add(secret)
+	}
+	current.Store(&settings{handler: redactor, level: opts.Level, levels: opts.Levels})
+
+	slog.SetDefault(For("main"))
+	log.SetFlags(0)
+	return nil
+}
+
+// AddSecret masks a value obtained at runtime, e.g. a token sent by a client
+func AddSecret(secret string) {
+	if r, ok := current.Load().handler.(*redactor); ok {
+		r.secrets.addRuntime(secret)
+	}
+}
+
+// RemoveSecret stops masking a value added with AddSecret, e.g. once no
+// session uses the token anymore. Configured secrets are always masked.
+func RemoveSecret(secret string) {
+	if r, ok := current.Load().handler.(*redactor); ok {
+		r.secrets.remove(secret)
+	}
+}
+
+// Mask masks the configured secrets and the detected credentials of a
+// text, as they are masked in the logs
+func Mask(text string) string {
+	text, _ = Redact(text)
+	return text
+}
+
+// Redact masks the configured secrets and the detected credentials of a
+// text: GitHub tokens, AWS keys, JWTs, private key blocks and inline
+// credentials. It returns the masked text and the values masked per kind.
+func Redact(text string) (string, []Redaction) {
+	if r, ok := current.Load().handler.(*redactor); ok {
+		return r.redact(text)
+	}
+	return text, nil
+}
+
+// ParseLevel parses a level name: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// For returns the logger of a subsystem. It can be created before
+// Configure, e.g. in a package variable.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{subsystem: subsystem})
+}
+
+// subsystemHandler filters records on the level of its subsystem and hands
+// them to the configured handler with the subsystem and context attributes
+type subsystemHandler struct {
+	subsystem string
+	// ops are the WithAttrs and WithGroup calls, replayed on the configured handler
+	ops []func(slog.Handler) slog.Handler
+}
+
+// Enabled implements slog.Handler
+func (h *subsystemHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	s := current.Load()
+	minimum, ok := s.levels[h.subsystem]
+	if !ok {
+		minimum = s.level
+	}
+	return level >= minimum
+}
+
+// Handle implements slog.Handler
+func (h *subsystemHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler := current.Load().handler.WithAttrs([]slog.Attr{slog.String("subsystem", h.subsystem)})
+	if attrs := attrsFrom(ctx); len(attrs) > 0 {
+		handler = handler.WithAttrs(attrs)
+	}
+	for _, op := range h.ops {
+		handler = op(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+// WithGroup implements slog.Handler
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *subsystemHandler) with(op func(slog.Handler) slog.Handler) slog.Handler {
+	ops := append(append([]func(slog.Handler) slog.Handler(nil), h.ops...), op)
+	return &subsystemHandler{subsystem: h.subsystem, ops: ops}
+}
+
+type attrsKey struct{}
+
+// WithAttrs returns a copy of ctx whose log records carry the attributes,
+// e.g. the request ID and tool name of a call
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+	attrs := append([]slog.Attr(nil), attrsFrom(ctx)...)
+	// A record parses the key-value pairs the same way as the loggers
+	var record slog.Record
+	record.Add(args...)
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// attrsFrom returns the attributes carried by ctx
+func attrsFrom(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random ID correlating the records of a request
+func NewRequestID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// WithRequestID returns a copy of ctx carrying a request ID, logged with
+// every record of the request and sent to the upstream backends
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return WithAttrs(ctx, "request_id", id)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// secretSet holds the values to mask
+type secretSet struct {
+	mu     sync.RWMutex
+	values []string
+	// runtime are the values added at runtime, which can be removed
+	runtime map[string]bool
+}
+
+// add registers a configured secret. Short values are ignored, they would
+// mask unrelated text.
+func (s *secretSet) add(secret string) {
+	s.register(secret, false)
+}
+
+// addRuntime registers a secret obtained at runtime
+func (s *secretSet) addRuntime(secret string) {
+	s.register(secret, true)
+}
+
+func (s *secretSet) register(secret string, runtime bool) {
+	secret = strings.TrimSpace(secret)
+	if len(secret) < 8 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, value := range s.values {
+		if value == secret {
+			// A configured secret stays masked
+			if !runtime {
+				delete(s.runtime, secret)
+			}
+			return
+		}
+	}
+	s.values = append(s.values, secret)
+	if runtime {
+		if s.runtime == nil {
+			s.runtime = make(map[string]bool)
+		}
+		s.runtime[secret] = true
+	}
+}
+
+// remove unregisters a secret added at runtime
+func (s *secretSet) remove(secret string) {
+	secret = strings.TrimSpace(secret)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.runtime[secret] {
+		return
+	}
+	delete(s.runtime, secret)
+	for i, value := range s.values {
+		if value == secret {
+			s.values = append(s.values[:i], s.values[i+1:]...)
+			return
+		}
+	}
+}
+
+// mask replaces the secrets in text, returning how many were replaced
+func (s *secretSet) mask(text string) (string, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	masked := 0
+	for _, value := range s.values {
+		if n := strings.Count(text, value); n > 0 {
+			text = strings.ReplaceAll(text, value, Redacted)
+			masked += n
+		}
+	}
+	return text, masked
+}
@@ -0,0 +1,239 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces masked values
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are parts of the attribute keys whose values are always masked
+var sensitiveKeys = []string{"token", "password", "secret", "authorization", "credential", "private_key", "apikey", "api_key"}
+
+// Kinds of masked values
+const (
+	KindConfigured = "configured_secret"
+	KindInline     = "inline_credential"
+	KindGithub     = "github_token"
+	KindAWS        = "aws_key"
+	KindJWT        = "jwt"
+	KindPrivateKey = "private_key"
+)
+
+// detector finds the values of a kind of credential. replace is the
+// replacement template, keeping the text around the value. accept, when
+// set, checks the value, the last submatch of the pattern, and the match
+// is kept as it is when the value is rejected.
+type detector struct {
+	kind    string
+	pattern *regexp.Regexp
+	replace string
+	accept  func(value string) bool
+}
+
+// detectors find the credentials of well-known formats, in this order
+var detectors = []detector{
+	// A private key block cut short, e.g. by truncation, is masked to the end
+	{KindPrivateKey, regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY( BLOCK)?-----(?s:.*?)(-----END [A-Z ]*PRIVATE KEY( BLOCK)?-----|$)`), Redacted, nil},
+	// Classic, OAuth, user-to-server, server-to-server and refresh tokens,
+	// and fine-grained personal access tokens
+	{KindGithub, regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,251}|github_pat_[A-Za-z0-9_]{22,255})\b`), Redacted, nil},
+	{KindAWS, regexp.MustCompile(`\b(AKIA|ASIA|ABIA|ACCA)[A-Z0-9]{16}\b`), Redacted, nil},
+	{KindAWS, regexp.MustCompile(`(?i)(aws_?secret_?access_?key["']?\s*[:=]\s*["']?)[A-Za-z0-9/+=]{40,}`), "${1}" + Redacted, nil},
+	{KindJWT, regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`), Redacted, nil},
+	// An Authorization header value, with or without its scheme
+	{KindInline, regexp.MustCompile(`(?i)(\bauthorization["']?\s*[:=]\s*["']?(?:(?:bearer|basic|token)\s+)?)([A-Za-z0-9._~+/=-]{8,})`), "${1}" + Redacted, isCredential},
+	// A token, secret, password or API key query parameter or assignment,
+	// e.g. access_token=… or "client_secret": "…"
+	{KindInline, regexp.MustCompile(`(?i)(\b[a-z_-]*(?:token|secret|password|api[_-]?key)(?:\s*=\s*["']?|["']\s*:\s*["']))([A-Za-z0-9._~+/=-]{8,})`), "${1}" + Redacted, isCredential},
+	// A credential after its scheme elsewhere in the text. Prose such as
+	// "token expiration" or "Basic authentication" uses the same words, so
+	// only values that look random are masked.
+	{KindInline, regexp.MustCompile(`(?i)(\b(?:bearer|basic|token)\s+)([A-Za-z0-9._~+/=-]{20,})`), "${1}" + Redacted, isRandom},
+}
+
+// isCredential reports whether a value given as a credential is not a
+// plain word: it has a digit, a symbol or mixed case after its first letter
+func isCredential(value string) bool {
+	classes := characterClasses(value[1:])
+	return classes.digit || classes.symbol || (classes.lower && classes.upper)
+}
+
+// isRandom reports whether a value looks like a generated credential
+// rather than a word: 20 or more characters of three classes, one being digits
+func isRandom(value string) bool {
+	classes := characterClasses(value)
+	n := 0
+	for _, has := range []bool{classes.lower, classes.upper, classes.digit, classes.symbol} {
+		if has {
+			n++
+		}
+	}
+	return len(value) >= 20 && classes.digit && n >= 3
+}
+
+// charClasses are the character classes found in a value
+type charClasses struct {
+	lower, upper, digit, symbol bool
+}
+
+func characterClasses(value string) charClasses {
+	var c charClasses
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z':
+			c.lower = true
+		case r >= 'A' && r <= 'Z':
+			c.upper = true
+		case r >= '0' && r <= '9':
+			c.digit = true
+		default:
+			c.symbol = true
+		}
+	}
+	return c
+}
+
+// replaceAll masks the values the detector finds in text, returning the
+// masked text and how many values were masked
+func (d detector) replaceAll(text string) (string, int) {
+	matches := d.pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, 0
+	}
+	var b strings.Builder
+	last, n := 0, 0
+	for _, m := range matches {
+		if d.accept != nil && !d.accept(text[m[len(m)-2]:m[len(m)-1]]) {
+			continue
+		}
+		b.WriteString(text[last:m[0]])
+		b.Write(d.pattern.ExpandString(nil, d.replace, text, m))
+		last = m[1]
+		n++
+	}
+	if n == 0 {
+		return text, 0
+	}
+	b.WriteString(text[last:])
+	return b.String(), n
+}
+
+// Redaction is the number of values of a kind masked in a text
+type Redaction struct {
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+}
+
+// redactor is a slog.Handler masking secrets in the message and attributes
+// of the records before handing them on
+type redactor struct {
+	next    slog.Handler
+	secrets *secretSet
+}
+
+func newRedactor(next slog.Handler) *redactor {
+	return &redactor{next: next, secrets: &secretSet{}}
+}
+
+// Enabled implements slog.Handler
+func (r *redactor) Enabled(ctx context.Context, level slog.Level) bool {
+	return r.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (r *redactor) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, r.maskText(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(r.mask(attr))
+		return true
+	})
+	return r.next.Handle(ctx, redacted)
+}
+
+// WithAttrs implements slog.Handler
+func (r *redactor) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		masked[i] = r.mask(attr)
+	}
+	return &redactor{next: r.next.WithAttrs(masked), secrets: r.secrets}
+}
+
+// WithGroup implements slog.Handler
+func (r *redactor) WithGroup(name string) slog.Handler {
+	return &redactor{next: r.next.WithGroup(name), secrets: r.secrets}
+}
+
+// mask masks an attribute: entirely under a sensitive key, otherwise the
+// secrets found in its text
+func (r *redactor) mask(attr slog.Attr) slog.Attr {
+	if isSensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, r.maskText(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		masked := make([]any, len(group))
+		for i, member := range group {
+			masked[i] = r.mask(member)
+		}
+		return slog.Group(attr.Key, masked...)
+	case slog.KindAny:
+		// Errors and other values are logged through their text
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, r.maskText(err.Error()))
+		}
+	}
+	return attr
+}
+
+// maskText masks the configured secrets and the detected credentials of a text
+func (r *redactor) maskText(text string) string {
+	text, _ = r.redact(text)
+	return text
+}
+
+// redact masks the configured secrets and the detected credentials of a
+// text, counting the values masked per kind
+func (r *redactor) redact(text string) (string, []Redaction) {
+	var redactions []Redaction
+	count := func(kind string, n int) {
+		if n == 0 {
+			return
+		}
+		for i := range redactions {
+			if redactions[i].Kind == kind {
+				redactions[i].Count += n
+				return
+			}
+		}
+		redactions = append(redactions, Redaction{Kind: kind, Count: n})
+	}
+
+	text, n := r.secrets.mask(text)
+	count(KindConfigured, n)
+	for _, d := range detectors {
+		var n int
+		text, n = d.replaceAll(text)
+		count(d.kind, n)
+	}
+	return text, redactions
+}
+
+// isSensitive reports whether an attribute key names a credential
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Transport is an http.RoundTripper logging the requests sent to an
+// upstream backend, and forwarding the request ID in X-Request-ID
+type Transport struct {
+	logger *slog.Logger
+	base   http.RoundTripper
+}
+
+// NewTransport creates a new Transport logging with the logger of a service
+func NewTransport(logger *slog.Logger, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{logger: logger, base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if id := RequestID(ctx); id != "" {
+		req = req.Clone(ctx)
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	started := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	// The query is left out, it may carry search terms
+	attrs := []any{
+		"method", req.Method,
+		"host", req.URL.Host,
+		"path", req.URL.Path,
+		"duration_ms", time.Since(started).Milliseconds(),
+	}
+	switch {
+	case err != nil:
+		t.logger.WarnContext(ctx, "Upstream request failed", append(attrs, "error", err)...)
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		t.logger.WarnContext(ctx, "Upstream request", append(attrs, "status", resp.StatusCode)...)
+	default:
+		t.logger.DebugContext(ctx, "Upstream request", append(attrs, "status", resp.StatusCode)...)
+	}
+	return resp, err
+}
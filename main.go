@@ -1,31 +1,363 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mcp-server/audit"
+	"mcp-server/auth"
+	"mcp-server/budget"
 	"mcp-server/config"
 	"mcp-server/github"
+	"mcp-server/idempotency"
 	"mcp-server/jira"
+	"mcp-server/logging"
+	"mcp-server/metrics"
 	"mcp-server/notion"
+	"mcp-server/policy"
+	"mcp-server/render"
 	"mcp-server/server"
+	"mcp-server/tools"
+	"mcp-server/tracing"
+	"mcp-server/undo"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// logger is the logger of the main subsystem
+var logger = logging.For("main")
+
 func main() {
 	cfg, err := config.LoadConfig("config.yml")
 	if err != nil {
-		log.Fatalf("Error loading config: %v", err)
+		fatal("Error loading config", "error", err)
+	}
+	if err := configureLogging(cfg); err != nil {
+		fatal("Error configuring logging", "error", err)
 	}
 
-	githubClient := github.NewGithubClient(cfg.GithubToken)
-	jiraClient, err := jira.NewJiraClient(cfg.JiraURL, cfg.JiraUsername, cfg.JiraToken)
-	if err != nil {
-		log.Fatalf("Error creating Jira client: %v", err)
+	up := newUpstreams(cfg)
+	var registry *metrics.Registry
+	if cfg.Metrics.Enabled {
+		registry = metrics.NewRegistry()
+		up.instrument(registry)
+	}
+	if cfg.Tracing.Enabled {
+		exporter := tracing.NewExporter(cfg.Tracing.Endpoint, cfg.Tracing.Headers, cfg.Tracing.ServiceName)
+		defer exporter.Shutdown(context.Background())
+		up.tracer = tracing.NewTracer(exporter, cfg.Tracing.SampleRatio)
+	}
+	githubAccounts := server.NewAccounts[tools.GithubTool]("github")
+	for _, account := range cfg.AllGithubAccounts() {
+		httpClient := up.httpClient("github", account.Name)
+		githubClient, err := newGithubClient(httpClient, account)
+		if err != nil {
+			fatal("Error creating Github client", "account", account.Name, "error", err)
+		}
+		githubAccounts.Add(account.Name, githubClient, account.Owners...)
+	}
+
+	jiraAccounts := server.NewAccounts[tools.JiraTool]("jira")
+	for _, account := range cfg.AllJiraAccounts() {
+		httpClient := up.httpClient("jira", account.Name)
+		jiraClient, err := jira.NewJiraClient(httpClient, account.URL, account.Username, account.Token, account.Deployment)
+		if err != nil {
+			fatal("Error creating Jira client", "account", account.Name, "error", err)
+		}
+		jiraAccounts.Add(account.Name, jiraClient, account.Projects...)
+	}
+
+	notionAccounts := server.NewAccounts[tools.NotionTool]("notion")
+	for _, account := range cfg.AllNotionAccounts() {
+		httpClient := up.httpClient("notion", account.Name)
+		notionAccounts.Add(account.Name, notion.NewNotionClient(httpClient, account.Token))
 	}
-	notionClient := notion.NewNotionClient(cfg.NotionToken)
-	log.Println("Starting MCP server...")
+
 	srv := &server.MCPServer{
-		Github: githubClient,
-		Jira:   jiraClient,
-		Notion: notionClient,
+		Clients: server.Clients{
+			Github: githubAccounts,
+			Jira:   jiraAccounts,
+			Notion: notionAccounts,
+		},
+		RateLimits:   up.rateLimits,
+		OutputFormat: cfg.OutputFormat,
+		Templates:    render.LoadTemplates(cfg.Templates),
+		Tracer:       up.tracer,
+		DryRun:       cfg.DryRun,
+		ToolTimeouts: cfg.ToolTimeouts,
+	}
+	if err := render.CheckFormat(cfg.OutputFormat); err != nil {
+		fatal("Invalid output_format", "error", err)
+	}
+	if len(cfg.Middleware) > 0 {
+		if err := server.CheckMiddleware(cfg.Middleware); err != nil {
+			fatal("Invalid middleware", "error", err)
+		}
+		srv.MiddlewareOrder = cfg.Middleware
+	}
+	if cfg.Policy.IsSet() {
+		p, err := newPolicy(cfg.Policy)
+		if err != nil {
+			fatal("Invalid policy", "error", err)
+		}
+		srv.Policy = p
+	}
+	idempotencyStore, err := idempotency.Open(cfg.Idempotency.Path, cfg.Idempotency.TTL)
+	if err != nil {
+		fatal("Error opening idempotency store", "error", err)
+	}
+	srv.Idempotency = idempotencyStore
+	srv.DuplicateWindow = max(cfg.Idempotency.DuplicateWindow, 0)
+	journal, err := undo.Open(cfg.Undo.Path, cfg.Undo.MaxActions)
+	if err != nil {
+		fatal("Error opening undo journal", "error", err)
+	}
+	srv.Undo = journal
+	if !cfg.Sanitize.Disabled {
+		srv.Sanitize = &server.SanitizeOptions{FlagInstructions: cfg.Sanitize.FlagInstructions, SkipTools: make(map[string]bool)}
+		for _, name := range cfg.Sanitize.SkipTools {
+			srv.Sanitize.SkipTools[name] = true
+		}
+	}
+	srv.Cursors = budget.NewCursors(cfg.OutputBudget.CursorTTL)
+	if outputBudget := cfg.OutputBudget.Chars(); outputBudget > 0 {
+		srv.OutputBudget = outputBudget
+	}
+	var metricsServer *http.Server
+	if registry != nil {
+		srv.Metrics = server.NewMetrics(registry)
+		metricsServer = serveMetrics(cfg, srv, registry)
+	}
+	if cfg.Audit.Path != "" {
+		auditLog, err := audit.Open(cfg.Audit.Path, cfg.Audit.MaxBytes, cfg.Audit.MaxFiles)
+		if err != nil {
+			fatal("Error opening audit log", "error", err)
+		}
+		defer auditLog.Close()
+		srv.Audit = auditLog
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	switch cfg.Transport {
+	case "", "stdio":
+		checkMiddleware(srv)
+		logger.Info("Starting MCP server...")
+		go func() {
+			srv.Start()
+			served <- nil
+		}()
+	case "http":
+		if cfg.MultiUser.Enabled {
+			srv.MultiUser = newMultiUser(cfg, up)
+		}
+		if cfg.Auth.Enabled() {
+			srv.Auth = newResourceServer(cfg.Auth)
+		} else {
+			logger.Warn("HTTP transport running without authorization")
+		}
+		checkMiddleware(srv)
+		go func() {
+			served <- srv.StartHTTP(cfg.HTTPAddr)
+		}()
+	default:
+		fatal("Unknown transport", "transport", cfg.Transport)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Error serving HTTP", "error", err)
+		}
+	case <-ctx.Done():
+		logger.Info("Received shutdown signal")
+	}
+	// A second signal exits right away
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Shutdown incomplete", "error", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(shutdownCtx)
+	}
+}
+
+// fatal logs an error that prevents the server from running and exits
+func fatal(msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// checkMiddleware exits when the middleware order leaves out the middleware
+// of a configured safeguard
+func checkMiddleware(srv *server.MCPServer) {
+	if err := srv.CheckMiddlewareOrder(); err != nil {
+		fatal("Invalid middleware", "error", err)
+	}
+}
+
+// configureLogging sets the format and levels of the logs, masking the
+// configured credentials
+func configureLogging(cfg *config.Config) error {
+	opts := logging.Options{
+		Format:  cfg.Logging.Format,
+		Level:   slog.LevelInfo,
+		Levels:  make(map[string]slog.Level),
+		Secrets: cfg.Secrets(),
+	}
+	if cfg.Logging.Level != "" {
+		level, err := logging.ParseLevel(cfg.Logging.Level)
+		if err != nil {
+			return err
+		}
+		opts.Level = level
+	}
+	for subsystem, name := range cfg.Logging.Levels {
+		level, err := logging.ParseLevel(name)
+		if err != nil {
+			return fmt.Errorf("level of %s: %w", subsystem, err)
+		}
+		opts.Levels[subsystem] = level
+	}
+	return logging.Configure(opts)
+}
+
+// serveMetrics exposes /metrics on the MCP listener of the HTTP transport,
+// or on a side listener when one is configured, on stdio or when the MCP
+// listener requires authorization, which scrapers do not have. It returns
+// the side listener's server, if any.
+func serveMetrics(cfg *config.Config, srv *server.MCPServer, registry *metrics.Registry) *http.Server {
+	addr := cfg.Metrics.Addr
+	if addr == "" && cfg.Transport == "http" && !cfg.Auth.Enabled() {
+		srv.MetricsHandler = registry
+		return nil
+	}
+	if addr == "" {
+		addr = config.DefaultMetricsAddr
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	metricsServer := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		logger.Info("Serving metrics", "addr", addr)
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Error serving metrics", "error", err)
+		}
+	}()
+	return metricsServer
+}
+
+// newMultiUser configures per-session clients built from the users' own
+// credentials, against the instances of the default accounts. Each
+// credential has its own HTTP client, and so its own rate limit state,
+// dropped once the sessions using it ended.
+func newMultiUser(cfg *config.Config, up *upstreams) *server.MultiUser {
+	users := make(map[string]server.Credentials, len(cfg.MultiUser.Users))
+	for subject, creds := range cfg.MultiUser.Users {
+		users[subject] = server.Credentials(creds)
+	}
+
+	return &server.MultiUser{
+		Users:                  users,
+		RequireUserCredentials: cfg.MultiUser.RequireUserCredentials,
+		IdleTimeout:            cfg.MultiUser.IdleTimeout,
+		NewClients: func(creds server.Credentials) (*server.Clients, error) {
+			clients := &server.Clients{}
+			if creds.GithubToken != "" {
+				githubClient, err := github.NewGithubClient(up.userHTTPClient("github", creds.GithubToken), creds.GithubToken, cfg.GithubBaseURL, cfg.GithubUploadURL)
+				if err != nil {
+					return nil, err
+				}
+				clients.Github = server.NewAccounts[tools.GithubTool]("github")
+				clients.Github.Add(config.DefaultAccountName, githubClient)
+			}
+			if creds.JiraToken != "" {
+				jiraClient, err := jira.NewJiraClient(up.userHTTPClient("jira", creds.JiraUsername, creds.JiraToken), cfg.JiraURL, creds.JiraUsername, creds.JiraToken, cfg.JiraDeployment)
+				if err != nil {
+					return nil, err
+				}
+				clients.Jira = server.NewAccounts[tools.JiraTool]("jira")
+				clients.Jira.Add(config.DefaultAccountName, jiraClient)
+			}
+			if creds.NotionToken != "" {
+				clients.Notion = server.NewAccounts[tools.NotionTool]("notion")
+				clients.Notion.Add(config.DefaultAccountName, notion.NewNotionClient(up.userHTTPClient("notion", creds.NotionToken), creds.NotionToken))
+			}
+			return clients, nil
+		},
+		Release: func(creds server.Credentials) {
+			if creds.GithubToken != "" {
+				up.releaseUserClient("github", creds.GithubToken)
+			}
+			if creds.JiraToken != "" {
+				up.releaseUserClient("jira", creds.JiraUsername, creds.JiraToken)
+			}
+			if creds.NotionToken != "" {
+				up.releaseUserClient("notion", creds.NotionToken)
+			}
+		},
+	}
+}
+
+// newResourceServer creates the OAuth resource server validating the HTTP transport callers
+func newResourceServer(cfg config.AuthConfig) *auth.ResourceServer {
+	var validator auth.Validator
+	if cfg.IntrospectionURL != "" {
+		validator = auth.NewIntrospectionValidator(cfg.IntrospectionURL, cfg.IntrospectionClientID, cfg.IntrospectionClientSecret, cfg.ExpectedAudience())
+	} else {
+		validator = auth.NewJWTValidator(cfg.JWKSURL, cfg.Issuer, cfg.ExpectedAudience())
+	}
+
+	authorizationServers := cfg.AuthorizationServers
+	if len(authorizationServers) == 0 && cfg.Issuer != "" {
+		authorizationServers = []string{cfg.Issuer}
+	}
+	return &auth.ResourceServer{
+		Resource:             cfg.Resource,
+		AuthorizationServers: authorizationServers,
+		Validator:            validator,
+	}
+}
+
+// newPolicy creates the policy evaluated before every tool call
+func newPolicy(cfg config.Policy) (*policy.Policy, error) {
+	rules := make([]policy.Rule, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		rules[i] = policy.Rule{
+			Name:     rule.Name,
+			Tools:    rule.Tools,
+			Repos:    rule.Repos,
+			Branches: rule.Branches,
+			Projects: rule.Projects,
+			Pages:    rule.Pages,
+		}
+	}
+	return policy.New(cfg.DenyTools, cfg.DefaultDeny, rules)
+}
+
+// newGithubClient creates the client of a GitHub account, authenticating
+// as a GitHub App when one is configured and with the token otherwise
+func newGithubClient(httpClient *http.Client, account config.GithubAccount) (*github.GithubClient, error) {
+	if !account.App.IsSet() {
+		return github.NewGithubClient(httpClient, account.Token, account.BaseURL, account.UploadURL)
+	}
+	privateKey, err := account.App.PrivateKeyPEM()
+	if err != nil {
+		return nil, err
 	}
-	srv.Start()
+	return github.NewGithubAppClient(httpClient, account.App.ID, account.App.InstallationID, privateKey, account.BaseURL, account.UploadURL)
 }
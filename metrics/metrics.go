@@ -0,0 +1,310 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the latency histogram buckets, in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry holds metric families and serves them in the Prometheus text
+// exposition format
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+// family is a named group of samples written on every scrape
+type family interface {
+	write(w io.Writer)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register adds a family to the registry
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// ServeHTTP implements http.Handler
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+// Write writes every family in the text exposition format
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+	for _, f := range families {
+		f.write(w)
+	}
+}
+
+// desc describes a metric family
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+// header writes the HELP and TYPE lines of a family
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.kind)
+}
+
+// series is the value of one combination of label values
+type series struct {
+	values []string
+	value  float64
+	// counts and sum are set on histograms, counts[i] matching buckets[i]
+	counts []uint64
+	sum    float64
+}
+
+// vec holds the series of a family keyed by their label values
+type vec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newVec(d desc) *vec {
+	return &vec{desc: d, series: make(map[string]*series)}
+}
+
+// with returns the series of the label values, creating it. It panics
+// when the number of values does not match the labels, a programming error.
+func (v *vec) with(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// delete removes the series whose label has the given value
+func (v *vec) delete(label string, value string) {
+	for i, name := range v.labels {
+		if name != label {
+			continue
+		}
+		for key, s := range v.series {
+			if s.values[i] == value {
+				delete(v.series, key)
+			}
+		}
+	}
+}
+
+// sorted returns the series ordered by label values
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]*series, len(keys))
+	for i, key := range keys {
+		result[i] = v.series[key]
+	}
+	return result
+}
+
+// Counter is a family of monotonically increasing values
+type Counter struct{ v *vec }
+
+// Counter registers a new counter
+func (r *Registry) Counter(name string, help string, labels ...string) *Counter {
+	c := &Counter{newVec(desc{name, help, "counter", labels})}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta to the series of the label values
+func (c *Counter) Add(delta float64, values ...string) {
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	c.v.with(values).value += delta
+}
+
+// Delete removes the series whose label has the given value, e.g. those of
+// an account that no longer exists
+func (c *Counter) Delete(label string, value string) {
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	c.v.delete(label, value)
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	c.v.header(w)
+	for _, s := range c.v.sorted() {
+		writeSample(w, c.v.name, c.v.labels, s.values, "", "", s.value)
+	}
+}
+
+// Gauge is a family of values that go up and down
+type Gauge struct{ v *vec }
+
+// Gauge registers a new gauge
+func (r *Registry) Gauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{newVec(desc{name, help, "gauge", labels})}
+	r.register(g)
+	return g
+}
+
+// Add adds delta, possibly negative, to the series of the label values
+func (g *Gauge) Add(delta float64, values ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.with(values).value += delta
+}
+
+// Set sets the series of the label values
+func (g *Gauge) Set(value float64, values ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.with(values).value = value
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.header(w)
+	for _, s := range g.v.sorted() {
+		writeSample(w, g.v.name, g.v.labels, s.values, "", "", s.value)
+	}
+}
+
+// Histogram is a family of observations counted in cumulative buckets
+type Histogram struct {
+	v       *vec
+	buckets []float64
+}
+
+// Histogram registers a new histogram with the given upper bounds
+func (r *Registry) Histogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{newVec(desc{name, help, "histogram", labels}), append([]float64(nil), buckets...)}
+	sort.Float64s(h.buckets)
+	r.register(h)
+	return h
+}
+
+// Observe records a value in the series of the label values
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	s := h.v.with(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.value++
+	s.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	h.v.header(w)
+	for _, s := range h.v.sorted() {
+		for i, bound := range h.buckets {
+			writeSample(w, h.v.name+"_bucket", h.v.labels, s.values, "le", formatFloat(bound), float64(s.counts[i]))
+		}
+		writeSample(w, h.v.name+"_bucket", h.v.labels, s.values, "le", "+Inf", s.value)
+		writeSample(w, h.v.name+"_sum", h.v.labels, s.values, "", "", s.sum)
+		writeSample(w, h.v.name+"_count", h.v.labels, s.values, "", "", s.value)
+	}
+}
+
+// Sample is a value read by a collector, with one value per label
+type Sample struct {
+	Values []string
+	Value  float64
+}
+
+// collector reads its samples on every scrape
+type collector struct {
+	desc
+	collect func() []Sample
+}
+
+// Collect registers a family whose samples are read from collect on every
+// scrape, for values kept elsewhere such as rate limit quotas. kind is
+// "gauge" or "counter".
+func (r *Registry) Collect(name string, help string, kind string, labels []string, collect func() []Sample) {
+	r.register(&collector{desc{name, help, kind, labels}, collect})
+}
+
+func (c *collector) write(w io.Writer) {
+	c.header(w)
+	for _, s := range c.collect() {
+		writeSample(w, c.name, c.labels, s.Values, "", "", s.Value)
+	}
+}
+
+// writeSample writes one sample line, with an optional extra label such as le
+func writeSample(w io.Writer, name string, labels []string, values []string, extraLabel string, extraValue string, value float64) {
+	var pairs []string
+	for i, label := range labels {
+		pairs = append(pairs, label+"="+quote(values[i]))
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, extraLabel+"="+quote(extraValue))
+	}
+	if len(pairs) > 0 {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+// quote escapes a label value
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+// formatFloat formats a sample value
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Transport is an http.RoundTripper counting the responses of one upstream
+// backend by status code and timing its requests
+type Transport struct {
+	service   string
+	account   string
+	base      http.RoundTripper
+	responses *Counter
+	latency   *Histogram
+}
+
+// NewTransport creates a new Transport for an account of a service,
+// recording in responses (labels service, account, code) and latency
+// (label service). Without them it only records the Upstream of the calls.
+func NewTransport(service string, account string, base http.RoundTripper, responses *Counter, latency *Histogram) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		service:   service,
+		account:   account,
+		base:      base,
+		responses: responses,
+		latency:   latency,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if t.latency != nil {
+		t.latency.Observe(time.Since(started).Seconds(), t.service)
+	}
+	if t.responses != nil {
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		t.responses.Inc(t.service, t.account, code)
+	}
+	if upstream, ok := req.Context().Value(upstreamKey{}).(*Upstream); ok {
+		upstream.observe(resp, err)
+	}
+	return resp, err
+}
+
+// Upstream records the upstream responses of one tool call, so a failed
+// call can be classified by the last status the backend returned
+type Upstream struct {
+	mu     sync.Mutex
+	status int
+	failed bool
+}
+
+type upstreamKey struct{}
+
+// WithUpstream returns a copy of ctx recording the upstream responses of
+// the requests sent with it
+func WithUpstream(ctx context.Context) (context.Context, *Upstream) {
+	upstream := &Upstream{}
+	return context.WithValue(ctx, upstreamKey{}, upstream), upstream
+}
+
+// observe records a response, or a request that got none
+func (u *Upstream) observe(resp *http.Response, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err != nil {
+		u.failed = true
+		return
+	}
+	u.status = resp.StatusCode
+	u.failed = false
+}
+
+// Status returns the status code of the last upstream response, 0 if none,
+// and whether the last request failed without a response
+func (u *Upstream) Status() (int, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.status, u.failed
+}
@@ -0,0 +1,51 @@
+package notion
+
+import (
+	"errors"
+	"mcp-server/apierror"
+	"strings"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// categories classifies the error codes of the Notion API
+var categories = map[string]apierror.Category{
+	"invalid_json":          apierror.Validation,
+	"invalid_request_url":   apierror.Validation,
+	"invalid_request":       apierror.Validation,
+	"validation_error":      apierror.Validation,
+	"unauthorized":          apierror.Unauthorized,
+	"restricted_resource":   apierror.Forbidden,
+	"object_not_found":      apierror.NotFound,
+	"conflict_error":        apierror.Conflict,
+	"rate_limited":          apierror.RateLimited,
+	"internal_server_error": apierror.UpstreamUnavailable,
+	"service_unavailable":   apierror.UpstreamUnavailable,
+}
+
+// wrapError classifies an error of the Notion API. Errors of other kinds
+// are returned unchanged.
+func wrapError(err error) error {
+	var apiErr *notion.APIError
+	if errors.As(err, &apiErr) {
+		category, ok := categories[apiErr.Code]
+		if !ok {
+			category = apierror.CategoryOf(apiErr.Status)
+		}
+		message := apiErr.Message
+		if message == "" {
+			message = "Notion request failed"
+		}
+		e := apierror.New("notion", category, message)
+		e.Status = apiErr.Status
+		e.Err = err
+		return e
+	}
+	if err != nil && strings.HasPrefix(err.Error(), "notion: invalid ") {
+		// Parameters rejected by the client before sending the request
+		e := apierror.New("notion", apierror.Validation, strings.TrimPrefix(err.Error(), "notion: "))
+		e.Err = err
+		return e
+	}
+	return apierror.Wrap("notion", err)
+}
@@ -2,9 +2,14 @@ package notion
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"mcp-server/apierror"
+	"mcp-server/dryrun"
 	"mcp-server/tools"
+	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 
 	"github.com/dstotijn/go-notion"
@@ -17,33 +22,38 @@ type NotionClient struct {
 }
 
 // NewNotionClient creates a new NotionClient
-// It takes a token as an argument and returns a new NotionClient
+// It takes the HTTP client requests are sent with (nil for a default one) and a token
+// as arguments and returns a new NotionClient
 // The token is used to authenticate with the Notion API
-func NewNotionClient(token string) *NotionClient {
-	client := notion.NewClient(token)
+func NewNotionClient(httpClient *http.Client, token string) *NotionClient {
+	var opts []notion.ClientOption
+	if httpClient != nil {
+		opts = append(opts, notion.WithHTTPClient(httpClient))
+	}
+	client := notion.NewClient(token, opts...)
 	return &NotionClient{client: client}
 }
 
 // SearchPagesByTitle searches for pages by title
 // It takes a title as an argument
-// It returns a string representation of the pages and an error if any
-func (c *NotionClient) SearchPagesByTitle(title string) (string, error) {
+// It returns the pages nested under other pages and an error if any
+func (c *NotionClient) SearchPagesByTitle(ctx context.Context, title string) ([]tools.NotionPage, error) {
 	query := &notion.SearchOpts{
 		Query: title,
 	}
-	resp, err := c.client.Search(context.Background(), query)
+	resp, err := c.client.Search(ctx, query)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	var result string
+	result := []tools.NotionPage{}
 	for _, p := range resp.Results {
 		page, ok := p.(notion.Page)
 		if !ok {
 			continue
 		}
 		if page.Parent.Type == notion.ParentTypePage {
-			result += page.URL + "\n"
+			result = append(result, *toPage(page))
 		}
 	}
 
@@ -51,39 +61,47 @@ func (c *NotionClient) SearchPagesByTitle(title string) (string, error) {
 }
 
 // GetPageByURL gets a page by its URL
-func (c *NotionClient) GetPageByURL(pageURL string) (string, error) {
+func (c *NotionClient) GetPageByURL(ctx context.Context, pageURL string) (*tools.NotionPage, error) {
 	pageID, err := extractPageIDFromURL(pageURL)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	page, err := c.client.FindPageByID(context.Background(), pageID)
+	page, err := c.client.FindPageByID(ctx, pageID)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	return fmt.Sprintf("Page ID: %s\nURL: %s\nCreated: %s\nLast Edited: %s",
-		page.ID, page.URL, page.CreatedTime, page.LastEditedTime), nil
+	return toPage(page), nil
 }
 
-// GetDatabase gets a database by its ID
-func (c *NotionClient) GetDatabase(databaseID string) (string, error) {
-	database, err := c.client.FindDatabaseByID(context.Background(), databaseID)
+// GetPage gets a page by its ID
+func (c *NotionClient) GetPage(ctx context.Context, pageID string) (*tools.NotionPage, error) {
+	page, err := c.client.FindPageByID(ctx, pageID)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	var properties string
-	for name, prop := range database.Properties {
-		properties += fmt.Sprintf("- %s (%s)\n", name, string(prop.Type))
+	return toPage(page), nil
+}
+
+// GetDatabase gets a database by its ID
+func (c *NotionClient) GetDatabase(ctx context.Context, databaseID string) (*tools.NotionDatabase, error) {
+	database, err := c.client.FindDatabaseByID(ctx, databaseID)
+	if err != nil {
+		return nil, wrapError(err)
 	}
 
-	return fmt.Sprintf("Database ID: %s\nTitle: %s\nCreated: %s\nProperties:\n%s",
-		database.ID, getDatabaseTitle(&database), database.CreatedTime, properties), nil
+	return toDatabase(database), nil
 }
 
 // CreatePage creates a new page
-func (c *NotionClient) CreatePage(parentID string, title string, content string) (string, error) {
+func (c *NotionClient) CreatePage(ctx context.Context, parentID string, title string, content string) (*tools.NotionPage, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolvePage(ctx, parentID); err != nil {
+			return nil, err
+		}
+	}
 	params := notion.CreatePageParams{
 		ParentType: notion.ParentTypePage,
 		ParentID:   parentID,
@@ -108,16 +126,21 @@ func (c *NotionClient) CreatePage(parentID string, title string, content string)
 		params.Children = []notion.Block{paragraphBlock}
 	}
 
-	page, err := c.client.CreatePage(context.Background(), params)
+	page, err := c.client.CreatePage(ctx, params)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	return fmt.Sprintf("Created page: %s (ID: %s)", title, page.ID), nil
+	return toPage(page), nil
 }
 
 // CreateDatabase creates a new database
-func (c *NotionClient) CreateDatabase(parentPageID string, title string) (string, error) {
+func (c *NotionClient) CreateDatabase(ctx context.Context, parentPageID string, title string) (*tools.NotionDatabase, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolvePage(ctx, parentPageID); err != nil {
+			return nil, err
+		}
+	}
 	params := notion.CreateDatabaseParams{
 		ParentPageID: parentPageID,
 		Title: []notion.RichText{
@@ -134,31 +157,53 @@ func (c *NotionClient) CreateDatabase(parentPageID string, title string) (string
 		},
 	}
 
-	database, err := c.client.CreateDatabase(context.Background(), params)
+	database, err := c.client.CreateDatabase(ctx, params)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	return fmt.Sprintf("Created database: %s (ID: %s)", title, database.ID), nil
+	return toDatabase(database), nil
 }
 
 // UpdatePage updates a page
-func (c *NotionClient) UpdatePage(pageID string, title string, content string) (string, error) {
+func (c *NotionClient) UpdatePage(ctx context.Context, pageID string, title string, content string) (*tools.NotionPage, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolvePage(ctx, pageID); err != nil {
+			return nil, err
+		}
+	}
 	params := notion.UpdatePageParams{}
+	if title != "" {
+		// "title" is the ID of the title property, whether the parent is a page or a database
+		params.DatabasePageProperties = notion.DatabasePageProperties{
+			"title": notion.DatabasePageProperty{
+				Title: []notion.RichText{
+					{
+						Type: notion.RichTextTypeText,
+						Text: &notion.Text{Content: title},
+					},
+				},
+			},
+		}
+	}
 
-	// Note: Updating page title requires different approach in this API version
-	// For now, we'll just update properties if needed
+	// Note: Updating page content requires different approach in this API version
 
-	page, err := c.client.UpdatePage(context.Background(), pageID, params)
+	page, err := c.client.UpdatePage(ctx, pageID, params)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	return fmt.Sprintf("Updated page: %s", page.ID), nil
+	return toPage(page), nil
 }
 
 // UpdateDatabase updates a database
-func (c *NotionClient) UpdateDatabase(databaseID string, title string) (string, error) {
+func (c *NotionClient) UpdateDatabase(ctx context.Context, databaseID string, title string) (*tools.NotionDatabase, error) {
+	if dryrun.Enabled(ctx) {
+		if err := c.resolveDatabase(ctx, databaseID); err != nil {
+			return nil, err
+		}
+	}
 	params := notion.UpdateDatabaseParams{
 		Title: []notion.RichText{
 			{
@@ -168,25 +213,44 @@ func (c *NotionClient) UpdateDatabase(databaseID string, title string) (string,
 		},
 	}
 
-	database, err := c.client.UpdateDatabase(context.Background(), databaseID, params)
+	database, err := c.client.UpdateDatabase(ctx, databaseID, params)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
 	}
 
-	return fmt.Sprintf("Updated database: %s", database.ID), nil
+	return toDatabase(database), nil
+}
+
+// ArchivePage archives a page, moving it to the trash
+func (c *NotionClient) ArchivePage(ctx context.Context, pageID string) (*tools.NotionPage, error) {
+	archived := true
+	page, err := c.client.UpdatePage(ctx, pageID, notion.UpdatePageParams{Archived: &archived})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return toPage(page), nil
+}
+
+// ArchiveDatabase archives a database, moving it to the trash. The API
+// archives databases as the blocks they are in their parent page.
+func (c *NotionClient) ArchiveDatabase(ctx context.Context, databaseID string) error {
+	if _, err := c.client.DeleteBlock(ctx, databaseID); err != nil {
+		return wrapError(err)
+	}
+	return nil
 }
 
 // Helper functions
 func extractPageIDFromURL(pageURL string) (string, error) {
 	u, err := url.Parse(pageURL)
 	if err != nil {
-		return "", err
+		return "", apierror.Invalid("notion", "invalid Notion URL: %v", err)
 	}
 
 	path := strings.TrimPrefix(u.Path, "/")
 	parts := strings.Split(path, "-")
 	if len(parts) == 0 {
-		return "", fmt.Errorf("invalid Notion URL")
+		return "", apierror.Invalid("notion", "invalid Notion URL")
 	}
 
 	// The last part should be the page ID
@@ -201,4 +265,130 @@ func getDatabaseTitle(database *notion.Database) string {
 	return "Untitled"
 }
 
+// getPageTitle returns the title of a page, whether its parent is a page or a database
+func getPageTitle(page notion.Page) string {
+	var title []notion.RichText
+	switch properties := page.Properties.(type) {
+	case notion.PageProperties:
+		title = properties.Title.Title
+	case notion.DatabasePageProperties:
+		for _, property := range properties {
+			if property.Type == notion.DBPropTypeTitle {
+				title = property.Title
+			}
+		}
+	}
+	var text string
+	for _, part := range title {
+		text += part.PlainText
+	}
+	return text
+}
+
+// toPage converts a page to the tool model
+func toPage(page notion.Page) *tools.NotionPage {
+	return &tools.NotionPage{
+		ID:             page.ID,
+		Title:          getPageTitle(page),
+		URL:            page.URL,
+		CreatedTime:    page.CreatedTime,
+		LastEditedTime: page.LastEditedTime,
+	}
+}
+
+// toDatabase converts a database to the tool model, with its properties sorted by name
+func toDatabase(database notion.Database) *tools.NotionDatabase {
+	result := &tools.NotionDatabase{
+		ID:             database.ID,
+		Title:          getDatabaseTitle(&database),
+		URL:            database.URL,
+		CreatedTime:    database.CreatedTime,
+		LastEditedTime: database.LastEditedTime,
+	}
+	for name, property := range database.Properties {
+		result.Properties = append(result.Properties, tools.NotionProperty{Name: name, Type: string(property.Type)})
+	}
+	sort.Slice(result.Properties, func(i, j int) bool { return result.Properties[i].Name < result.Properties[j].Name })
+	return result
+}
+
+// maxAncestors bounds the walk up the hierarchy of a page
+const maxAncestors = 32
+
+// Ancestors returns the IDs of the pages, databases and blocks containing
+// a page or database, nearest first, up to the workspace
+func (c *NotionClient) Ancestors(ctx context.Context, kind string, id string) ([]string, error) {
+	var parent notion.Parent
+	switch kind {
+	case "page":
+		page, err := c.client.FindPageByID(ctx, id)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		parent = page.Parent
+	case "database":
+		database, err := c.client.FindDatabaseByID(ctx, id)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		parent = database.Parent
+	default:
+		return nil, apierror.Invalid("notion", "unknown object kind %q", kind)
+	}
+
+	var ancestors []string
+	for len(ancestors) < maxAncestors {
+		switch parent.Type {
+		case notion.ParentTypePage:
+			ancestors = append(ancestors, parent.PageID)
+			page, err := c.client.FindPageByID(ctx, parent.PageID)
+			if err != nil {
+				return nil, wrapError(err)
+			}
+			parent = page.Parent
+		case notion.ParentTypeDatabase:
+			ancestors = append(ancestors, parent.DatabaseID)
+			database, err := c.client.FindDatabaseByID(ctx, parent.DatabaseID)
+			if err != nil {
+				return nil, wrapError(err)
+			}
+			parent = database.Parent
+		case notion.ParentTypeBlock:
+			ancestors = append(ancestors, parent.BlockID)
+			block, err := c.client.FindBlockByID(ctx, parent.BlockID)
+			if err != nil {
+				return nil, wrapError(err)
+			}
+			parent = block.Parent()
+		default:
+			// The workspace
+			return ancestors, nil
+		}
+	}
+	return ancestors, nil
+}
+
+// resolvePage checks that a page exists. It runs in dry-run mode, where
+// writes are never sent.
+func (c *NotionClient) resolvePage(ctx context.Context, pageID string) error {
+	if _, err := c.client.FindPageByID(ctx, pageID); err != nil {
+		if errors.Is(err, notion.ErrObjectNotFound) {
+			return apierror.New("notion", apierror.NotFound, fmt.Sprintf("page %s not found", pageID))
+		}
+		return wrapError(err)
+	}
+	return nil
+}
+
+// resolveDatabase checks that a database exists
+func (c *NotionClient) resolveDatabase(ctx context.Context, databaseID string) error {
+	if _, err := c.client.FindDatabaseByID(ctx, databaseID); err != nil {
+		if errors.Is(err, notion.ErrObjectNotFound) {
+			return apierror.New("notion", apierror.NotFound, fmt.Sprintf("database %s not found", databaseID))
+		}
+		return wrapError(err)
+	}
+	return nil
+}
+
 var _ tools.NotionTool = &NotionClient{}
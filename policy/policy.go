@@ -0,0 +1,278 @@
+// Package policy restricts what the write tools may touch: which tools may
+// be called at all, and in which repositories, branches, Jira projects and
+// Notion pages the others may write.
+package policy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Rule restricts the targets of the write tools it applies to. Every
+// constraint that is set and concerns the target of a call must match it,
+// e.g. Projects only concern the Jira tools. A call whose target is unknown
+// for a constraint concerning it is denied.
+type Rule struct {
+	Name string
+	// Tools are the patterns of the tool names the rule applies to, every
+	// write tool when empty
+	Tools []string
+	// Repos are patterns of the owner/repo of GitHub writes
+	Repos []string
+	// Branches are patterns of the branches GitHub writes create, open a
+	// pull request from or run a workflow on. They only concern the tools
+	// using a branch.
+	Branches []string
+	// Projects are the keys of the Jira projects tickets may be created in
+	Projects []string
+	// Pages are the IDs of the Notion pages writes must be under
+	Pages []string
+}
+
+// Policy is a set of rules evaluated before every tool call. Patterns use
+// the syntax of path.Match, where * does not match a slash.
+type Policy struct {
+	// DenyTools are the patterns of tools that may not be called
+	DenyTools []string
+	// DefaultDeny denies the write tools no rule applies to
+	DefaultDeny bool
+	Rules       []Rule
+}
+
+// New creates a Policy, checking its patterns
+func New(denyTools []string, defaultDeny bool, rules []Rule) (*Policy, error) {
+	p := &Policy{DenyTools: denyTools, DefaultDeny: defaultDeny}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("#%d", i+1)
+		}
+		for _, patterns := range [][]string{rule.Tools, rule.Repos, rule.Branches} {
+			if err := checkPatterns(patterns); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+		}
+		p.Rules = append(p.Rules, rule)
+	}
+	if err := checkPatterns(denyTools); err != nil {
+		return nil, fmt.Errorf("deny_tools: %w", err)
+	}
+	return p, nil
+}
+
+// checkPatterns checks the syntax of patterns
+func checkPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Request describes a tool call to evaluate
+type Request struct {
+	Tool string
+	// Write is set for the tools that create or modify data, the only ones
+	// rules apply to
+	Write bool
+	// Repo is the owner/repo of a GitHub tool. A repository to be created
+	// has no owner, its name is matched against the repo part of patterns.
+	Repo string
+	// Branch is the branch a GitHub tool creates or uses
+	Branch string
+	// UsesBranch is set for the tools that create or use a branch, even
+	// when Branch could not be determined
+	UsesBranch bool
+	// Project is the key of the Jira project of a Jira tool
+	Project string
+	// Page is the ID of the Notion page or database a Notion tool writes in
+	// or under
+	Page string
+	// Ancestors returns the IDs of the objects containing Page. It is only
+	// called when a rule restricts pages.
+	Ancestors func() ([]string, error)
+}
+
+// Decision is the outcome of evaluating a Request
+type Decision struct {
+	Allowed bool
+	// Reason explains the decision in one sentence
+	Reason string
+	// Trace lists how each rule was evaluated
+	Trace []string
+}
+
+// Evaluate decides whether a call is allowed. A call must not match
+// DenyTools and must satisfy every rule applying to it. It fails when the
+// ancestors of a Notion page cannot be resolved.
+func (p *Policy) Evaluate(req Request) (Decision, error) {
+	var d Decision
+	for _, pattern := range p.DenyTools {
+		if match(pattern, req.Tool) {
+			d.Reason = fmt.Sprintf("tool %s is denied by deny_tools pattern %q", req.Tool, pattern)
+			d.Trace = append(d.Trace, "deny_tools: "+d.Reason)
+			return d, nil
+		}
+	}
+	d.Trace = append(d.Trace, fmt.Sprintf("deny_tools: %s matches no pattern", req.Tool))
+	if !req.Write {
+		d.Allowed = true
+		d.Reason = fmt.Sprintf("%s only reads, rules apply to write tools", req.Tool)
+		return d, nil
+	}
+
+	var ancestors []string
+	applied := 0
+	for _, rule := range p.Rules {
+		if !rule.appliesTo(req.Tool) {
+			d.Trace = append(d.Trace, fmt.Sprintf("rule %s: does not apply to %s", rule.Name, req.Tool))
+			continue
+		}
+		applied++
+		if len(rule.Pages) > 0 && req.Page != "" && ancestors == nil && req.Ancestors != nil {
+			var err error
+			if ancestors, err = req.Ancestors(); err != nil {
+				return d, fmt.Errorf("resolving the location of %s: %w", req.Page, err)
+			}
+		}
+		reason, ok := rule.check(req, ancestors)
+		if !ok {
+			d.Reason = fmt.Sprintf("%s, as required by rule %s", reason, rule.Name)
+			d.Trace = append(d.Trace, fmt.Sprintf("rule %s: denied, %s", rule.Name, reason))
+			return d, nil
+		}
+		d.Trace = append(d.Trace, fmt.Sprintf("rule %s: satisfied, %s", rule.Name, reason))
+	}
+
+	switch {
+	case applied > 0:
+		d.Allowed = true
+		d.Reason = fmt.Sprintf("%s satisfies every rule applying to it", req.Tool)
+	case p.DefaultDeny:
+		d.Reason = fmt.Sprintf("no rule allows %s and default_deny is set", req.Tool)
+	default:
+		d.Allowed = true
+		d.Reason = fmt.Sprintf("no rule applies to %s", req.Tool)
+	}
+	return d, nil
+}
+
+// appliesTo reports whether the rule applies to a tool
+func (r Rule) appliesTo(tool string) bool {
+	if len(r.Tools) == 0 {
+		return true
+	}
+	return matchAny(r.Tools, tool) != ""
+}
+
+// check checks the constraints of the rule concerning the target of a
+// call. It returns why the call satisfies or violates them.
+func (r Rule) check(req Request, ancestors []string) (string, bool) {
+	service, _, _ := strings.Cut(req.Tool, "_")
+	var checked []string
+	if len(r.Repos) > 0 && service == "github" {
+		if req.Repo == "" {
+			return "the repository is unknown", false
+		}
+		pattern := matchAny(r.Repos, req.Repo)
+		if !strings.Contains(req.Repo, "/") {
+			pattern = matchRepoName(r.Repos, req.Repo)
+		}
+		if pattern == "" {
+			return fmt.Sprintf("repository %s does not match %s", req.Repo, strings.Join(r.Repos, ", ")), false
+		}
+		checked = append(checked, fmt.Sprintf("repository %s matches %s", req.Repo, pattern))
+	}
+	if len(r.Branches) > 0 && service == "github" && req.UsesBranch {
+		if req.Branch == "" {
+			return "the branch is unknown", false
+		}
+		pattern := matchAny(r.Branches, req.Branch)
+		if pattern == "" {
+			return fmt.Sprintf("branch %s does not match %s", req.Branch, strings.Join(r.Branches, ", ")), false
+		}
+		checked = append(checked, fmt.Sprintf("branch %s matches %s", req.Branch, pattern))
+	}
+	if len(r.Projects) > 0 && service == "jira" {
+		if req.Project == "" {
+			return "the Jira project is unknown", false
+		}
+		var found bool
+		for _, project := range r.Projects {
+			found = found || strings.EqualFold(project, req.Project)
+		}
+		if !found {
+			return fmt.Sprintf("project %s is not one of %s", req.Project, strings.Join(r.Projects, ", ")), false
+		}
+		checked = append(checked, fmt.Sprintf("project %s is allowed", req.Project))
+	}
+	if len(r.Pages) > 0 && service == "notion" {
+		if req.Page == "" {
+			return "the Notion page is unknown", false
+		}
+		page := under(r.Pages, append([]string{req.Page}, ancestors...))
+		if page == "" {
+			return fmt.Sprintf("%s is not under page %s", req.Page, strings.Join(r.Pages, ", ")), false
+		}
+		checked = append(checked, fmt.Sprintf("%s is under page %s", req.Page, page))
+	}
+	if len(checked) == 0 {
+		return "no constraint concerns the target", true
+	}
+	return strings.Join(checked, "; "), true
+}
+
+// under returns the page of pages that is one of ids, or ""
+func under(pages []string, ids []string) string {
+	for _, id := range ids {
+		for _, page := range pages {
+			if NormalizeID(id) == NormalizeID(page) {
+				return page
+			}
+		}
+	}
+	return ""
+}
+
+// NormalizeID returns a Notion ID without dashes, in lower case. The ID
+// may also be given as the URL of the page, which ends with it.
+func NormalizeID(id string) string {
+	if i := strings.IndexAny(id, "?#"); i >= 0 {
+		id = id[:i]
+	}
+	id = id[strings.LastIndex(id, "/")+1:]
+	id = strings.ToLower(strings.ReplaceAll(id, "-", ""))
+	if len(id) > 32 {
+		id = id[len(id)-32:]
+	}
+	return id
+}
+
+// matchAny returns the first pattern matching name, or ""
+func matchAny(patterns []string, name string) string {
+	for _, pattern := range patterns {
+		if match(pattern, name) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// matchRepoName returns the first owner/repo pattern whose repo part
+// matches the name of a repository without owner, or ""
+func matchRepoName(patterns []string, name string) string {
+	for _, pattern := range patterns {
+		repo := pattern[strings.LastIndex(pattern, "/")+1:]
+		if match(repo, name) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// match reports whether name matches a pattern
+func match(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	p, err := New([]string{"github_create_repository"}, false, []Rule{
+		{Name: "agent-branches", Tools: []string{"github_create_branch", "github_create_pull_request"}, Repos: []string{"acme/*"}, Branches: []string{"agent/*"}},
+		{Name: "jira-projects", Projects: []string{"FOO"}},
+		{Name: "notion-sandbox", Tools: []string{"notion_*"}, Pages: []string{"https://www.notion.so/acme/Agents-0123456789abcdef0123456789abcdef"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ancestors := func(ids ...string) func() ([]string, error) {
+		return func() ([]string, error) { return ids, nil }
+	}
+	sandbox := "01234567-89ab-cdef-0123-456789abcdef"
+
+	tests := []struct {
+		name       string
+		req        Request
+		wantAllow  bool
+		wantReason string
+	}{
+		{"denied tool", Request{Tool: "github_create_repository", Write: true, Repo: "new"}, false, "deny_tools"},
+		{"read", Request{Tool: "github_get_issue", Repo: "other/repo"}, true, "only reads"},
+		{"branch allowed", Request{Tool: "github_create_branch", Write: true, Repo: "acme/api", Branch: "agent/fix", UsesBranch: true}, true, ""},
+		{"branch denied", Request{Tool: "github_create_branch", Write: true, Repo: "acme/api", Branch: "feature/x", UsesBranch: true}, false, "branch feature/x does not match agent/*"},
+		{"repository denied", Request{Tool: "github_create_branch", Write: true, Repo: "other/api", Branch: "agent/fix", UsesBranch: true}, false, "repository other/api does not match"},
+		{"unknown branch", Request{Tool: "github_create_pull_request", Write: true, Repo: "acme/api", UsesBranch: true}, false, "the branch is unknown"},
+		{"unknown repository", Request{Tool: "github_create_branch", Write: true, Branch: "agent/fix", UsesBranch: true}, false, "the repository is unknown"},
+		{"project allowed", Request{Tool: "jira_create_ticket", Write: true, Project: "foo"}, true, ""},
+		{"project denied", Request{Tool: "jira_create_ticket", Write: true, Project: "BAR"}, false, "project BAR is not one of FOO"},
+		{"unknown project", Request{Tool: "jira_create_ticket", Write: true}, false, "the Jira project is unknown"},
+		// A projects constraint does not concern GitHub writes
+		{"other service", Request{Tool: "github_create_issue", Write: true, Repo: "other/api"}, true, ""},
+		{"page under sandbox", Request{Tool: "notion_create_page", Write: true, Page: "child", Ancestors: ancestors("parent", sandbox)}, true, ""},
+		{"page outside sandbox", Request{Tool: "notion_create_page", Write: true, Page: "child", Ancestors: ancestors("parent")}, false, "child is not under page"},
+		{"unknown page", Request{Tool: "notion_update_page", Write: true}, false, "the Notion page is unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := p.Evaluate(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Allowed != tt.wantAllow || !strings.Contains(d.Reason, tt.wantReason) {
+				t.Errorf("Evaluate() = %v, %q, want %v, %q", d.Allowed, d.Reason, tt.wantAllow, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestEvaluateBranchesOnlyConcernBranchTools(t *testing.T) {
+	p, _ := New(nil, false, []Rule{{Name: "agent-branches", Branches: []string{"agent/*"}}})
+	d, _ := p.Evaluate(Request{Tool: "github_create_issue", Write: true, Repo: "acme/api"})
+	if !d.Allowed {
+		t.Errorf("Evaluate() denied an issue under a branch rule: %s", d.Reason)
+	}
+}
+
+func TestEvaluateDefaultDeny(t *testing.T) {
+	p, _ := New(nil, true, []Rule{{Name: "jira", Tools: []string{"jira_*"}, Projects: []string{"FOO"}}})
+	d, _ := p.Evaluate(Request{Tool: "github_create_issue", Write: true, Repo: "acme/api"})
+	if d.Allowed || !strings.Contains(d.Reason, "default_deny") {
+		t.Errorf("Evaluate() = %v, %q, want denied by default_deny", d.Allowed, d.Reason)
+	}
+}
+
+func TestEvaluateAncestorsError(t *testing.T) {
+	p, _ := New(nil, false, []Rule{{Name: "sandbox", Pages: []string{"0123456789abcdef0123456789abcdef"}}})
+	_, err := p.Evaluate(Request{Tool: "notion_update_page", Write: true, Page: "child", Ancestors: func() ([]string, error) {
+		return nil, errors.New("notion unavailable")
+	}})
+	if err == nil {
+		t.Error("Evaluate() succeeded without the ancestors of the page")
+	}
+}
+
+func TestNormalizeID(t *testing.T) {
+	want := "0123456789abcdef0123456789abcdef"
+	for _, id := range []string{
+		want,
+		"01234567-89AB-CDEF-0123-456789ABCDEF",
+		"https://www.notion.so/acme/Agents-0123456789abcdef0123456789abcdef?pvs=4",
+	} {
+		if got := NormalizeID(id); got != want {
+			t.Errorf("NormalizeID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
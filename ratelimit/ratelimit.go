@@ -0,0 +1,365 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Policy configures the pacing and retries of one upstream backend
+type Policy struct {
+	// RequestsPerSecond is the token bucket refill rate. Zero disables pacing.
+	RequestsPerSecond float64
+	// Burst is the token bucket size
+	Burst int
+	// MaxRetries is how many times a throttled or unavailable read, or a
+	// request marked idempotent, is retried
+	MaxRetries int
+	// BaseDelay is the initial backoff delay, doubled on every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay and the wait for a rate limit reset.
+	// Requests that would have to wait longer fail with the upstream response.
+	MaxDelay time.Duration
+}
+
+// Status is a snapshot of the rate limit state of one backend
+type Status struct {
+	Name string
+	// Limit and Remaining are the last quota reported by the backend, -1 when unknown
+	Limit     int
+	Remaining int
+	// Reset is when the reported quota resets
+	Reset time.Time
+	// BlockedUntil is set while the backend asked us to back off
+	BlockedUntil time.Time
+	Requests     int
+	Throttled    int
+	Retries      int
+}
+
+// Transport is an http.RoundTripper that paces requests with a token
+// bucket, honours Retry-After and X-RateLimit-Reset, and retries reads
+// and requests marked idempotent with jittered exponential backoff.
+type Transport struct {
+	name   string
+	base   http.RoundTripper
+	policy Policy
+
+	mu           sync.Mutex
+	tokens       float64
+	lastRefill   time.Time
+	limit        int
+	remaining    int
+	reset        time.Time
+	blockedUntil time.Time
+	requests     int
+	throttled    int
+	retries      int
+}
+
+// NewTransport creates a new Transport named name wrapping base
+func NewTransport(name string, base http.RoundTripper, policy Policy) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if policy.Burst <= 0 {
+		policy.Burst = 1
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = 500 * time.Millisecond
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = time.Minute
+	}
+	return &Transport{
+		name:       name,
+		base:       base,
+		policy:     policy,
+		tokens:     float64(policy.Burst),
+		lastRefill: time.Now(),
+		limit:      -1,
+		remaining:  -1,
+	}
+}
+
+// LimitError is returned instead of waiting when a backend asked to back
+// off for longer than the policy allows
+type LimitError struct {
+	Name  string
+	Until time.Time
+}
+
+// Error implements error
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded, retry after %s", e.Name, e.Until.Format(time.RFC3339))
+}
+
+type idempotentKey struct{}
+
+// MarkIdempotent returns a copy of req that may be retried even though its
+// method is not idempotent, e.g. a read-only search sent as POST
+func MarkIdempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		attemptReq := req
+		if attempt > 0 && req.Body != nil && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err != nil {
+			return nil, err
+		}
+
+		delay, retry := t.observe(resp, attempt)
+		if !retry || attempt >= t.policy.MaxRetries || !isRetryable(req) {
+			return resp, nil
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		t.mu.Lock()
+		t.retries++
+		t.mu.Unlock()
+
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Status returns a snapshot of the rate limit state
+func (t *Transport) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Status{
+		Name:         t.name,
+		Limit:        t.limit,
+		Remaining:    t.remaining,
+		Reset:        t.reset,
+		BlockedUntil: t.blockedUntil,
+		Requests:     t.requests,
+		Throttled:    t.throttled,
+		Retries:      t.retries,
+	}
+}
+
+// wait blocks until the backend is not blocked and a bucket token is available.
+// It fails fast when the backend is blocked for longer than MaxDelay.
+func (t *Transport) wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		now := time.Now()
+		var delay time.Duration
+		if now.Before(t.blockedUntil) {
+			delay = t.blockedUntil.Sub(now)
+			if delay > t.policy.MaxDelay {
+				until := t.blockedUntil
+				t.mu.Unlock()
+				return &LimitError{Name: t.name, Until: until}
+			}
+		} else if t.policy.RequestsPerSecond > 0 {
+			t.tokens += now.Sub(t.lastRefill).Seconds() * t.policy.RequestsPerSecond
+			if t.tokens > float64(t.policy.Burst) {
+				t.tokens = float64(t.policy.Burst)
+			}
+			t.lastRefill = now
+			if t.tokens < 1 {
+				delay = time.Duration((1 - t.tokens) / t.policy.RequestsPerSecond * float64(time.Second))
+			} else {
+				t.tokens--
+			}
+		}
+		if delay == 0 {
+			t.requests++
+		}
+		t.mu.Unlock()
+
+		if delay == 0 {
+			return nil
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// observe records the rate limit headers of resp and decides whether the
+// request should be retried and after which delay
+func (t *Transport) observe(resp *http.Response, attempt int) (time.Duration, bool) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit")); err == nil {
+		t.limit = limit
+	}
+	remaining, remainingErr := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	exhausted := remainingErr == nil && remaining == 0
+	if remainingErr == nil {
+		t.remaining = remaining
+	}
+	reset, hasReset := parseReset(resp.Header.Get("X-RateLimit-Reset"))
+	if hasReset {
+		t.reset = reset
+	}
+
+	throttled := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && (resp.Header.Get("Retry-After") != "" || exhausted))
+	unavailable := resp.StatusCode == http.StatusBadGateway ||
+		resp.StatusCode == http.StatusServiceUnavailable ||
+		resp.StatusCode == http.StatusGatewayTimeout
+	if !throttled && !unavailable {
+		return 0, false
+	}
+
+	if throttled {
+		t.throttled++
+	}
+
+	// Prefer the delay the backend asked for, then the quota reset, then backoff
+	delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	if !ok && hasReset && reset.After(now) && (exhausted || resp.StatusCode == http.StatusTooManyRequests) {
+		delay, ok = reset.Sub(now), true
+	}
+	if ok {
+		if until := now.Add(delay); until.After(t.blockedUntil) {
+			t.blockedUntil = until
+		}
+	} else {
+		delay = t.backoff(attempt)
+	}
+
+	return delay, delay <= t.policy.MaxDelay
+}
+
+// backoff returns the full-jitter exponential backoff delay of an attempt
+func (t *Transport) backoff(attempt int) time.Duration {
+	ceiling := t.policy.BaseDelay << uint(attempt)
+	if ceiling <= 0 || ceiling > t.policy.MaxDelay {
+		ceiling = t.policy.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1) // #nosec G404 -- jitter does not need a secure source
+}
+
+// isRetryable reports whether req can safely be sent again: a read, or a
+// request marked idempotent. Writes are not retried, even with a PUT or
+// DELETE, as the first attempt may have been applied before failing.
+func isRetryable(req *http.Request) bool {
+	if marked, _ := req.Context().Value(idempotentKey{}).(bool); marked {
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+// resetLayouts are the ISO 8601 layouts of X-RateLimit-Reset, e.g. Jira's
+// "2024-01-15T10:30Z"
+var resetLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00"}
+
+// parseReset parses an X-RateLimit-Reset header given in Unix seconds, as
+// GitHub sends it, or as an ISO 8601 time, as Jira sends it
+func parseReset(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), true
+	}
+	for _, layout := range resetLayouts {
+		if reset, err := time.Parse(layout, value); err == nil {
+			return reset, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Registry keeps the transports of all backends for status reporting
+type Registry struct {
+	mu         sync.Mutex
+	transports map[string]*Transport
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{transports: make(map[string]*Transport)}
+}
+
+// Register adds a transport to the registry
+func (r *Registry) Register(t *Transport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transports[t.name] = t
+}
+
+// Unregister removes the transport of a name from the registry
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.transports, name)
+}
+
+// Statuses returns the status of every registered transport, sorted by name
+func (r *Registry) Statuses() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	statuses := make([]Status, 0, len(r.transports))
+	for _, t := range r.transports {
+		statuses = append(statuses, t.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stub returns a base transport answering with responses in turn, the last
+// one repeated, and a pointer to the number of requests it received
+func stub(responses ...func() *http.Response) (http.RoundTripper, *int) {
+	calls := 0
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Body != nil {
+			io.Copy(io.Discard, req.Body)
+		}
+		i := calls
+		if i >= len(responses) {
+			i = len(responses) - 1
+		}
+		calls++
+		return responses[i](), nil
+	}), &calls
+}
+
+// response returns a response with status and header key/value pairs
+func response(status int, header ...string) func() *http.Response {
+	return func() *http.Response {
+		h := http.Header{}
+		for i := 0; i+1 < len(header); i += 2 {
+			h.Set(header[i], header[i+1])
+		}
+		return &http.Response{StatusCode: status, Header: h, Body: io.NopCloser(strings.NewReader(""))}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	base, calls := stub(response(http.StatusTooManyRequests, "Retry-After", "0"), response(http.StatusOK))
+	tr := NewTransport("github", base, Policy{MaxRetries: 2})
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/issues", nil)
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || *calls != 2 {
+		t.Errorf("status = %d after %d requests, want 200 after a retry", resp.StatusCode, *calls)
+	}
+	if status := tr.Status(); status.Throttled != 1 || status.Retries != 1 {
+		t.Errorf("Status() = %+v, want 1 throttled request retried", status)
+	}
+}
+
+func TestRetryAfterBeyondMaxDelay(t *testing.T) {
+	base, calls := stub(response(http.StatusTooManyRequests, "Retry-After", "3600"))
+	tr := NewTransport("jira", base, Policy{MaxRetries: 2, MaxDelay: time.Second})
+
+	req, _ := http.NewRequest(http.MethodGet, "https://jira.example.com/rest/api/2/issue/PROJ-1", nil)
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || *calls != 1 {
+		t.Errorf("status = %d after %d requests, want the 429 without a retry", resp.StatusCode, *calls)
+	}
+
+	// Later requests fail fast until the backend accepts requests again
+	_, err = tr.RoundTrip(req)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || *calls != 1 {
+		t.Errorf("RoundTrip() error = %v after %d requests, want a LimitError", err, *calls)
+	}
+}
+
+func TestResetHeader(t *testing.T) {
+	now := time.Now()
+	in := now.Add(30 * time.Second)
+	tests := []struct {
+		name   string
+		status int
+		header []string
+	}{
+		{"unix seconds", http.StatusForbidden, []string{"X-RateLimit-Remaining", "0", "X-RateLimit-Reset", strconv.FormatInt(in.Unix(), 10)}},
+		{"iso 8601", http.StatusTooManyRequests, []string{"X-RateLimit-Reset", in.UTC().Format(time.RFC3339)}},
+		{"iso 8601 in minutes", http.StatusTooManyRequests, []string{"X-RateLimit-Reset", in.Add(time.Minute).UTC().Format("2006-01-02T15:04Z")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTransport("test", nil, Policy{MaxDelay: time.Hour})
+			delay, retry := tr.observe(response(tt.status, tt.header...)(), 0)
+			if !retry || delay < 28*time.Second || delay > 91*time.Second {
+				t.Errorf("observe() = %v, %v, want to retry at the reset", delay, retry)
+			}
+			if status := tr.Status(); status.Reset.IsZero() || status.BlockedUntil.Before(now.Add(28*time.Second)) {
+				t.Errorf("Status() = %+v, want blocked until the reset", status)
+			}
+		})
+	}
+}
+
+func TestParseReset(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{"1700000000", time.Unix(1700000000, 0), true},
+		{"2024-01-15T10:30:00Z", time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC), true},
+		{"2024-01-15T10:30:00.250+01:00", time.Date(2024, 1, 15, 9, 30, 0, 250e6, time.UTC), true},
+		{"2024-01-15T10:30Z", time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC), true},
+		{"", time.Time{}, false},
+		{"soon", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseReset(tt.value)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseReset(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{"", 0, false},
+		{"later", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetriesOnlyIdempotentRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		mark      bool
+		wantCalls int
+	}{
+		{"get", http.MethodGet, false, 3},
+		{"post", http.MethodPost, false, 1},
+		{"put", http.MethodPut, false, 1},
+		{"delete", http.MethodDelete, false, 1},
+		{"marked post", http.MethodPost, true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, calls := stub(response(http.StatusServiceUnavailable))
+			tr := NewTransport("test", base, Policy{MaxRetries: 2, BaseDelay: time.Millisecond})
+
+			req, _ := http.NewRequest(tt.method, "https://api.example.com/items", strings.NewReader(`{"q":1}`))
+			if tt.mark {
+				req = MarkIdempotent(req)
+			}
+			resp, err := tr.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusServiceUnavailable || *calls != tt.wantCalls {
+				t.Errorf("status = %d after %d requests, want 503 after %d", resp.StatusCode, *calls, tt.wantCalls)
+			}
+		})
+	}
+}
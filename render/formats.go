@@ -0,0 +1,99 @@
+package render
+
+import (
+	"fmt"
+	"mcp-server/tools"
+	"strings"
+)
+
+// noResults is the rendering of an empty list
+const noResults = "No results found."
+
+// markdown renders a result as Markdown: a heading per object with a
+// bullet list of fields, and fenced diffs
+func markdown(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case tools.Message:
+		return string(v)
+	case tools.Diff:
+		return "```diff\n" + strings.TrimSuffix(string(v), "\n") + "\n```"
+	}
+
+	if view, ok := viewOf(v); ok {
+		return markdownView(view)
+	}
+	if list, ok := items(v); ok {
+		if len(list) == 0 {
+			return noResults
+		}
+		parts := make([]string, 0, len(list))
+		for _, item := range list {
+			parts = append(parts, markdown(item))
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return fmt.Sprint(v)
+}
+
+// markdownView renders one object as Markdown
+func markdownView(v view) string {
+	var b strings.Builder
+	if v.url != "" {
+		fmt.Fprintf(&b, "### [%s](%s)\n", v.title, v.url)
+	} else {
+		fmt.Fprintf(&b, "### %s\n", v.title)
+	}
+	for _, field := range v.fields {
+		fmt.Fprintf(&b, "- **%s:** %s\n", field.label, field.value)
+	}
+	if v.body != "" {
+		b.WriteString("\n" + v.body + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// text renders a result as plain "Label: value" lines, one blank-line
+// separated block per object
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case tools.Message:
+		return string(v)
+	case tools.Diff:
+		return string(v)
+	}
+
+	if view, ok := viewOf(v); ok {
+		return textView(view)
+	}
+	if list, ok := items(v); ok {
+		if len(list) == 0 {
+			return noResults
+		}
+		parts := make([]string, 0, len(list))
+		for _, item := range list {
+			parts = append(parts, text(item))
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return fmt.Sprint(v)
+}
+
+// textView renders one object as plain text
+func textView(v view) string {
+	var b strings.Builder
+	b.WriteString(v.title + "\n")
+	for _, field := range v.fields {
+		fmt.Fprintf(&b, "%s: %s\n", field.label, field.value)
+	}
+	if v.url != "" {
+		fmt.Fprintf(&b, "URL: %s\n", v.url)
+	}
+	if v.body != "" {
+		b.WriteString("\n" + v.body + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
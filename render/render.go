@@ -0,0 +1,96 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Output formats of the tools
+const (
+	Markdown = "markdown"
+	JSON     = "json"
+	Text     = "text"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{Markdown, JSON, Text}
+
+// CheckFormat returns an error for an unsupported format. Empty selects Markdown.
+func CheckFormat(format string) error {
+	switch format {
+	case "", Markdown, JSON, Text:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q (expected %s)", format, strings.Join(Formats, ", "))
+}
+
+// Render formats a tool result: a tools model, a slice of them, a message
+// or a diff. fields optionally selects the top-level JSON fields kept for
+// each object.
+func Render(format string, v interface{}, fields []string) (string, error) {
+	if err := CheckFormat(format); err != nil {
+		return "", err
+	}
+	switch format {
+	case JSON:
+		return renderJSON(v, fields)
+	case Text:
+		return text(v), nil
+	default:
+		return markdown(v), nil
+	}
+}
+
+// renderJSON marshals v as indented JSON, keeping only the selected fields
+func renderJSON(v interface{}, fields []string) (string, error) {
+	// Empty results are [] rather than null
+	if value := reflect.ValueOf(v); value.Kind() == reflect.Slice && value.IsNil() {
+		v = []interface{}{}
+	}
+
+	if len(fields) > 0 {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return "", err
+		}
+		v = selectFields(generic, fields)
+	}
+
+	// Markup is kept as is, e.g. the fences of untrusted text, rather than
+	// escaped for HTML
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return "", fmt.Errorf("failed to render JSON: %w", err)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// selectFields keeps the given keys of an object, or of each object of an array
+func selectFields(v interface{}, fields []string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		selected := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if value, ok := v[field]; ok {
+				selected[field] = value
+			}
+		}
+		return selected
+	case []interface{}:
+		for i, item := range v {
+			v[i] = selectFields(item, fields)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,130 @@
+package render
+
+import (
+	"fmt"
+	"mcp-server/logging"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// logger is the logger of the render subsystem
+var logger = logging.For("render")
+
+// Templates holds the user-defined output templates of the tools, Go
+// text/template files rendered over the structured result of a call
+type Templates struct {
+	byTool map[string]*template.Template
+}
+
+// LoadTemplates parses the template file of each tool. A template that fails
+// to parse is logged and skipped, so its tool keeps the default rendering.
+func LoadTemplates(files map[string]string) *Templates {
+	t := &Templates{byTool: make(map[string]*template.Template)}
+	for tool, path := range files {
+		tmpl, err := template.New(filepath.Base(path)).Funcs(Funcs).ParseFiles(path)
+		if err != nil {
+			logger.Warn("Error loading output template", "tool", tool, "error", err)
+			continue
+		}
+		t.byTool[tool] = tmpl
+	}
+	return t
+}
+
+// Execute renders the result of a tool call with the tool's template. It
+// returns false when the tool has no template or the template fails, in
+// which case the caller falls back to the default rendering.
+func (t *Templates) Execute(tool string, v interface{}) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	tmpl, ok := t.byTool[tool]
+	if !ok {
+		return "", false
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, v); err != nil {
+		logger.Warn("Error rendering output template, using the default rendering", "tool", tool, "error", err)
+		return "", false
+	}
+	return out.String(), true
+}
+
+// Funcs are the helpers available to output templates:
+//
+//	{{date .CreatedAt}}           2006-01-02
+//	{{datetime .CreatedAt}}       RFC 3339 in UTC
+//	{{ago .UpdatedAt}}            3h ago, 2d ago
+//	{{truncate 80 .Body}}         at most 80 characters, ending with "…"
+//	{{link .Title .URL}}          Markdown link, or the text alone without a URL
+//	{{join ", " .Labels}}
+//	{{firstLine .Message}}
+//	{{shortSHA .SHA}}
+var Funcs = template.FuncMap{
+	"date": func(t interface{}) string {
+		if t, ok := timeOf(t); ok {
+			return t.UTC().Format("2006-01-02")
+		}
+		return ""
+	},
+	"datetime": func(t interface{}) string {
+		if t, ok := timeOf(t); ok {
+			return date(t)
+		}
+		return ""
+	},
+	"ago": func(t interface{}) string {
+		if t, ok := timeOf(t); ok {
+			return ago(time.Since(t))
+		}
+		return ""
+	},
+	"truncate": truncate,
+	"link": func(text string, url string) string {
+		if url == "" {
+			return text
+		}
+		return fmt.Sprintf("[%s](%s)", text, url)
+	},
+	"join":      func(sep string, values []string) string { return strings.Join(values, sep) },
+	"firstLine": firstLine,
+	"shortSHA":  shortSHA,
+}
+
+// timeOf accepts the time.Time and *time.Time fields of the models
+func timeOf(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, !t.IsZero()
+	case *time.Time:
+		if t != nil {
+			return *t, !t.IsZero()
+		}
+	}
+	return time.Time{}, false
+}
+
+// ago describes a duration in its largest unit
+func ago(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// truncate shortens text to at most n characters, ending with an ellipsis
+func truncate(n int, text string) string {
+	runes := []rune(text)
+	if n <= 0 || len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,208 @@
+package render
+
+import (
+	"fmt"
+	"mcp-server/tools"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// field is a labelled value of a view
+type field struct {
+	label string
+	value string
+}
+
+// view is the common shape of a rendered object: a title, labelled
+// fields, a link and an optional long body
+type view struct {
+	title  string
+	url    string
+	fields []field
+	body   string
+}
+
+// add appends a field, skipping empty values
+func (v *view) add(label string, value string) {
+	if value != "" {
+		v.fields = append(v.fields, field{label, value})
+	}
+}
+
+// viewOf returns the view of a tools model
+func viewOf(item interface{}) (view, bool) {
+	var v view
+	switch item := item.(type) {
+	case *tools.PullRequest:
+		v.title = fmt.Sprintf("#%d %s", item.Number, item.Title)
+		v.url = item.URL
+		v.add("State", stateOf(item.State, item.Draft, item.Merged))
+		v.add("Author", item.Author)
+		v.add("Branches", item.Head+" → "+item.Base)
+		v.add("Labels", strings.Join(item.Labels, ", "))
+		v.add("Assignees", strings.Join(item.Assignees, ", "))
+		v.add("Reviewers", strings.Join(item.Reviewers, ", "))
+		if item.ChangedFiles > 0 {
+			v.add("Changes", fmt.Sprintf("+%d −%d in %d files", item.Additions, item.Deletions, item.ChangedFiles))
+		}
+		v.add("Created", date(item.CreatedAt))
+		v.add("Updated", date(item.UpdatedAt))
+		v.body = item.Body
+	case *tools.Issue:
+		v.title = fmt.Sprintf("#%d %s", item.Number, item.Title)
+		v.url = item.URL
+		v.add("State", item.State)
+		if item.IsPullRequest {
+			v.add("Type", "pull request")
+		}
+		v.add("Author", item.Author)
+		v.add("Labels", strings.Join(item.Labels, ", "))
+		v.add("Assignees", strings.Join(item.Assignees, ", "))
+		if item.Comments > 0 {
+			v.add("Comments", fmt.Sprint(item.Comments))
+		}
+		v.add("Created", date(item.CreatedAt))
+		v.add("Updated", date(item.UpdatedAt))
+		v.body = item.Body
+	case *tools.Comment:
+		v.title = fmt.Sprintf("Comment by %s", item.Author)
+		v.url = item.URL
+		v.add("Created", date(item.CreatedAt))
+		v.body = item.Body
+	case *tools.Commit:
+		v.title = shortSHA(item.SHA) + " " + firstLine(item.Message)
+		v.url = item.URL
+		v.add("SHA", item.SHA)
+		v.add("Author", item.Author)
+		v.add("Date", date(item.Date))
+		if message := strings.TrimSpace(strings.TrimPrefix(item.Message, firstLine(item.Message))); message != "" {
+			v.body = message
+		}
+	case *tools.Branch:
+		v.title = item.Name
+		v.add("SHA", item.SHA)
+		if item.Protected {
+			v.add("Protected", "yes")
+		}
+	case *tools.Repository:
+		v.title = item.FullName
+		v.url = item.URL
+		v.add("Description", item.Description)
+		if item.Private {
+			v.add("Visibility", "private")
+		} else {
+			v.add("Visibility", "public")
+		}
+		v.add("Default branch", item.DefaultBranch)
+		v.add("Language", item.Language)
+		v.add("Stars", fmt.Sprint(item.Stars))
+	case *tools.Workflow:
+		v.title = item.Name
+		v.url = item.URL
+		v.add("ID", fmt.Sprint(item.ID))
+		v.add("Path", item.Path)
+		v.add("State", item.State)
+	case *tools.Release:
+		v.title = item.TagName
+		if item.Name != "" && item.Name != item.TagName {
+			v.title += " " + item.Name
+		}
+		v.url = item.URL
+		switch {
+		case item.Draft:
+			v.add("State", "draft")
+		case item.Prerelease:
+			v.add("State", "prerelease")
+		}
+		v.add("Author", item.Author)
+		if item.PublishedAt != nil {
+			v.add("Published", date(*item.PublishedAt))
+		}
+		v.body = item.Body
+	case *tools.Tag:
+		v.title = item.Name
+		v.add("Commit", item.SHA)
+	case *tools.CodeResult:
+		v.title = item.Path
+		v.url = item.URL
+		v.add("Repository", item.Repository)
+	case *tools.JiraIssue:
+		v.title = item.Key + " " + item.Summary
+		v.url = item.URL
+		v.add("Status", item.Status)
+		v.add("Assignee", item.Assignee)
+		v.body = item.Description
+	case *tools.NotionPage:
+		v.title = item.Title
+		if v.title == "" {
+			v.title = "Untitled"
+		}
+		v.url = item.URL
+		v.add("ID", item.ID)
+		v.add("Created", date(item.CreatedTime))
+		v.add("Last edited", date(item.LastEditedTime))
+	case *tools.NotionDatabase:
+		v.title = item.Title
+		v.url = item.URL
+		v.add("ID", item.ID)
+		v.add("Created", date(item.CreatedTime))
+		v.add("Last edited", date(item.LastEditedTime))
+		var properties []string
+		for _, property := range item.Properties {
+			properties = append(properties, fmt.Sprintf("- %s (%s)", property.Name, property.Type))
+		}
+		v.body = strings.Join(properties, "\n")
+	default:
+		return view{}, false
+	}
+	return v, true
+}
+
+// items returns the elements of a slice result as pointers, so they match
+// the cases of viewOf
+func items(v interface{}) ([]interface{}, bool) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice {
+		return nil, false
+	}
+	result := make([]interface{}, value.Len())
+	for i := range result {
+		result[i] = value.Index(i).Addr().Interface()
+	}
+	return result, true
+}
+
+// stateOf describes the state of a pull request
+func stateOf(state string, draft bool, merged bool) string {
+	switch {
+	case merged:
+		return "merged"
+	case draft && state == "open":
+		return "draft"
+	default:
+		return state
+	}
+}
+
+// date formats a timestamp, or returns "" for the zero time
+func date(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// shortSHA abbreviates a commit SHA
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// firstLine returns the first line of a text
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
@@ -0,0 +1,258 @@
+// Package resilience protects the server from a slow or failing backend:
+// it caps the concurrent requests sent to it and fails fast with a circuit
+// breaker while it keeps failing.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mcp-server/logging"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// logger is the logger of the resilience subsystem
+var logger = logging.For("resilience")
+
+// Policy configures the concurrency cap and circuit breaker of one backend
+type Policy struct {
+	// MaxConcurrent caps the requests in flight, further requests wait for
+	// a slot until their context is done. Zero means no cap.
+	MaxConcurrent int
+	// FailureThreshold is the number of consecutive failures, requests
+	// without a response or with a 5xx status, that opens the circuit.
+	// Zero disables the breaker.
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a probe request
+	// is let through
+	Cooldown time.Duration
+}
+
+// State is the state of a circuit breaker
+type State int
+
+const (
+	// Closed lets every request through
+	Closed State = iota
+	// HalfOpen lets a single probe request through after the cooldown
+	HalfOpen
+	// Open fails every request without sending it
+	Open
+)
+
+// String implements fmt.Stringer
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "closed"
+}
+
+// OpenError is returned without sending the request while the circuit of
+// a backend is open
+type OpenError struct {
+	Name  string
+	Until time.Time
+}
+
+// Error implements error
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s is currently unavailable, circuit open until %s", e.Name, e.Until.Format(time.RFC3339))
+}
+
+// Backend holds the concurrency slots and circuit breaker of one backend,
+// shared by the transports of all its accounts
+type Backend struct {
+	name   string
+	policy Policy
+	slots  chan struct{}
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewBackend creates the Backend named name
+func NewBackend(name string, policy Policy) *Backend {
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = 30 * time.Second
+	}
+	b := &Backend{name: name, policy: policy}
+	if policy.MaxConcurrent > 0 {
+		b.slots = make(chan struct{}, policy.MaxConcurrent)
+	}
+	return b
+}
+
+// Name returns the name of the backend
+func (b *Backend) Name() string {
+	return b.name
+}
+
+// State returns the current state of the circuit breaker
+func (b *Backend) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !time.Now().Before(b.openUntil) {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// InFlight returns the number of requests holding a concurrency slot
+func (b *Backend) InFlight() int {
+	return len(b.slots)
+}
+
+// allow reports whether a request may be sent, and whether it is the
+// probe of a half-open circuit
+func (b *Backend) allow() (bool, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		if time.Now().Before(b.openUntil) {
+			return false, false, &OpenError{Name: b.name, Until: b.openUntil}
+		}
+		b.state = HalfOpen
+		fallthrough
+	case HalfOpen:
+		if b.probing {
+			// Others wait for the outcome of the probe
+			return false, false, &OpenError{Name: b.name, Until: time.Now().Add(time.Second)}
+		}
+		b.probing = true
+		return true, true, nil
+	}
+	return true, false, nil
+}
+
+// record updates the breaker with the outcome of a request
+func (b *Backend) record(probe bool, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if !failed {
+		if b.state != Closed {
+			logger.Info("Circuit closed, backend recovered", "backend", b.name)
+		}
+		b.state = Closed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == Open {
+		// A request sent before the circuit opened
+		return
+	}
+	if b.state == HalfOpen || b.failures >= b.policy.FailureThreshold {
+		logger.Warn("Circuit opened, failing fast", "backend", b.name, "failures", b.failures, "cooldown", b.policy.Cooldown)
+		b.state = Open
+		b.openUntil = time.Now().Add(b.policy.Cooldown)
+	}
+}
+
+// abandon gives up a probe that got no outcome, letting the next request probe
+func (b *Backend) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// acquire takes a concurrency slot, waiting until ctx is done
+func (b *Backend) acquire(ctx context.Context) error {
+	if b.slots == nil {
+		return nil
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a concurrency slot taken with acquire
+func (b *Backend) release() {
+	if b.slots != nil {
+		<-b.slots
+	}
+}
+
+// Transport is an http.RoundTripper sending requests through a Backend
+type Transport struct {
+	backend *Backend
+	base    http.RoundTripper
+}
+
+// NewTransport creates a new Transport for backend wrapping base
+func NewTransport(backend *Backend, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{backend: backend, base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.backend
+	breaker := b.policy.FailureThreshold > 0
+	var probe bool
+	if breaker {
+		var ok bool
+		var err error
+		if ok, probe, err = b.allow(); !ok {
+			return nil, err
+		}
+	}
+	if err := b.acquire(req.Context()); err != nil {
+		if probe {
+			b.abandon()
+		}
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if breaker {
+		if errors.Is(req.Context().Err(), context.Canceled) {
+			// Requests canceled by their caller say nothing about the backend
+			if probe {
+				b.abandon()
+			}
+		} else {
+			b.record(probe, err != nil || resp.StatusCode >= 500)
+		}
+	}
+	if err != nil {
+		b.release()
+		return nil, err
+	}
+	// The slot is held until the body is read
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: b.release}
+	return resp, nil
+}
+
+// releasingBody releases the concurrency slot of its request when closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close implements io.Closer
+func (r *releasingBody) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
@@ -0,0 +1,150 @@
+// Package sanitize hardens the untrusted text fetched from the services
+// before it reaches the model: issue and pull request bodies, comments, Jira
+// descriptions, Notion titles. It strips what a human reader does not see,
+// fences the text with its provenance, and finds text that looks like
+// instructions to the agent.
+package sanitize
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Fence tags delimiting untrusted text
+const (
+	openTag  = "<untrusted-content"
+	closeTag = "</untrusted-content>"
+)
+
+// htmlComment matches an HTML comment, hidden when the text is rendered.
+// An unterminated one hides the rest of the text.
+var htmlComment = regexp.MustCompile(`(?s)<!--.*?(-->|$)`)
+
+// fenceTag matches the fence tags written in the text itself, which could
+// otherwise end a fence early
+var fenceTag = regexp.MustCompile(`(?i)<(/?)(untrusted-content)`)
+
+// fenceLine matches the fence tags written on lines of their own, as Fence
+// writes them
+var fenceLine = regexp.MustCompile(`(?m)^(<untrusted-content[^\n]*>|</untrusted-content>)$`)
+
+// instructionPatterns match text addressing the agent rather than a human
+// reader
+var instructionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\s+(all\s+|any\s+)?(of\s+)?(the\s+|your\s+)?(previous|prior|above|earlier|preceding|former|system)\s+(instructions|prompts?|messages|rules|directions)`),
+	regexp.MustCompile(`(?i)\byou\s+are\s+now\s+(a|an|in|the)\b`),
+	regexp.MustCompile(`(?i)\bnew\s+(system\s+)?instructions\s*:`),
+	regexp.MustCompile(`(?i)\bsystem\s+prompt\b`),
+	regexp.MustCompile(`(?im)^\s*(system|assistant)\s*:`),
+	regexp.MustCompile(`(?i)</?\s*(system|assistant|instructions?)\s*>`),
+	regexp.MustCompile(`(?i)\b(do\s+not|don't)\s+(tell|inform|alert|notify|mention\s+this\s+to)\s+the\s+user\b`),
+	regexp.MustCompile(`(?i)\b(ai|llm)\s+(agent|assistant|model)s?\b[^.\n]{0,40}\b(must|should|need\s+to|are\s+required\s+to)\b`),
+	regexp.MustCompile(`(?i)\b(call|invoke|use)\s+the\s+[a-z0-9_-]+\s+tool\b`),
+	regexp.MustCompile(`(?i)\b(execute|run)\s+the\s+following\s+(command|commands|code|script)\b`),
+}
+
+// maxMatch bounds the length of a reported instruction match
+const maxMatch = 80
+
+// Provenance describes where an untrusted text comes from
+type Provenance struct {
+	// Source names the text, e.g. "GitHub issue #12 body"
+	Source string
+	Author string
+	URL    string
+}
+
+// Clean removes the invisible characters, the bidirectional controls and
+// the HTML comments of a text, returning the cleaned text and how many
+// characters were removed
+func Clean(text string) (string, int) {
+	cleaned := htmlComment.ReplaceAllString(text, "")
+	removed := len([]rune(text)) - len([]rune(cleaned))
+	cleaned, stripped := StripInvisible(cleaned)
+	return cleaned, removed + stripped
+}
+
+// StripInvisible removes the invisible characters and the bidirectional
+// controls of a text, returning the cleaned text and how many characters
+// were removed. Unlike Clean, it keeps HTML comments, for code where they
+// are visible.
+func StripInvisible(text string) (string, int) {
+	removed := 0
+	cleaned := strings.Map(func(r rune) rune {
+		if invisible(r) {
+			removed++
+			return -1
+		}
+		return r
+	}, text)
+	return cleaned, removed
+}
+
+// invisible reports whether a rune is not shown to a human reader: format
+// characters, which include the zero-width characters, the bidirectional
+// controls and the tag characters, and the fillers and variation selectors
+// used to smuggle text
+func invisible(r rune) bool {
+	switch {
+	case unicode.Is(unicode.Cf, r):
+		return true
+	case r == 0x115f, r == 0x1160, r == 0x3164, r == 0xffa0:
+		return true
+	case r >= 0xe0100 && r <= 0xe01ef:
+		return true
+	}
+	return false
+}
+
+// Fence delimits an untrusted text with tags labelled with its provenance.
+// Fence tags within the text are escaped, so it cannot close the fence.
+func Fence(text string, p Provenance) string {
+	if text == "" {
+		return text
+	}
+	text = fenceTag.ReplaceAllString(text, "&lt;$1$2")
+	var b strings.Builder
+	b.WriteString(openTag)
+	for _, attr := range [][2]string{{"source", p.Source}, {"author", p.Author}, {"url", p.URL}} {
+		if attr[1] != "" {
+			fmt.Fprintf(&b, " %s=%q", attr[0], attr[1])
+		}
+	}
+	b.WriteString(">\n")
+	b.WriteString(strings.TrimSuffix(text, "\n"))
+	b.WriteString("\n" + closeTag)
+	return b.String()
+}
+
+// CloseFence closes the fence a chunk of fenced text leaves open, e.g. when
+// the text is cut into parts, and returns the opening tag continuing the
+// fence at the start of the next chunk, or "" when no fence is left open
+func CloseFence(chunk string) (string, string) {
+	tags := fenceLine.FindAllString(chunk, -1)
+	if len(tags) == 0 || tags[len(tags)-1] == closeTag {
+		return chunk, ""
+	}
+	return strings.TrimSuffix(chunk, "\n") + "\n" + closeTag, tags[len(tags)-1] + "\n"
+}
+
+// Instructions returns the passages of a text that look like instructions
+// to the agent, e.g. "ignore all previous instructions"
+func Instructions(text string) []string {
+	var matches []string
+	seen := make(map[string]bool)
+	for _, pattern := range instructionPatterns {
+		for _, match := range pattern.FindAllString(text, -1) {
+			match = strings.Join(strings.Fields(match), " ")
+			if runes := []rune(match); len(runes) > maxMatch {
+				match = string(runes[:maxMatch]) + "…"
+			}
+			if !seen[strings.ToLower(match)] {
+				seen[strings.ToLower(match)] = true
+				matches = append(matches, match)
+			}
+		}
+	}
+	return matches
+}
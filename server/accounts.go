@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Accounts holds the named clients of one service and the rules used
+// to pick one of them for a tool call.
+type Accounts[T any] struct {
+	service string
+	def     string
+	clients map[string]T
+	routes  []accountRoute
+	// hint is appended to the error returned when no account is configured
+	hint string
+}
+
+// accountRoute routes a routing key (repository owner, Jira project key)
+// matching pattern to the named account.
+type accountRoute struct {
+	pattern string
+	account string
+}
+
+// NewAccounts creates an empty account set for the given service.
+// The first account added becomes the default one.
+func NewAccounts[T any](service string) *Accounts[T] {
+	return &Accounts[T]{
+		service: service,
+		clients: make(map[string]T),
+	}
+}
+
+// Add registers a client under name, routing the given key patterns to it
+func (a *Accounts[T]) Add(name string, client T, patterns ...string) {
+	if len(a.clients) == 0 {
+		a.def = name
+	}
+	a.clients[name] = client
+	for _, pattern := range patterns {
+		a.routes = append(a.routes, accountRoute{pattern: strings.ToLower(pattern), account: name})
+	}
+}
+
+// Names returns the sorted names of the registered accounts
+func (a *Accounts[T]) Names() []string {
+	names := make([]string, 0, len(a.clients))
+	for name := range a.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve picks the client for a tool call. An explicit account name wins,
+// then the first routing rule matching key, then the default account.
+func (a *Accounts[T]) Resolve(name string, key string) (T, error) {
+	var zero T
+	if len(a.clients) == 0 {
+		return zero, fmt.Errorf("no %s account configured%s", a.service, a.hint)
+	}
+
+	if name == "" {
+		name = a.route(key)
+	}
+	client, ok := a.clients[name]
+	if !ok {
+		return zero, fmt.Errorf("unknown %s account %q (available: %s)", a.service, name, strings.Join(a.Names(), ", "))
+	}
+	return client, nil
+}
+
+// route returns the account name routed for key, or the default account
+func (a *Accounts[T]) route(key string) string {
+	key = strings.ToLower(key)
+	if key != "" {
+		for _, r := range a.routes {
+			if ok, _ := path.Match(r.pattern, key); ok {
+				return r.account
+			}
+		}
+	}
+	return a.def
+}
+
+// githubRoutingKey returns the repository owner a GitHub tool call targets.
+// For search tools the owner is taken from an org:, user: or repo: qualifier.
+func githubRoutingKey(args map[string]interface{}) string {
+	if owner, _ := args["owner"].(string); owner != "" {
+		return owner
+	}
+	query, _ := args["query"].(string)
+	for _, field := range strings.Fields(query) {
+		qualifier, value, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		switch qualifier {
+		case "org", "user":
+			return value
+		case "repo":
+			owner, _, _ := strings.Cut(value, "/")
+			return owner
+		}
+	}
+	return ""
+}
+
+// jiraRoutingKey returns the project key a Jira tool call targets
+func jiraRoutingKey(args map[string]interface{}) string {
+	if projectKey, _ := args["projectKey"].(string); projectKey != "" {
+		return projectKey
+	}
+	ticketID, _ := args["ticketID"].(string)
+	if project, _, ok := strings.Cut(ticketID, "-"); ok {
+		return project
+	}
+	return ""
+}
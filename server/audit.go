@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mcp-server/apierror"
+	"mcp-server/audit"
+	"mcp-server/auth"
+	"mcp-server/dryrun"
+	"mcp-server/logging"
+	"mcp-server/tools"
+	"time"
+)
+
+// caller describes the MCP client a request comes from, for the audit log
+type caller struct {
+	Transport string
+	Session   string
+	Client    string
+}
+
+type callerKey struct{}
+
+// withCaller returns a copy of ctx carrying the caller
+func withCaller(ctx context.Context, c *caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+// callerFrom returns the caller carried by ctx
+func callerFrom(ctx context.Context) *caller {
+	if c, ok := ctx.Value(callerKey{}).(*caller); ok {
+		return c
+	}
+	return &caller{}
+}
+
+// clientInfo returns the "name/version" of the client sending initialize
+func clientInfo(request MCPRequest) string {
+	params, _ := request.Params.(map[string]interface{})
+	info, _ := params["clientInfo"].(map[string]interface{})
+	name, _ := info["name"].(string)
+	if version, _ := info["version"].(string); version != "" {
+		name += "/" + version
+	}
+	return name
+}
+
+// auditMiddleware records the write calls in the audit log. Requests
+// intercepted in dry-run mode are recorded as dry runs, not failures. The
+// calls denied by auth and policy or replayed by idempotency never get
+// here; those middleware record them.
+func (s *MCPServer) auditMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		started := time.Now()
+		result, err := next(ctx, call)
+		if err == nil {
+			s.recordAudit(ctx, call.Name, call.Args, result, nil, started)
+			return result, nil
+		}
+		var request *dryrun.Request
+		if dryrun.Enabled(ctx) && errors.As(err, &request) {
+			s.recordAudit(ctx, call.Name, call.Args, nil, nil, started)
+		} else {
+			// The result of a failed call is a nil model
+			s.recordAudit(ctx, call.Name, call.Args, nil, err, started)
+		}
+		return result, err
+	}
+}
+
+// recordAudit appends a write tool call to the audit log
+func (s *MCPServer) recordAudit(ctx context.Context, name string, args map[string]interface{}, result interface{}, err error, started time.Time) {
+	outcome := audit.OutcomeSuccess
+	switch {
+	case err != nil:
+		outcome = audit.OutcomeError
+	case dryrun.Enabled(ctx):
+		outcome = audit.OutcomeDryRun
+	}
+	s.recordOutcome(ctx, name, args, result, err, outcome, started)
+}
+
+// recordOutcome appends a write tool call with the given outcome to the
+// audit log. The middleware returning before the audit middleware is
+// reached, for denials and replays, record their calls with it.
+func (s *MCPServer) recordOutcome(ctx context.Context, name string, args map[string]interface{}, result interface{}, err error, outcome string, started time.Time) {
+	if s.Audit == nil || !writeCall(name, args) {
+		return
+	}
+
+	c := callerFrom(ctx)
+	entry := audit.Entry{
+		Time:      started.UTC(),
+		Transport: c.Transport,
+		Session:   c.Session,
+		Client:    c.Client,
+		Tool:      name,
+		Args:      audit.RedactArgs(args),
+		Target:    auditTarget(name, args, result),
+		Outcome:   outcome,
+		Duration:  float64(time.Since(started).Microseconds()) / 1000,
+	}
+	entry.Account, _ = args["account"].(string)
+	if info, ok := auth.FromContext(ctx); ok {
+		entry.Subject = info.Subject
+		entry.ClientID = info.ClientID
+	}
+	if err != nil {
+		entry.Error = logging.Mask(err.Error())
+	} else {
+		entry.URLs = createdURLs(result)
+	}
+
+	if err := s.Audit.Record(entry); err != nil {
+		logger.ErrorContext(ctx, "Error writing audit log", "error", err)
+	}
+}
+
+// auditTarget identifies the entity a write tool acted on: owner/repo#number
+// or owner/repo@branch on GitHub, the issue key on Jira, the object ID on Notion
+func auditTarget(name string, args map[string]interface{}, result interface{}) string {
+	str := func(key string) string {
+		value, _ := args[key].(string)
+		return value
+	}
+	repo := str("owner") + "/" + str("repo")
+
+	switch result := result.(type) {
+	case *tools.Issue:
+		return fmt.Sprintf("%s#%d", repo, result.Number)
+	case *tools.PullRequest:
+		return fmt.Sprintf("%s#%d", repo, result.Number)
+	case *tools.Branch:
+		return repo + "@" + result.Name
+	case *tools.Repository:
+		return result.FullName
+	case *tools.JiraIssue:
+		return result.Key
+	case *tools.NotionPage:
+		return result.ID
+	case *tools.NotionDatabase:
+		return result.ID
+	}
+
+	switch name {
+	case "github_create_repository":
+		return str("name")
+	case "github_create_branch":
+		return repo + "@" + str("branchName")
+	case "github_run_workflow":
+		return fmt.Sprintf("%s workflow %s@%s", repo, str("workflowID"), str("ref"))
+	case "jira_create_ticket":
+		return "project " + str("projectKey")
+	case "notion_create_page", "notion_create_database":
+		return "parent " + str("parentID") + str("parentPageID")
+	case "notion_update_page":
+		return str("pageID")
+	case "notion_update_database":
+		return str("databaseID")
+	case "undo_action":
+		return "action " + str("id")
+	case "undo_last":
+		return "last action"
+	}
+
+	if number, ok := args["number"].(float64); ok {
+		return fmt.Sprintf("%s#%d", repo, int(number))
+	}
+	return repo
+}
+
+// createdURLs returns the web URLs of the entity a write tool created or changed
+func createdURLs(result interface{}) []string {
+	var url string
+	switch result := result.(type) {
+	case *tools.Issue:
+		url = result.URL
+	case *tools.PullRequest:
+		url = result.URL
+	case *tools.Comment:
+		url = result.URL
+	case *tools.Commit:
+		url = result.URL
+	case *tools.Repository:
+		url = result.URL
+	case *tools.JiraIssue:
+		url = result.URL
+	case *tools.NotionPage:
+		url = result.URL
+	case *tools.NotionDatabase:
+		url = result.URL
+	}
+	if url == "" {
+		return nil
+	}
+	return []string{url}
+}
+
+// auditLog describes the recent audit log entries matching the tool
+// arguments. Authenticated callers only see their own entries unless they
+// have the admin scope.
+func (s *MCPServer) auditLog(ctx context.Context, args map[string]interface{}) (string, error) {
+	if s.Audit == nil {
+		return "Audit logging is not enabled.", nil
+	}
+
+	filter := audit.Filter{}
+	if info, ok := auth.FromContext(ctx); ok && !info.HasScope(adminScope) {
+		if info.Subject == "" {
+			e := apierror.New("", apierror.Forbidden, "the token identifies no subject to show the audit entries of")
+			e.Remediation = fmt.Sprintf("Authorize the client with the %s scope to see every entry", adminScope)
+			return "", e
+		}
+		filter.Subject = info.Subject
+	}
+	filter.Tool, _ = args["tool"].(string)
+	filter.Target, _ = args["target"].(string)
+	filter.Outcome, _ = args["outcome"].(string)
+	if limit, ok := args["limit"].(float64); ok {
+		filter.Limit = int(limit)
+	}
+	if since, _ := args["since"].(string); since != "" {
+		if duration, err := time.ParseDuration(since); err == nil {
+			filter.Since = time.Now().Add(-duration)
+		} else if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return "", fmt.Errorf("invalid since %q: expected a duration like 24h or an RFC 3339 time", since)
+		}
+	}
+
+	entries, err := s.Audit.Recent(filter)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "No audit entries found.", nil
+	}
+
+	var result string
+	for _, entry := range entries {
+		result += fmt.Sprintf("Time: %s\nTool: %s\nTarget: %s\nOutcome: %s\n",
+			entry.Time.Format(time.RFC3339), entry.Tool, entry.Target, entry.Outcome)
+		if entry.Error != "" {
+			result += fmt.Sprintf("Error: %s\n", entry.Error)
+		}
+		for _, url := range entry.URLs {
+			result += fmt.Sprintf("URL: %s\n", url)
+		}
+		caller := entry.Transport
+		for _, detail := range []string{entry.Subject, entry.Client, entry.Session} {
+			if detail != "" {
+				caller += " " + detail
+			}
+		}
+		result += fmt.Sprintf("Caller: %s\n\n", caller)
+	}
+	return result, nil
+}
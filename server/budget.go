@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"mcp-server/auth"
+	"mcp-server/budget"
+	"mcp-server/sanitize"
+)
+
+// outputBudget returns the maximum output size of a tool call in bytes:
+// the max_chars or max_tokens argument, else the configured budget.
+// Zero means unlimited.
+func (s *MCPServer) outputBudget(args map[string]interface{}) int {
+	if chars, ok := args["max_chars"].(float64); ok && chars > 0 {
+		return int(chars)
+	}
+	if tokens, ok := args["max_tokens"].(float64); ok && tokens > 0 {
+		return int(tokens) * budget.CharsPerToken
+	}
+	return s.OutputBudget
+}
+
+// cursorOwner identifies the caller a continuation cursor belongs to, so
+// one client cannot page through the output of another
+func cursorOwner(ctx context.Context) string {
+	info, _ := auth.FromContext(ctx)
+	return subjectOf(info) + "/" + callerFrom(ctx).Session
+}
+
+// budgetMiddleware serves the next chunk of a truncated output for calls
+// with a cursor, and truncates the output text of the other calls
+func (s *MCPServer) budgetMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if call.Args.String("cursor") != "" {
+			return s.continueOutput(ctx, call.Name, call.Args)
+		}
+		result, err := next(ctx, call)
+		if output, ok := result.(string); ok && err == nil {
+			return s.truncateOutput(ctx, call.Name, call.Args, output)
+		}
+		return result, err
+	}
+}
+
+// truncateOutput returns the first chunk of a tool output within the
+// output budget, cut at a file or record boundary, with a footer carrying
+// the cursor of the next chunk. A chunk ending within the fence of untrusted
+// content closes it, and the next chunk reopens it with its provenance.
+func (s *MCPServer) truncateOutput(ctx context.Context, name string, args map[string]interface{}, output string) (string, error) {
+	max := s.outputBudget(args)
+	if s.Cursors == nil || max <= 0 || len(output) <= max {
+		return output, nil
+	}
+	page, err := s.Cursors.First(name, cursorOwner(ctx), output, max, budget.For(name), sanitize.CloseFence)
+	if err != nil {
+		return "", err
+	}
+	return withFooter(name, page), nil
+}
+
+// continueOutput returns the chunk of a truncated tool output following
+// the cursor argument, without calling the upstream service again
+func (s *MCPServer) continueOutput(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	id, _ := args["cursor"].(string)
+	if s.Cursors == nil {
+		return "", fmt.Errorf("cursor %q is unknown or expired; call %s again without a cursor", id, name)
+	}
+	page, err := s.Cursors.Next(id, name, cursorOwner(ctx), s.outputBudget(args), budget.For(name), sanitize.CloseFence)
+	if err != nil {
+		return "", err
+	}
+	return withFooter(name, page), nil
+}
+
+// withFooter appends the position of a chunk and how to fetch the next one
+func withFooter(name string, page budget.Page) string {
+	if page.Cursor == "" {
+		return page.Text + fmt.Sprintf("\n\n[End of output: part %d, bytes %d-%d of %d.]", page.Part, page.Offset, page.End, page.Total)
+	}
+	return page.Text + fmt.Sprintf("\n\n[Output truncated: part %d, bytes %d-%d of %d. Call %s again with cursor %q for the next part.]",
+		page.Part, page.Offset, page.End, page.Total, name, page.Cursor)
+}
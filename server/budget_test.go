@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"mcp-server/budget"
+	"mcp-server/sanitize"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBudgetPagesThroughFencedDiff(t *testing.T) {
+	var diff strings.Builder
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&diff, "diff --git a/file%d.go b/file%d.go\n--- a/file%d.go\n+++ b/file%d.go\n@@ -1,3 +1,3 @@\n", i, i, i, i)
+		for j := 0; j < 8; j++ {
+			fmt.Fprintf(&diff, "-old line %d of file %d\n+new line %d of file %d\n", j, i, j, i)
+		}
+	}
+	provenance := sanitize.Provenance{Source: "GitHub pull request octo/repo#7 diff"}
+	output := sanitize.Fence(diff.String(), provenance)
+	openTag := output[:strings.Index(output, "\n")+1]
+
+	s := &MCPServer{Cursors: budget.NewCursors(time.Minute)}
+	name := "github_get_pull_request_diff"
+	args := map[string]interface{}{"max_chars": float64(700)}
+	cursorPattern := regexp.MustCompile(`cursor "([0-9a-f]+)"`)
+
+	text, err := s.truncateOutput(context.Background(), name, args, output)
+	var parts []string
+	for {
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, text)
+		match := cursorPattern.FindStringSubmatch(text)
+		if match == nil {
+			break
+		}
+		args := map[string]interface{}{"max_chars": float64(700), "cursor": match[1]}
+		text, err = s.continueOutput(context.Background(), name, args)
+	}
+	if len(parts) < 3 {
+		t.Fatalf("got %d parts, want the diff paged through several", len(parts))
+	}
+
+	var content strings.Builder
+	for i, part := range parts {
+		// Each part is fenced on its own, with the provenance of the diff
+		body := part[:strings.LastIndex(part, "\n\n[")]
+		if !strings.HasPrefix(body, openTag) {
+			t.Errorf("part %d does not open the fence with its provenance:\n%s", i+1, body)
+		}
+		if !strings.HasSuffix(body, "\n</untrusted-content>") {
+			t.Errorf("part %d leaves the fence open:\n%s", i+1, body)
+		}
+		if strings.Count(body, "<untrusted-content") != 1 || strings.Count(body, "</untrusted-content>") != 1 {
+			t.Errorf("part %d has unbalanced fence tags:\n%s", i+1, body)
+		}
+		inner := strings.TrimSuffix(strings.TrimPrefix(body, openTag), "\n</untrusted-content>")
+		if i > 0 && !strings.HasPrefix(inner, "diff --git ") {
+			t.Errorf("part %d does not start at a file boundary:\n%s", i+1, inner)
+		}
+		content.WriteString(inner)
+		if i < len(parts)-1 {
+			content.WriteString("\n")
+		}
+	}
+	if got, want := content.String(), strings.TrimSuffix(diff.String(), "\n"); got != want {
+		t.Errorf("parts do not add up to the diff:\n%s\nwant:\n%s", got, want)
+	}
+}
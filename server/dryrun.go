@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"mcp-server/dryrun"
+	"strings"
+)
+
+// isDryRun reports whether a tool call must not change anything: it is a
+// write tool and dry-run mode is configured or requested by the dry_run argument
+func (s *MCPServer) isDryRun(name string, args map[string]interface{}) bool {
+	if !writeCall(name, args) {
+		return false
+	}
+	requested, _ := args["dry_run"].(bool)
+	return s.DryRun || requested
+}
+
+// dryRunMiddleware executes the write calls in dry-run mode after
+// validating their arguments. The clients resolve the targets with reads
+// and the write request is intercepted before it is sent, then described.
+func (s *MCPServer) dryRunMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if !s.isDryRun(call.Name, call.Args) {
+			return next(ctx, call)
+		}
+		if err := s.validateArgs(call.Name, call.Args); err != nil {
+			return nil, err
+		}
+
+		_, err := next(dryrun.WithDryRun(ctx), call)
+		var request *dryrun.Request
+		if !errors.As(err, &request) {
+			if err != nil {
+				return nil, err
+			}
+			return "Dry run: no changes were made and no request would be sent.", nil
+		}
+		return "Dry run: no changes were made. The arguments are valid and the targets exist.\n" +
+			"Request that would be sent:\n\n" + request.String(), nil
+	}
+}
+
+// validateArgs checks the arguments of a tool call against its input schema:
+// required arguments must be set and every argument must have the declared
+// type. An optional argument set to null counts as missing.
+func (s *MCPServer) validateArgs(name string, args map[string]interface{}) error {
+	tool := s.toolDefinition(name)
+	if tool == nil {
+		return fmt.Errorf("unknown tool: %s", name)
+	}
+
+	required, _ := tool.InputSchema["required"].([]string)
+	for _, arg := range required {
+		if value, ok := args[arg]; !ok || value == nil || value == "" {
+			return fmt.Errorf("invalid arguments: %s is required", arg)
+		}
+	}
+
+	properties, _ := tool.InputSchema["properties"].(map[string]interface{})
+	for arg, value := range args {
+		property, ok := properties[arg].(map[string]interface{})
+		if !ok || value == nil {
+			continue
+		}
+		var valid bool
+		switch property["type"] {
+		case "string":
+			_, valid = value.(string)
+		case "number":
+			_, valid = value.(float64)
+		case "integer":
+			number, ok := value.(float64)
+			valid = ok && number == math.Trunc(number)
+		case "boolean":
+			_, valid = value.(bool)
+		case "array":
+			_, valid = value.([]interface{})
+		default:
+			valid = true
+		}
+		if !valid {
+			return fmt.Errorf("invalid arguments: %s must be %s", arg, withArticle(property["type"]))
+		}
+	}
+	return nil
+}
+
+// withArticle returns a schema type with its indefinite article, e.g. "an integer"
+func withArticle(schemaType interface{}) string {
+	name := fmt.Sprint(schemaType)
+	if strings.ContainsAny(name[:1], "aeiou") {
+		return "an " + name
+	}
+	return "a " + name
+}
+
+// toolDefinition returns the definition of a tool, nil for unknown tools
+func (s *MCPServer) toolDefinition(name string) *Tool {
+	for _, definition := range s.getToolDefinitions() {
+		if definition.Name == name {
+			return &definition
+		}
+	}
+	return nil
+}
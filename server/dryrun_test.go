@@ -0,0 +1,51 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateArgs(t *testing.T) {
+	s := &MCPServer{}
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"owner": "octo", "repo": "api", "number": float64(12), "body": "LGTM"}
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		args := valid()
+		args[key] = value
+		return args
+	}
+	without := func(key string) map[string]interface{} {
+		args := valid()
+		delete(args, key)
+		return args
+	}
+
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		wantErr string
+	}{
+		{"valid", valid(), ""},
+		{"integer as a string", with("number", "abc"), "number must be an integer"},
+		{"fractional integer", with("number", 1.5), "number must be an integer"},
+		{"string as a number", with("body", float64(3)), "body must be a string"},
+		{"missing", without("body"), "body is required"},
+		{"empty", with("body", ""), "body is required"},
+		{"null", with("number", nil), "number is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.validateArgs("github_add_comment", tt.args)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateArgs() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateArgs() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"mcp-server/apierror"
+	"mcp-server/metrics"
+	"strings"
+	"time"
+)
+
+// classify returns the classified error of a failed tool call. Errors the
+// clients did not classify are classified by the last upstream response
+// the call got; it returns nil for internal errors.
+func classify(name string, err error, upstream *metrics.Upstream) *apierror.Error {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	service := serviceOf(name)
+	status, failed := upstream.Status()
+	var category apierror.Category
+	switch {
+	case failed:
+		category = apierror.UpstreamUnavailable
+	case status >= 400:
+		category = apierror.CategoryOf(status)
+	case status == 0:
+		// The call failed before reaching the backend, on its arguments
+		category = apierror.Validation
+	default:
+		return nil
+	}
+	e := apierror.New(service, category, err.Error())
+	e.Status = status
+	e.Err = err
+	return e
+}
+
+// errorResult builds the result of a failed tool call. The text describes
+// the error for the model, its _meta carries it for programmatic clients.
+func errorResult(err error, apiErr *apierror.Error) ToolResult {
+	if apiErr == nil {
+		return ToolResult{
+			Content: []ToolContent{{Type: "text", Text: fmt.Sprintf("Error: %v", err)}},
+			IsError: true,
+			Meta:    map[string]interface{}{"error": map[string]interface{}{"code": "internal", "message": err.Error()}},
+		}
+	}
+
+	text := fmt.Sprintf("Error: %s\nCode: %s", apiErr.Message, apiErr.Category)
+	details := map[string]interface{}{
+		"code":    string(apiErr.Category),
+		"message": apiErr.Message,
+	}
+	if apiErr.Service != "" {
+		details["service"] = apiErr.Service
+	}
+	if apiErr.Status != 0 {
+		details["status"] = apiErr.Status
+	}
+	if apiErr.RetryAfter > 0 {
+		text += fmt.Sprintf("\nRetry after: %s", apiErr.RetryAfter.Round(time.Second))
+		details["retry_after_seconds"] = int(apiErr.RetryAfter.Round(time.Second).Seconds())
+	}
+	if apiErr.Remediation != "" {
+		text += "\nRemediation: " + apiErr.Remediation
+		details["remediation"] = apiErr.Remediation
+	}
+	return ToolResult{
+		Content: []ToolContent{{Type: "text", Text: text}},
+		IsError: true,
+		Meta:    map[string]interface{}{"error": details},
+	}
+}
+
+// serviceOf returns the backend of a tool: github, jira or notion, or ""
+// for the tools of the server itself
+func serviceOf(name string) string {
+	service, _, _ := strings.Cut(name, "_")
+	switch service {
+	case "github", "jira", "notion":
+		return service
+	}
+	return ""
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mcp-server/auth"
+	"mcp-server/tracing"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxRequestBodySize limits the size of a JSON-RPC message received over HTTP
+const maxRequestBodySize = 4 << 20
+
+// StartHTTP starts the MCP server on the streamable HTTP transport.
+// JSON-RPC messages are POSTed to /mcp and answered with a JSON body.
+// It returns http.ErrServerClosed after Shutdown.
+func (s *MCPServer) StartHTTP(addr string) error {
+	logger.Info("Starting MCP server on HTTP", "addr", addr)
+
+	if s.MultiUser != nil {
+		s.sessions = newSessionStore(s.MultiUser.Release)
+		idleTimeout := s.MultiUser.IdleTimeout
+		if idleTimeout <= 0 {
+			idleTimeout = defaultSessionIdleTimeout
+		}
+		go s.sessions.runEviction(s.lifecycle().pollers, idleTimeout)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp", s.handleHTTP)
+	if s.MetricsHandler != nil {
+		mux.Handle("/metrics", s.authenticated(s.MetricsHandler))
+	}
+	if s.Auth != nil {
+		if s.Auth.ScopesSupported == nil {
+			s.Auth.ScopesSupported = toolScopes()
+		}
+		mux.HandleFunc("/.well-known/oauth-protected-resource", s.Auth.ServeMetadata)
+		if path := s.Auth.MetadataPath(); path != "/.well-known/oauth-protected-resource" {
+			mux.HandleFunc(path, s.Auth.ServeMetadata)
+		}
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return s.lifecycle().requests },
+	}
+	if !s.setHTTPServer(server) {
+		return http.ErrServerClosed
+	}
+	return server.ListenAndServe()
+}
+
+// authenticated requires a valid bearer token for a handler, when
+// authorization is enabled
+func (s *MCPServer) authenticated(handler http.Handler) http.Handler {
+	if s.Auth == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := s.authenticate(r.Context(), w, r); ok {
+			handler.ServeHTTP(w, r)
+		}
+	})
+}
+
+// authenticate validates the bearer token of a request. When it is not
+// valid, it writes the error response and returns false.
+func (s *MCPServer) authenticate(ctx context.Context, w http.ResponseWriter, r *http.Request) (*auth.Info, bool) {
+	info, err := s.Auth.Authenticate(r)
+	if err != nil {
+		if errors.Is(err, auth.ErrMissingToken) || errors.Is(err, auth.ErrInvalidToken) {
+			s.Auth.Unauthorized(w, err)
+			return nil, false
+		}
+		logger.ErrorContext(ctx, "Error validating access token", "error", err)
+		http.Error(w, "Authorization server unavailable", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return info, true
+}
+
+// handleHTTP handles a JSON-RPC message POSTed to the MCP endpoint
+func (s *MCPServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && (r.Method != http.MethodDelete || s.MultiUser == nil) {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.acquire() {
+		w.Header().Set("Connection", "close")
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.release()
+
+	ctx := withCaller(r.Context(), &caller{Transport: "http", Client: r.UserAgent()})
+	if sc, ok := tracing.ParseTraceparent(r.Header.Get("traceparent")); ok {
+		ctx = tracing.ContextWithRemoteParent(ctx, sc)
+	}
+	var info *auth.Info
+	if s.Auth != nil {
+		var ok bool
+		if info, ok = s.authenticate(ctx, w, r); !ok {
+			return
+		}
+		ctx = auth.NewContext(ctx, info)
+	}
+
+	if r.Method == http.MethodDelete {
+		s.deleteSession(w, r, info)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var request MCPRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeJSON(w, http.StatusBadRequest, newErrorResponse(nil, -32700, "Parse error", nil))
+		return
+	}
+
+	if info != nil && request.Method == "tools/call" {
+		if name, _, errResponse := parseToolCall(request); errResponse == nil && !hasToolScope(info, name) {
+			s.Auth.Forbidden(w, toolScope(name))
+			return
+		}
+	}
+
+	if s.MultiUser != nil {
+		var ok bool
+		if ctx, ok = s.attachSession(ctx, w, r, info, request); !ok {
+			return
+		}
+	}
+
+	response := s.handleRequest(ctx, request)
+	if response == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// attachSession resolves the session of a multi-user request, creating it on
+// initialize, and returns a copy of ctx carrying the session clients
+func (s *MCPServer) attachSession(ctx context.Context, w http.ResponseWriter, r *http.Request, info *auth.Info, request MCPRequest) (context.Context, bool) {
+	subject := subjectOf(info)
+
+	var sess *session
+	if request.Method == "initialize" {
+		var err error
+		sess, err = s.sessions.create(subject)
+		if err != nil {
+			logger.ErrorContext(ctx, "Error creating session", "error", err)
+			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+			return nil, false
+		}
+		w.Header().Set("Mcp-Session-Id", sess.id)
+		sess.client = clientInfo(request)
+	} else {
+		id := r.Header.Get("Mcp-Session-Id")
+		if id == "" {
+			http.Error(w, "Missing Mcp-Session-Id header", http.StatusBadRequest)
+			return nil, false
+		}
+		var ok bool
+		if sess, ok = s.sessions.get(id, subject); !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return nil, false
+		}
+	}
+
+	c := callerFrom(ctx)
+	c.Session = sess.id
+	if sess.client != "" {
+		c.Client = sess.client
+	}
+
+	clients, err := s.sessionClients(sess, r)
+	if err != nil {
+		http.Error(w, "Invalid upstream credentials: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return withClients(ctx, clients), true
+}
+
+// deleteSession terminates the session named by the Mcp-Session-Id header
+func (s *MCPServer) deleteSession(w http.ResponseWriter, r *http.Request, info *auth.Info) {
+	if !s.sessions.remove(r.Header.Get("Mcp-Session-Id"), subjectOf(info)) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// subjectOf returns the authenticated subject, or "" for anonymous callers
+func subjectOf(info *auth.Info) string {
+	if info == nil {
+		return ""
+	}
+	return info.Subject
+}
+
+// writeJSON writes v as a JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Error writing JSON response", "error", err)
+	}
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mcp-server/apierror"
+	"mcp-server/audit"
+	"mcp-server/auth"
+	"mcp-server/cache"
+	"mcp-server/dryrun"
+	"mcp-server/idempotency"
+	"mcp-server/tools"
+	"strings"
+	"time"
+)
+
+// createTools lists the write tools creating an entity, which accept an
+// idempotency key
+var createTools = map[string]bool{
+	"github_create_issue":        true,
+	"github_create_pull_request": true,
+	"github_create_branch":       true,
+	"github_create_repository":   true,
+	"jira_create_ticket":         true,
+	"notion_create_page":         true,
+	"notion_create_database":     true,
+}
+
+// presentationArgs are the arguments changing how the result of a call is
+// shown rather than what the call does, left out of its fingerprint
+var presentationArgs = map[string]bool{
+	"idempotency_key": true,
+	"format":          true,
+	"fields":          true,
+	"max_tokens":      true,
+	"max_chars":       true,
+	"cursor":          true,
+}
+
+// idempotencyMiddleware returns the entity created by an earlier call with
+// the same idempotency key instead of creating another. Calls without a
+// key return an entity with the same title created within the duplicate
+// window, if any.
+func (s *MCPServer) idempotencyMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if !createTools[call.Name] || dryrun.Enabled(ctx) {
+			return next(ctx, call)
+		}
+		started := time.Now()
+		if key := call.Args.String("idempotency_key"); key != "" && s.Idempotency != nil {
+			return s.callOnce(ctx, call, key, next, started)
+		}
+		if s.DuplicateWindow > 0 {
+			if duplicate := s.findDuplicate(ctx, call); duplicate != nil {
+				target := auditTarget(call.Name, call.Args, duplicate)
+				s.recordOutcome(ctx, call.Name, call.Args, duplicate, nil, audit.OutcomeReplayed, started)
+				call.SetMeta("idempotency", map[string]interface{}{"duplicate_of": target})
+				call.Note("Returned %s, created with the same title in the last %s, instead of creating a duplicate. To create another one anyway, call again with an idempotency_key.",
+					target, s.DuplicateWindow)
+				return duplicate, nil
+			}
+		}
+		return next(ctx, call)
+	}
+}
+
+// callOnce creates the entity of a call with an idempotency key, unless an
+// earlier call with the key did
+func (s *MCPServer) callOnce(ctx context.Context, call *Call, key string, next Handler, started time.Time) (interface{}, error) {
+	// Keys are scoped to the caller, so callers cannot see each other's entities
+	info, _ := auth.FromContext(ctx)
+	storeKey := subjectOf(info) + "/" + key
+	release, err := s.Idempotency.Acquire(ctx, storeKey)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	fingerprint := argsFingerprint(call.Name, call.Args)
+	if entry, ok := s.Idempotency.Get(storeKey); ok {
+		if entry.Tool != call.Name || entry.Fingerprint != fingerprint {
+			e := apierror.New(serviceOf(call.Name), apierror.Conflict, fmt.Sprintf("idempotency key %q was already used for another %s call", key, entry.Tool))
+			e.Remediation = "Use a new idempotency key for each distinct create call, and the same one only to retry it"
+			s.recordOutcome(ctx, call.Name, call.Args, nil, e, audit.OutcomeError, started)
+			return nil, e
+		}
+		result := resultModel(call.Name)
+		if err := json.Unmarshal(entry.Result, result); err != nil {
+			return nil, fmt.Errorf("invalid result stored for idempotency key %q: %w", key, err)
+		}
+		s.recordOutcome(ctx, call.Name, call.Args, result, nil, audit.OutcomeReplayed, started)
+		call.SetMeta("idempotency", map[string]interface{}{"key": key, "replayed": true, "created_at": entry.CreatedAt})
+		call.Note("Returned %s, created by an earlier call with idempotency key %q at %s. Nothing new was created.",
+			auditTarget(call.Name, call.Args, result), key, entry.CreatedAt.Format(time.RFC3339))
+		return result, nil
+	}
+
+	result, err := next(ctx, call)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(result)
+	if err == nil {
+		err = s.Idempotency.Put(storeKey, idempotency.Entry{Tool: call.Name, Fingerprint: fingerprint, Result: data})
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Error saving idempotency key", "error", err)
+	}
+	call.SetMeta("idempotency", map[string]interface{}{"key": key, "replayed": false})
+	return result, nil
+}
+
+// argsFingerprint hashes the tool and the arguments of a call that decide
+// what it creates
+func argsFingerprint(name string, args Args) string {
+	significant := map[string]interface{}{"tool": name}
+	for arg, value := range args {
+		if !presentationArgs[arg] {
+			significant[arg] = value
+		}
+	}
+	// Maps are marshaled with sorted keys
+	data, _ := json.Marshal(significant)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// resultModel returns a new result of a create tool, to decode a stored one
+func resultModel(name string) interface{} {
+	switch name {
+	case "github_create_issue":
+		return &tools.Issue{}
+	case "github_create_pull_request":
+		return &tools.PullRequest{}
+	case "github_create_branch":
+		return &tools.Branch{}
+	case "github_create_repository":
+		return &tools.Repository{}
+	case "jira_create_ticket":
+		return &tools.JiraIssue{}
+	case "notion_create_page":
+		return &tools.NotionPage{}
+	case "notion_create_database":
+		return &tools.NotionDatabase{}
+	}
+	return &map[string]interface{}{}
+}
+
+// findDuplicate looks for an entity with the title of a create call
+// created within the duplicate window, in case an earlier call created it
+// but its caller never got the result. GitHub issues, Jira tickets and
+// Notion pages are checked; failed lookups are logged and ignored.
+func (s *MCPServer) findDuplicate(ctx context.Context, call *Call) interface{} {
+	args := call.Args
+	since := time.Now().Add(-s.DuplicateWindow)
+	clients := s.clients(ctx)
+	// Entities created moments ago may not be in cached responses yet
+	ctx = cache.WithBypass(ctx)
+
+	var err error
+	switch call.Name {
+	case "github_create_issue":
+		var client tools.GithubTool
+		if client, err = clients.Github.Resolve(args.String("account"), githubRoutingKey(args)); err != nil {
+			break
+		}
+		var issues []tools.Issue
+		if issues, err = client.ListRecentIssues(ctx, args.String("owner"), args.String("repo"), since); err != nil {
+			break
+		}
+		for _, issue := range issues {
+			if sameTitle(issue.Title, args.String("title")) {
+				return &issue
+			}
+		}
+
+	case "jira_create_ticket":
+		var client tools.JiraTool
+		if client, err = clients.Jira.Resolve(args.String("account"), jiraRoutingKey(args)); err != nil {
+			break
+		}
+		minutes := int(math.Ceil(s.DuplicateWindow.Minutes()))
+		project := strings.ReplaceAll(args.String("projectKey"), `"`, `\"`)
+		jql := fmt.Sprintf(`project = "%s" AND created >= "-%dm" ORDER BY created DESC`, project, minutes)
+		var tickets []tools.JiraIssue
+		if tickets, err = client.SearchTickets(ctx, jql); err != nil {
+			break
+		}
+		for _, ticket := range tickets {
+			if sameTitle(ticket.Summary, args.String("summary")) {
+				return &ticket
+			}
+		}
+
+	case "notion_create_page":
+		var client tools.NotionTool
+		if client, err = clients.Notion.Resolve(args.String("account"), ""); err != nil {
+			break
+		}
+		var pages []tools.NotionPage
+		if pages, err = client.SearchPagesByTitle(ctx, args.String("title")); err != nil {
+			break
+		}
+		for _, page := range pages {
+			if page.CreatedTime.Before(since) || !sameTitle(page.Title, args.String("title")) {
+				continue
+			}
+			var ancestors []string
+			if ancestors, err = client.Ancestors(ctx, "page", page.ID); err != nil {
+				break
+			}
+			if len(ancestors) > 0 && sameNotionID(ancestors[0], args.String("parentID")) {
+				return &page
+			}
+		}
+	}
+	if err != nil {
+		logger.WarnContext(ctx, "Error looking for a duplicate, creating anyway", "error", err)
+	}
+	return nil
+}
+
+// sameTitle reports whether two titles are the same but for case and spacing
+func sameTitle(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+// sameNotionID reports whether two Notion IDs are the same, with or without dashes
+func sameNotionID(a, b string) bool {
+	return strings.EqualFold(strings.ReplaceAll(a, "-", ""), strings.ReplaceAll(b, "-", ""))
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"mcp-server/apierror"
+	"mcp-server/idempotency"
+	"mcp-server/tools"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	store, err := idempotency.Open("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &MCPServer{Idempotency: store}
+
+	created := 0
+	handler := s.idempotencyMiddleware(func(ctx context.Context, call *Call) (interface{}, error) {
+		created++
+		return &tools.Issue{Number: created, Title: call.Args.String("title")}, nil
+	})
+	call := func(args Args) (interface{}, error) {
+		return handler(context.Background(), &Call{Name: "github_create_issue", Args: args})
+	}
+	args := func(title string, format string) Args {
+		return Args{"owner": "octo", "repo": "api", "title": title, "idempotency_key": "retry-1", "format": format}
+	}
+
+	first, err := call(args("Crash on start", "markdown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A retry, shown in another format, returns the issue created first
+	retried, err := call(args("Crash on start", "json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 || retried.(*tools.Issue).Number != first.(*tools.Issue).Number {
+		t.Errorf("created %d issues, retry returned %+v, want the first issue", created, retried)
+	}
+
+	// The same key for another call is a conflict
+	_, err = call(args("Another bug", "markdown"))
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.Category != apierror.Conflict {
+		t.Errorf("error = %v, want a conflict", err)
+	}
+	if created != 1 {
+		t.Errorf("created %d issues, want the conflicting call refused", created)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"mcp-server/apierror"
+	"mcp-server/metrics"
+	"time"
+)
+
+// Metrics are the Prometheus metrics of the MCP requests and tool calls
+type Metrics struct {
+	Registry *metrics.Registry
+
+	calls    *metrics.Counter
+	errors   *metrics.Counter
+	duration *metrics.Histogram
+	inFlight *metrics.Gauge
+}
+
+// NewMetrics registers the server metrics on a registry
+func NewMetrics(registry *metrics.Registry) *Metrics {
+	m := &Metrics{
+		Registry: registry,
+		calls:    registry.Counter("mcp_tool_calls_total", "Tool calls by tool and outcome.", "tool", "outcome"),
+		errors:   registry.Counter("mcp_tool_errors_total", "Failed tool calls by tool and error class.", "tool", "class"),
+		duration: registry.Histogram("mcp_tool_call_duration_seconds", "Tool call latency.", metrics.DefaultBuckets, "tool"),
+		inFlight: registry.Gauge("mcp_in_flight_requests", "JSON-RPC requests being handled."),
+	}
+	m.inFlight.Set(0)
+	return m
+}
+
+// observeCall records a finished tool call
+func (m *Metrics) observeCall(name string, err error, class string, started time.Time) {
+	if m == nil {
+		return
+	}
+	m.duration.Observe(time.Since(started).Seconds(), name)
+	if err == nil {
+		m.calls.Inc(name, "success")
+		return
+	}
+	m.calls.Inc(name, "error")
+	m.errors.Inc(name, class)
+}
+
+// metricsMiddleware counts and times the tool calls
+func (s *MCPServer) metricsMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		started := time.Now()
+		result, err := next(ctx, call)
+		var class string
+		if err != nil {
+			class = errorClass(err, classify(call.Name, err, call.upstream))
+		}
+		s.Metrics.observeCall(call.Name, err, class, started)
+		return result, err
+	}
+}
+
+// track counts a request in flight until the returned function is called
+func (m *Metrics) track() func() {
+	if m == nil {
+		return func() {}
+	}
+	m.inFlight.Add(1)
+	return func() { m.inFlight.Add(-1) }
+}
+
+// errorClass returns the metric class of a failed tool call: its category,
+// or timeout, canceled and internal for the errors outside the taxonomy
+func errorClass(err error, apiErr *apierror.Error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case apiErr != nil:
+		return string(apiErr.Category)
+	}
+	return "internal"
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mcp-server/apierror"
+	"mcp-server/audit"
+	"mcp-server/auth"
+	"mcp-server/cache"
+	"mcp-server/logging"
+	"mcp-server/metrics"
+	"time"
+)
+
+// Call is a tool call going through the middleware chain
+type Call struct {
+	Name string
+	Args Args
+	// Meta is returned as the _meta of the result, for the details of how
+	// the call was served that programmatic clients may need
+	Meta map[string]interface{}
+	// Notes are prepended to the output text, for what the model must know
+	// about how the call was served
+	Notes []string
+
+	// upstream records the upstream responses the call got, to classify its error
+	upstream *metrics.Upstream
+}
+
+// SetMeta sets a key of the _meta of the result
+func (c *Call) SetMeta(key string, value interface{}) {
+	if c.Meta == nil {
+		c.Meta = make(map[string]interface{})
+	}
+	c.Meta[key] = value
+}
+
+// Note adds a note to the output text
+func (c *Call) Note(format string, args ...interface{}) {
+	c.Notes = append(c.Notes, fmt.Sprintf(format, args...))
+}
+
+// Args are the arguments of a tool call, as decoded from JSON
+type Args map[string]interface{}
+
+// String returns a string argument, "" when missing or of another type
+func (a Args) String(key string) string {
+	value, _ := a[key].(string)
+	return value
+}
+
+// Int returns a number argument, 0 when missing or of another type
+func (a Args) Int(key string) int {
+	value, _ := a[key].(float64)
+	return int(value)
+}
+
+// Bool returns a boolean argument, false when missing or of another type
+func (a Args) Bool(key string) bool {
+	value, _ := a[key].(bool)
+	return value
+}
+
+// Strings returns the strings of an array argument
+func (a Args) Strings(key string) []string {
+	list, _ := a[key].([]interface{})
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		if value, ok := item.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Handler executes a tool call. The result is a tools model until the
+// render middleware turns it into the output text.
+type Handler func(ctx context.Context, call *Call) (interface{}, error)
+
+// Middleware wraps the execution of tool calls. It can act before and
+// after calling next, change the context, arguments, result and error, or
+// return without calling next to short-circuit the call.
+type Middleware func(next Handler) Handler
+
+// Hooks builds a middleware from a before and an after hook, both optional.
+// Before runs first; a non-nil result or error short-circuits the call
+// with them. After runs once the call returned and may replace its result
+// and error.
+type Hooks struct {
+	Before func(ctx context.Context, call *Call) (interface{}, error)
+	After  func(ctx context.Context, call *Call, result interface{}, err error) (interface{}, error)
+}
+
+// Middleware returns the middleware running the hooks
+func (h Hooks) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			if h.Before != nil {
+				if result, err := h.Before(ctx, call); result != nil || err != nil {
+					return result, err
+				}
+			}
+			result, err := next(ctx, call)
+			if h.After != nil {
+				result, err = h.After(ctx, call, result, err)
+			}
+			return result, err
+		}
+	}
+}
+
+// DefaultMiddleware is the order of the built-in middleware, outermost first:
+//
+//	metrics     counts and times the calls
+//	auth        denies tools outside the scopes of the caller's token
+//	timeout     applies the deadline configured for the tool
+//	policy      denies the calls the configured policy does not allow
+//	budget      truncates long outputs and serves continuation cursors
+//	redact      masks credentials in outputs, notes and errors
+//	dryrun      validates write calls and intercepts their requests
+//	render      formats the result as Markdown, JSON, text or a template
+//	sanitize    strips hidden text from upstream content and fences it
+//	idempotency returns the entity of a retried create instead of a duplicate
+//	undo        records how to revert the write calls in the undo journal
+//	audit       records the write calls in the audit log
+//	cache       skips the response cache for calls with fresh set
+var DefaultMiddleware = []string{"metrics", "auth", "timeout", "policy", "budget", "redact", "dryrun", "render", "sanitize", "idempotency", "undo", "audit", "cache"}
+
+// builtinMiddleware returns the built-in middleware of a name
+func (s *MCPServer) builtinMiddleware(name string) (Middleware, bool) {
+	switch name {
+	case "metrics":
+		return s.metricsMiddleware, true
+	case "auth":
+		return s.authMiddleware, true
+	case "policy":
+		return s.policyMiddleware, true
+	case "timeout":
+		return s.timeoutMiddleware, true
+	case "redact":
+		return redactMiddleware, true
+	case "budget":
+		return s.budgetMiddleware, true
+	case "dryrun":
+		return s.dryRunMiddleware, true
+	case "render":
+		return s.renderMiddleware, true
+	case "sanitize":
+		return s.sanitizeMiddleware, true
+	case "idempotency":
+		return s.idempotencyMiddleware, true
+	case "undo":
+		return s.undoMiddleware, true
+	case "audit":
+		return s.auditMiddleware, true
+	case "cache":
+		return cacheMiddleware, true
+	}
+	return nil, false
+}
+
+// CheckMiddleware checks a list of built-in middleware names
+func CheckMiddleware(names []string) error {
+	s := &MCPServer{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := s.builtinMiddleware(name); !ok {
+			return fmt.Errorf("unknown middleware %q (expected one of %v)", name, DefaultMiddleware)
+		}
+		if seen[name] {
+			return fmt.Errorf("middleware %q is listed twice", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// orderedMiddleware are built-in middleware whose relative order matters,
+// outermost first: budget cuts the text redact masked, redact masks the
+// text render made of the result, and sanitize cleans the tools models
+// before render turns them into text
+var orderedMiddleware = []string{"budget", "redact", "render", "sanitize"}
+
+// CheckMiddlewareOrder checks that the configured middleware order keeps
+// the middleware of the enabled safeguards, in working order: a list
+// leaving out auth, policy, redact, dryrun, render, idempotency, undo,
+// audit or sanitize would silently turn off the authorization, policy,
+// redaction, dry-run mode, rendering, idempotency keys, undo journal,
+// audit log or sanitization the server is configured with
+func (s *MCPServer) CheckMiddlewareOrder() error {
+	if s.MiddlewareOrder == nil {
+		return nil
+	}
+	// dryrun is always required, as write tools accept the dry_run
+	// argument, and so is render, without which nothing is redacted
+	enabled := map[string]bool{
+		"auth":        s.Auth != nil,
+		"policy":      s.Policy != nil,
+		"redact":      true,
+		"dryrun":      true,
+		"render":      true,
+		"idempotency": s.Idempotency != nil || s.DuplicateWindow > 0,
+		"undo":        s.Undo != nil,
+		"audit":       s.Audit != nil,
+		"sanitize":    s.Sanitize != nil,
+	}
+	position := make(map[string]int)
+	for i, name := range s.MiddlewareOrder {
+		position[name] = i
+	}
+	for _, name := range DefaultMiddleware {
+		if _, listed := position[name]; enabled[name] && !listed {
+			return fmt.Errorf("middleware %q is required by the configuration but missing from the middleware list", name)
+		}
+	}
+
+	previous := ""
+	for _, name := range orderedMiddleware {
+		if _, listed := position[name]; !listed {
+			continue
+		}
+		if previous != "" && position[name] < position[previous] {
+			return fmt.Errorf("middleware %q must be listed after %q", name, previous)
+		}
+		previous = name
+	}
+	return nil
+}
+
+// Use adds middleware around the execution of tool calls, inside the
+// built-in middleware and the middleware added before
+func (s *MCPServer) Use(middleware ...Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// chain returns the handler of tool calls: the built-in middleware in the
+// configured order, then the added middleware, around executeTool
+func (s *MCPServer) chain() Handler {
+	names := s.MiddlewareOrder
+	if names == nil {
+		names = DefaultMiddleware
+	}
+	chain := make([]Middleware, 0, len(names)+len(s.middleware))
+	for _, name := range names {
+		if m, ok := s.builtinMiddleware(name); ok {
+			chain = append(chain, m)
+		}
+	}
+	chain = append(chain, s.middleware...)
+
+	handler := Handler(func(ctx context.Context, call *Call) (interface{}, error) {
+		return s.executeTool(ctx, call.Name, call.Args)
+	})
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	return handler
+}
+
+// authMiddleware denies the tools outside the scopes of the caller's token
+func (s *MCPServer) authMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if info, ok := auth.FromContext(ctx); ok && !hasToolScope(info, call.Name) {
+			err := apierror.New("", apierror.Forbidden, fmt.Sprintf("tool %s requires the %s scope", call.Name, toolScope(call.Name)))
+			err.Remediation = fmt.Sprintf("Authorize the client with the %s scope", toolScope(call.Name))
+			s.recordOutcome(ctx, call.Name, call.Args, nil, err, audit.OutcomeDenied, time.Now())
+			return nil, err
+		}
+		return next(ctx, call)
+	}
+}
+
+// timeoutMiddleware applies the deadline configured for the tool
+func (s *MCPServer) timeoutMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if timeout := s.ToolTimeouts[call.Name]; timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return next(ctx, call)
+	}
+}
+
+// redactMiddleware masks the server's credentials and the credentials of
+// well-known formats in the output text, the notes and the error of a
+// call, and reports what it masked in the result metadata. It runs inside
+// budget, so the parts served from cursors are masked too.
+func redactMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		result, err := next(ctx, call)
+		var redactions []logging.Redaction
+		mask := func(text string) string {
+			masked, found := logging.Redact(text)
+			redactions = append(redactions, found...)
+			return masked
+		}
+		if output, ok := result.(string); ok {
+			result = mask(output)
+		}
+		for i, note := range call.Notes {
+			call.Notes[i] = mask(note)
+		}
+		if err != nil {
+			err = redactError(err, mask)
+		}
+
+		if redactions = mergeRedactions(redactions); len(redactions) > 0 {
+			call.SetMeta("redactions", redactions)
+			logger.WarnContext(ctx, "Masked credentials in tool output", "redactions", redactions)
+		}
+		return result, err
+	}
+}
+
+// redactError masks the message of an error, keeping its classification
+func redactError(err error, mask func(string) string) error {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		masked := *apiErr
+		masked.Message = mask(apiErr.Message)
+		masked.Remediation = mask(apiErr.Remediation)
+		return &masked
+	}
+	if message := mask(err.Error()); message != err.Error() {
+		return &maskedError{message: message, err: err}
+	}
+	return err
+}
+
+// mergeRedactions sums the counts of the redactions of the same kind
+func mergeRedactions(redactions []logging.Redaction) []logging.Redaction {
+	var merged []logging.Redaction
+	index := make(map[string]int)
+	for _, r := range redactions {
+		if i, ok := index[r.Kind]; ok {
+			merged[i].Count += r.Count
+			continue
+		}
+		index[r.Kind] = len(merged)
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// maskedError is an error whose message had credentials masked
+type maskedError struct {
+	message string
+	err     error
+}
+
+// Error implements error
+func (e *maskedError) Error() string {
+	return e.message
+}
+
+// Unwrap returns the original error
+func (e *maskedError) Unwrap() error {
+	return e.err
+}
+
+// cacheMiddleware makes the upstream reads of calls with the fresh
+// argument skip the response cache
+func cacheMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if call.Args.Bool("fresh") {
+			ctx = cache.WithBypass(ctx)
+		}
+		return next(ctx, call)
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"mcp-server/idempotency"
+	"mcp-server/undo"
+	"strings"
+	"testing"
+	"time"
+)
+
+// middlewareWithout returns the default middleware without name
+func middlewareWithout(name string) []string {
+	var names []string
+	for _, other := range DefaultMiddleware {
+		if other != name {
+			names = append(names, other)
+		}
+	}
+	return names
+}
+
+func TestCheckMiddlewareOrder(t *testing.T) {
+	swapped := func(a, b string) []string {
+		names := append([]string(nil), DefaultMiddleware...)
+		for i, name := range names {
+			switch name {
+			case a:
+				names[i] = b
+			case b:
+				names[i] = a
+			}
+		}
+		return names
+	}
+
+	tests := []struct {
+		name    string
+		order   []string
+		wantErr string
+	}{
+		{"default", nil, ""},
+		{"listed default", DefaultMiddleware, ""},
+		{"without metrics", middlewareWithout("metrics"), ""},
+		{"without budget", middlewareWithout("budget"), ""},
+		{"without redact", middlewareWithout("redact"), `"redact" is required`},
+		{"without dryrun", middlewareWithout("dryrun"), `"dryrun" is required`},
+		{"without render", middlewareWithout("render"), `"render" is required`},
+		{"redact inside render", swapped("redact", "render"), `"render" must be listed after "redact"`},
+		{"sanitize outside render", swapped("render", "sanitize"), `"sanitize" must be listed after "render"`},
+		{"budget inside redact", swapped("budget", "redact"), `"redact" must be listed after "budget"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &MCPServer{MiddlewareOrder: tt.order}
+			err := s.CheckMiddlewareOrder()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckMiddlewareOrder() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckMiddlewareOrder() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckMiddlewareOrderConfigured(t *testing.T) {
+	s := &MCPServer{MiddlewareOrder: middlewareWithout("sanitize"), Sanitize: &SanitizeOptions{}}
+	if err := s.CheckMiddlewareOrder(); err == nil || !strings.Contains(err.Error(), `"sanitize" is required`) {
+		t.Errorf("CheckMiddlewareOrder() error = %v, want sanitize required", err)
+	}
+	s.Sanitize = nil
+	if err := s.CheckMiddlewareOrder(); err != nil {
+		t.Errorf("CheckMiddlewareOrder() error = %v, want sanitize optional when disabled", err)
+	}
+}
+
+func TestCheckMiddlewareOrderWriteSafeguards(t *testing.T) {
+	store, err := idempotency.Open("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, err := undo.Open("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		server *MCPServer
+		leave  string
+	}{
+		{"idempotency store", &MCPServer{Idempotency: store}, "idempotency"},
+		{"duplicate window", &MCPServer{DuplicateWindow: time.Minute}, "idempotency"},
+		{"undo journal", &MCPServer{Undo: journal}, "undo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.server.MiddlewareOrder = middlewareWithout(tt.leave)
+			if err := tt.server.CheckMiddlewareOrder(); err == nil || !strings.Contains(err.Error(), `"`+tt.leave+`" is required`) {
+				t.Errorf("CheckMiddlewareOrder() error = %v, want %s required", err, tt.leave)
+			}
+			if err := (&MCPServer{MiddlewareOrder: middlewareWithout(tt.leave)}).CheckMiddlewareOrder(); err != nil {
+				t.Errorf("CheckMiddlewareOrder() error = %v, want %s optional when not configured", err, tt.leave)
+			}
+		})
+	}
+}
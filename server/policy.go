@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"mcp-server/apierror"
+	"mcp-server/audit"
+	"mcp-server/policy"
+	"strings"
+	"time"
+)
+
+// policyMiddleware denies the calls the policy does not allow, before they
+// reach the backends
+func (s *MCPServer) policyMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if s.Policy == nil {
+			return next(ctx, call)
+		}
+		started := time.Now()
+		decision, err := s.Policy.Evaluate(s.policyRequest(ctx, call.Name, call.Args))
+		if err != nil {
+			return nil, err
+		}
+		if !decision.Allowed {
+			logger.WarnContext(ctx, "Tool call denied by policy", "reason", decision.Reason)
+			e := apierror.New(serviceOf(call.Name), apierror.Forbidden, fmt.Sprintf("policy denies %s: %s", call.Name, decision.Reason))
+			e.Remediation = "Call policy_explain with the same tool and arguments to see the rules, or ask the server administrator to change the policy"
+			s.recordOutcome(ctx, call.Name, call.Args, nil, e, audit.OutcomeDenied, started)
+			return nil, e
+		}
+		return next(ctx, call)
+	}
+}
+
+// policyRequest describes the target of a tool call for the policy
+func (s *MCPServer) policyRequest(ctx context.Context, name string, args Args) policy.Request {
+	req := policy.Request{Tool: name, Write: writeCall(name, args)}
+	if strings.HasPrefix(name, "github_") && (args.String("owner") != "" || args.String("repo") != "") {
+		req.Repo = args.String("owner") + "/" + args.String("repo")
+	}
+
+	var kind string
+	switch name {
+	case "github_create_repository":
+		req.Repo = args.String("name")
+	case "github_create_branch":
+		req.Branch, req.UsesBranch = args.String("branchName"), true
+	case "github_create_pull_request":
+		// The head of a pull request from a fork is owner:branch
+		head := args.String("head")
+		req.Branch, req.UsesBranch = head[strings.Index(head, ":")+1:], true
+	case "github_run_workflow":
+		req.Branch, req.UsesBranch = args.String("ref"), true
+	case "jira_create_ticket":
+		req.Project = args.String("projectKey")
+	case "notion_create_page":
+		req.Page, kind = args.String("parentID"), "page"
+	case "notion_create_database":
+		req.Page, kind = args.String("parentPageID"), "page"
+	case "notion_update_page":
+		req.Page, kind = args.String("pageID"), "page"
+	case "notion_update_database":
+		req.Page, kind = args.String("databaseID"), "database"
+	}
+	if req.Page != "" {
+		req.Ancestors = func() ([]string, error) {
+			client, err := s.clients(ctx).Notion.Resolve(args.String("account"), "")
+			if err != nil {
+				return nil, err
+			}
+			return client.Ancestors(ctx, kind, req.Page)
+		}
+	}
+	return req
+}
+
+// policyExplain explains whether the policy allows a tool call, and why
+func (s *MCPServer) policyExplain(ctx context.Context, args Args) (string, error) {
+	name := args.String("tool")
+	if s.toolDefinition(name) == nil {
+		return "", apierror.Invalid("", "unknown tool: %s", name)
+	}
+	if s.Policy == nil {
+		return fmt.Sprintf("Decision: allowed\nReason: no policy is configured, %s may be called\n", name), nil
+	}
+
+	arguments, _ := args["arguments"].(map[string]interface{})
+	decision, err := s.Policy.Evaluate(s.policyRequest(ctx, name, arguments))
+	if err != nil {
+		return "", err
+	}
+	result := "Decision: denied\n"
+	if decision.Allowed {
+		result = "Decision: allowed\n"
+	}
+	result += fmt.Sprintf("Reason: %s\n\nEvaluation:\n", decision.Reason)
+	for _, step := range decision.Trace {
+		result += fmt.Sprintf("- %s\n", step)
+	}
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"mcp-server/render"
+)
+
+// outputFormat returns the format argument of a tool call, else the configured format
+func (s *MCPServer) outputFormat(args map[string]interface{}) string {
+	if format, _ := args["format"].(string); format != "" {
+		return format
+	}
+	if s.OutputFormat != "" {
+		return s.OutputFormat
+	}
+	return render.Markdown
+}
+
+// renderOutput formats the result of a tool call in the requested format.
+// Outside of JSON, a template configured for the tool takes precedence.
+func (s *MCPServer) renderOutput(name string, args map[string]interface{}, result interface{}) (string, error) {
+	format := s.outputFormat(args)
+	if format != render.JSON {
+		if output, ok := s.Templates.Execute(name, result); ok {
+			return output, nil
+		}
+	}
+
+	var fields []string
+	list, _ := args["fields"].([]interface{})
+	for _, field := range list {
+		if name, ok := field.(string); ok {
+			fields = append(fields, name)
+		}
+	}
+	return render.Render(format, result, fields)
+}
+
+// renderMiddleware turns the result of a call into its output text. The
+// format is checked first, so a bad one is rejected before a write tool
+// changes anything.
+func (s *MCPServer) renderMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if err := render.CheckFormat(s.outputFormat(call.Args)); err != nil {
+			return nil, err
+		}
+		result, err := next(ctx, call)
+		if err != nil {
+			return nil, err
+		}
+		return s.renderOutput(call.Name, call.Args, result)
+	}
+}
@@ -2,20 +2,91 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"mcp-server/audit"
+	"mcp-server/auth"
+	"mcp-server/budget"
+	"mcp-server/idempotency"
+	"mcp-server/logging"
+	"mcp-server/metrics"
+	"mcp-server/policy"
+	"mcp-server/ratelimit"
+	"mcp-server/render"
 	"mcp-server/tools"
+	"mcp-server/tracing"
+	"mcp-server/undo"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
+// logger is the logger of the server subsystem
+var logger = logging.For("server")
+
 // MCPServer implements the Model Context Protocol server
 type MCPServer struct {
-	Github tools.GithubTool
-	Jira   tools.JiraTool
-	Notion tools.NotionTool
+	// Clients are the shared clients, used on stdio and by HTTP sessions
+	// without their own credentials
+	Clients
+
+	// Auth authenticates the callers of the HTTP transport. Nil disables authorization.
+	Auth *auth.ResourceServer
+	// MultiUser enables per-session upstream credentials on the HTTP transport
+	MultiUser *MultiUser
+	// RateLimits reports the rate limit state of the upstream clients
+	RateLimits *ratelimit.Registry
+	// Audit records every write tool call. Nil disables the audit log.
+	Audit *audit.Log
+	// OutputBudget caps the size of a tool output in bytes. Longer outputs
+	// are truncated at a record boundary and continued with a cursor kept
+	// in Cursors. Zero disables truncation unless a call asks for it.
+	OutputBudget int
+	Cursors      *budget.Cursors
+	// OutputFormat is the format of tool outputs without a format argument,
+	// Markdown by default
+	OutputFormat string
+	// Templates are the user-defined output templates per tool
+	Templates *render.Templates
+	// Metrics records the tool calls when set
+	Metrics *Metrics
+	// Tracer records a span per request when set
+	Tracer *tracing.Tracer
+	// MetricsHandler is served at /metrics on the HTTP transport when set,
+	// to callers with a valid token when authorization is enabled
+	MetricsHandler http.Handler
+	// DryRun runs every write tool call in dry-run mode, as if it had the
+	// dry_run argument
+	DryRun bool
+	// ToolTimeouts are the deadlines of the calls of some tools, on top of
+	// the timeout of each upstream request
+	ToolTimeouts map[string]time.Duration
+	// MiddlewareOrder lists the built-in middleware wrapping tool calls,
+	// outermost first. Nil uses DefaultMiddleware.
+	MiddlewareOrder []string
+	// Policy restricts the tools that may be called and what the write
+	// tools may touch. Nil allows every call.
+	Policy *policy.Policy
+	// Idempotency maps the idempotency keys of create calls to the entities
+	// they created. Nil ignores the keys.
+	Idempotency *idempotency.Store
+	// DuplicateWindow is how far back create calls without a key look for
+	// an entity with the same title to return instead. Zero disables it.
+	DuplicateWindow time.Duration
+	// Undo journals the write calls with how to revert them, for the
+	// undo tools. Nil disables the journal.
+	Undo *undo.Journal
+	// Sanitize hardens the untrusted upstream text in tool results. Nil
+	// leaves the results as they are.
+	Sanitize *SanitizeOptions
+
+	middleware []Middleware
+
+	sessions *sessionStore
+	life     lifecycle
 }
 
 // MCPRequest represents an MCP JSON-RPC request
@@ -52,6 +123,9 @@ type Tool struct {
 type ToolResult struct {
 	Content []ToolContent `json:"content"`
 	IsError bool          `json:"isError,omitempty"`
+	// Meta carries machine-readable details of the result, such as the
+	// classified error of a failed call
+	Meta map[string]interface{} `json:"_meta,omitempty"`
 }
 
 // ToolContent represents content in a tool result
@@ -60,10 +134,12 @@ type ToolContent struct {
 	Text string `json:"text"`
 }
 
-// Start starts the MCP server
+// Start starts the MCP server on stdio. It returns when stdin is closed.
 func (s *MCPServer) Start() {
-	log.Println("Starting MCP server...")
+	logger.Info("Starting MCP server on stdio")
 
+	stdio := &caller{Transport: "stdio"}
+	ctx := withCaller(s.lifecycle().requests, stdio)
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -73,34 +149,60 @@ func (s *MCPServer) Start() {
 
 		var request MCPRequest
 		if err := json.Unmarshal([]byte(line), &request); err != nil {
-			s.sendError(request.ID, -32700, "Parse error", nil)
+			s.sendJSON(newErrorResponse(request.ID, -32700, "Parse error", nil))
 			continue
 		}
+		if request.Method == "initialize" {
+			stdio.Client = clientInfo(request)
+		}
 
-		s.handleRequest(request)
+		if !s.acquire() {
+			if request.ID != nil {
+				s.sendJSON(newErrorResponse(request.ID, -32000, "Server is shutting down", nil))
+			}
+			continue
+		}
+		if response := s.handleRequest(ctx, request); response != nil {
+			s.sendJSON(response)
+		}
+		s.release()
 	}
 
 	if err := scanner.Err(); err != nil && err != io.EOF {
-		log.Printf("Error reading from stdin: %v", err)
+		logger.Error("Error reading from stdin", "error", err)
+		return
 	}
+	logger.Info("Stdin closed")
 }
 
-// handleRequest processes an MCP request
-func (s *MCPServer) handleRequest(request MCPRequest) {
+// handleRequest processes an MCP request and returns its response.
+// Notifications get no response.
+func (s *MCPServer) handleRequest(ctx context.Context, request MCPRequest) *MCPResponse {
+	if request.ID == nil && strings.HasPrefix(request.Method, "notifications/") {
+		return nil
+	}
+	defer s.Metrics.track()()
+	ctx = logging.WithRequestID(ctx, logging.NewRequestID())
+	ctx, span := s.startSpan(ctx, request)
+	logger.DebugContext(ctx, "Request", "method", request.Method, "id", request.ID)
+
+	var response *MCPResponse
 	switch request.Method {
 	case "initialize":
-		s.handleInitialize(request)
+		response = s.handleInitialize(request)
 	case "tools/list":
-		s.handleToolsList(request)
+		response = s.handleToolsList(ctx, request)
 	case "tools/call":
-		s.handleToolCall(request)
+		response = s.handleToolCall(ctx, request)
 	default:
-		s.sendError(request.ID, -32601, "Method not found", nil)
+		response = newErrorResponse(request.ID, -32601, "Method not found", nil)
 	}
+	endSpan(span, response)
+	return response
 }
 
 // handleInitialize handles the initialize request
-func (s *MCPServer) handleInitialize(request MCPRequest) {
+func (s *MCPServer) handleInitialize(request MCPRequest) *MCPResponse {
 	result := map[string]interface{}{
 		"protocolVersion": "2024-11-05",
 		"capabilities": map[string]interface{}{
@@ -111,65 +213,100 @@ func (s *MCPServer) handleInitialize(request MCPRequest) {
 			"version": "1.0.0",
 		},
 	}
-	s.sendResponse(request.ID, result)
+	return newResponse(request.ID, result)
 }
 
-// handleToolsList handles the tools/list request
-func (s *MCPServer) handleToolsList(request MCPRequest) {
-	tools := s.getAvailableTools()
+// handleToolsList handles the tools/list request.
+// Authenticated callers only see the tools their scopes grant.
+func (s *MCPServer) handleToolsList(ctx context.Context, request MCPRequest) *MCPResponse {
+	tools := s.getAvailableTools(ctx)
+	if info, ok := auth.FromContext(ctx); ok {
+		allowed := tools[:0]
+		for _, tool := range tools {
+			if hasToolScope(info, tool.Name) {
+				allowed = append(allowed, tool)
+			}
+		}
+		tools = allowed
+	}
 	result := map[string]interface{}{
 		"tools": tools,
 	}
-	s.sendResponse(request.ID, result)
+	return newResponse(request.ID, result)
 }
 
 // handleToolCall handles the tools/call request
-func (s *MCPServer) handleToolCall(request MCPRequest) {
+func (s *MCPServer) handleToolCall(ctx context.Context, request MCPRequest) *MCPResponse {
+	name, arguments, errResponse := parseToolCall(request)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	started := time.Now()
+	ctx = logging.WithAttrs(ctx, "tool", name)
+	ctx, upstream := metrics.WithUpstream(ctx)
+	call := &Call{Name: name, Args: arguments, upstream: upstream}
+	result, err := s.chain()(ctx, call)
+	output, ok := result.(string)
+	if err == nil && !ok {
+		// The render middleware is not configured
+		output, err = s.renderOutput(name, call.Args, result)
+	}
+	if err != nil {
+		apiErr := classify(name, err, upstream)
+		logger.WarnContext(ctx, "Tool call failed", "duration_ms", time.Since(started).Milliseconds(), "class", errorClass(err, apiErr), "error", err)
+		result := errorResult(err, apiErr)
+		// The metadata set by the middleware, e.g. redactions, is kept
+		for key, value := range call.Meta {
+			if _, ok := result.Meta[key]; !ok {
+				result.Meta[key] = value
+			}
+		}
+		return newResponse(request.ID, result)
+	}
+
+	logger.InfoContext(ctx, "Tool call", "duration_ms", time.Since(started).Milliseconds(), "output_chars", len(output))
+	if len(call.Notes) > 0 {
+		output = strings.Join(call.Notes, "\n") + "\n\n" + output
+	}
+	return newResponse(request.ID, ToolResult{
+		Content: []ToolContent{{Type: "text", Text: output}},
+		IsError: false,
+		Meta:    call.Meta,
+	})
+}
+
+// parseToolCall extracts the tool name and arguments of a tools/call request
+func parseToolCall(request MCPRequest) (string, map[string]interface{}, *MCPResponse) {
 	params, ok := request.Params.(map[string]interface{})
 	if !ok {
-		s.sendError(request.ID, -32602, "Invalid params", nil)
-		return
+		return "", nil, newErrorResponse(request.ID, -32602, "Invalid params", nil)
 	}
 
 	name, ok := params["name"].(string)
 	if !ok {
-		s.sendError(request.ID, -32602, "Missing tool name", nil)
-		return
+		return "", nil, newErrorResponse(request.ID, -32602, "Missing tool name", nil)
 	}
 
 	arguments, ok := params["arguments"].(map[string]interface{})
 	if !ok {
 		arguments = make(map[string]interface{})
 	}
-
-	result, err := s.executeTool(name, arguments)
-	if err != nil {
-		s.sendResponse(request.ID, ToolResult{
-			Content: []ToolContent{{Type: "text", Text: fmt.Sprintf("Error: %v", err)}},
-			IsError: true,
-		})
-		return
-	}
-
-	s.sendResponse(request.ID, ToolResult{
-		Content: []ToolContent{{Type: "text", Text: result}},
-		IsError: false,
-	})
+	return name, arguments, nil
 }
 
-// sendResponse sends a JSON-RPC response
-func (s *MCPServer) sendResponse(id interface{}, result interface{}) {
-	response := MCPResponse{
+// newResponse builds a JSON-RPC response
+func newResponse(id interface{}, result interface{}) *MCPResponse {
+	return &MCPResponse{
 		JSONRPC: "2.0",
 		ID:      id,
 		Result:  result,
 	}
-	s.sendJSON(response)
 }
 
-// sendError sends a JSON-RPC error response
-func (s *MCPServer) sendError(id interface{}, code int, message string, data interface{}) {
-	response := MCPResponse{
+// newErrorResponse builds a JSON-RPC error response
+func newErrorResponse(id interface{}, code int, message string, data interface{}) *MCPResponse {
+	return &MCPResponse{
 		JSONRPC: "2.0",
 		ID:      id,
 		Error: &MCPError{
@@ -178,21 +315,85 @@ func (s *MCPServer) sendError(id interface{}, code int, message string, data int
 			Data:    data,
 		},
 	}
-	s.sendJSON(response)
 }
 
 // sendJSON sends a JSON message to stdout
 func (s *MCPServer) sendJSON(v interface{}) {
 	data, err := json.Marshal(v)
 	if err != nil {
-		log.Printf("Error marshaling JSON: %v", err)
+		logger.Error("Error marshaling JSON", "error", err)
 		return
 	}
 	fmt.Println(string(data))
 }
 
 // getAvailableTools returns the list of available tools
-func (s *MCPServer) getAvailableTools() []Tool {
+func (s *MCPServer) getAvailableTools(ctx context.Context) []Tool {
+	clients := s.clients(ctx)
+	tools := s.getToolDefinitions()
+	for _, tool := range tools {
+		properties, _ := tool.InputSchema["properties"].(map[string]interface{})
+		properties["format"] = map[string]interface{}{
+			"type":        "string",
+			"enum":        render.Formats,
+			"description": "Output format (default " + s.outputFormat(nil) + ")",
+		}
+		properties["fields"] = map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": "With the json format, the fields to keep for each object",
+		}
+		properties["max_tokens"] = map[string]interface{}{
+			"type":        "number",
+			"description": "Approximate maximum output size in tokens. Longer output is truncated and returns a cursor",
+		}
+		properties["max_chars"] = map[string]interface{}{
+			"type":        "number",
+			"description": "Maximum output size in characters, instead of max_tokens",
+		}
+		properties["cursor"] = map[string]interface{}{
+			"type":        "string",
+			"description": "Cursor returned by a truncated call, to fetch the next part of its output",
+		}
+		if writeTools[tool.Name] {
+			properties["dry_run"] = map[string]interface{}{
+				"type":        "boolean",
+				"description": "Validate the arguments and resolve the targets, then return the request that would be sent without sending it",
+			}
+			if createTools[tool.Name] {
+				properties["idempotency_key"] = map[string]interface{}{
+					"type":        "string",
+					"description": "Unique key of this create, e.g. a UUID. Retrying with the same key returns the entity created by the first call instead of creating another",
+				}
+			}
+		} else if serviceOf(tool.Name) != "" {
+			properties["fresh"] = map[string]interface{}{
+				"type":        "boolean",
+				"description": "Fetch the data from the service again instead of using cached responses",
+			}
+		}
+
+		var accounts []string
+		switch {
+		case strings.HasPrefix(tool.Name, "github_"):
+			accounts = clients.Github.Names()
+		case strings.HasPrefix(tool.Name, "jira_"):
+			accounts = clients.Jira.Names()
+		case strings.HasPrefix(tool.Name, "notion_"):
+			accounts = clients.Notion.Names()
+		default:
+			continue
+		}
+		properties["account"] = map[string]interface{}{
+			"type":        "string",
+			"description": "Account profile to use (" + strings.Join(accounts, ", ") + "). Defaults to the routing rules, then the default account",
+		}
+	}
+	return tools
+}
+
+// getToolDefinitions returns the definitions of the service tools
+func (s *MCPServer) getToolDefinitions() []Tool {
 	return []Tool{
 		// GitHub tools
 		{
@@ -587,31 +788,137 @@ func (s *MCPServer) getAvailableTools() []Tool {
 				"required": []string{"databaseID", "title"},
 			},
 		},
+
+		// Server tools
+		{
+			Name:        "rate_limit_status",
+			Description: "Show the rate limit state of the GitHub, Jira and Notion clients",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+		{
+			Name:        "audit_log",
+			Description: "Query recent audit log entries of write tool calls, newest first",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tool":    map[string]interface{}{"type": "string", "description": "Only entries of this tool"},
+					"target":  map[string]interface{}{"type": "string", "description": "Only entries whose target contains this text, e.g. owner/repo or PROJ-12"},
+					"outcome": map[string]interface{}{"type": "string", "enum": []string{"success", "error", "dry_run", "denied", "replayed"}, "description": "Only entries with this outcome"},
+					"since":   map[string]interface{}{"type": "string", "description": "Only entries newer than this duration (e.g. 24h) or RFC 3339 time"},
+					"limit":   map[string]interface{}{"type": "number", "description": "Maximum number of entries (default 20)"},
+				},
+			},
+		},
+		{
+			Name:        "policy_explain",
+			Description: "Explain whether the configured policy allows a tool call, and which rules allow or deny it",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tool":      map[string]interface{}{"type": "string", "description": "Name of the tool, e.g. github_create_branch"},
+					"arguments": map[string]interface{}{"type": "object", "description": "Arguments of the call, e.g. {\"owner\": \"acme\", \"repo\": \"api\", \"branchName\": \"agent/fix\"}"},
+				},
+				"required": []string{"tool"},
+			},
+		},
+		{
+			Name:        "undo_last",
+			Description: "Undo the most recent write action of the caller not undone yet, e.g. close the issue it created or delete the branch it created",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+		{
+			Name:        "undo_action",
+			Description: "Undo a recorded write action by ID, or list the recent actions of the caller and whether they can be undone when no ID is given",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id": map[string]interface{}{"type": "string", "description": "ID of the action, as shown in the result of the write call"},
+				},
+			},
+		},
 	}
 }
 
-// executeTool executes the specified tool with given arguments
-func (s *MCPServer) executeTool(name string, args map[string]interface{}) (string, error) {
+// executeTool executes the specified tool with given arguments.
+// The client is picked from the service accounts using the optional
+// account argument and the configured routing rules.
+func (s *MCPServer) executeTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	account, _ := args["account"].(string)
+	clients := s.clients(ctx)
+
+	switch {
+	case name == "rate_limit_status":
+		return s.rateLimitStatus(), nil
+
+	case name == "audit_log":
+		return s.auditLog(ctx, args)
+
+	case name == "policy_explain":
+		return s.policyExplain(ctx, args)
+
+	case name == "undo_last":
+		return s.undoAction(ctx, "")
+
+	case name == "undo_action":
+		id, _ := args["id"].(string)
+		if id == "" {
+			return s.undoHistory(ctx), nil
+		}
+		return s.undoAction(ctx, id)
+
+	case strings.HasPrefix(name, "github_"):
+		client, err := clients.Github.Resolve(account, githubRoutingKey(args))
+		if err != nil {
+			return nil, err
+		}
+		return executeGithubTool(ctx, client, name, args)
+
+	case strings.HasPrefix(name, "jira_"):
+		client, err := clients.Jira.Resolve(account, jiraRoutingKey(args))
+		if err != nil {
+			return nil, err
+		}
+		return executeJiraTool(ctx, client, name, args)
+
+	case strings.HasPrefix(name, "notion_"):
+		client, err := clients.Notion.Resolve(account, "")
+		if err != nil {
+			return nil, err
+		}
+		return executeNotionTool(ctx, client, name, args)
+
+	default:
+		return nil, fmt.Errorf("unknown tool: %s", name)
+	}
+}
+
+// executeGithubTool executes a GitHub tool against the given client
+func executeGithubTool(ctx context.Context, github tools.GithubTool, name string, args map[string]interface{}) (interface{}, error) {
 	switch name {
-	// GitHub tools
 	case "github_get_pull_request":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		number, _ := args["number"].(float64)
-		return s.Github.GetPullRequest(owner, repo, int(number))
+		return github.GetPullRequest(ctx, owner, repo, int(number))
 
 	case "github_get_pull_request_diff":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		number, _ := args["number"].(float64)
-		return s.Github.GetPullRequestDiff(owner, repo, int(number))
+		return github.GetPullRequestDiff(ctx, owner, repo, int(number))
 
 	case "github_create_issue":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		title, _ := args["title"].(string)
 		body, _ := args["body"].(string)
-		return s.Github.CreateIssue(owner, repo, title, body)
+		return github.CreateIssue(ctx, owner, repo, title, body)
 
 	case "github_create_pull_request":
 		owner, _ := args["owner"].(string)
@@ -620,56 +927,56 @@ func (s *MCPServer) executeTool(name string, args map[string]interface{}) (strin
 		body, _ := args["body"].(string)
 		head, _ := args["head"].(string)
 		base, _ := args["base"].(string)
-		return s.Github.CreatePullRequest(owner, repo, title, body, head, base)
+		return github.CreatePullRequest(ctx, owner, repo, title, body, head, base)
 
 	case "github_get_issue":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		number, _ := args["number"].(float64)
-		return s.Github.GetIssue(owner, repo, int(number))
+		return github.GetIssue(ctx, owner, repo, int(number))
 
 	case "github_list_branches":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
-		return s.Github.ListBranches(owner, repo)
+		return github.ListBranches(ctx, owner, repo)
 
 	case "github_list_commits":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
-		return s.Github.ListCommits(owner, repo)
+		return github.ListCommits(ctx, owner, repo)
 
 	case "github_search_repositories":
 		query, _ := args["query"].(string)
-		return s.Github.SearchRepositories(query)
+		return github.SearchRepositories(ctx, query)
 
 	case "github_search_issues":
 		query, _ := args["query"].(string)
-		return s.Github.SearchIssues(query)
+		return github.SearchIssues(ctx, query)
 
 	case "github_get_workflows":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
-		return s.Github.GetWorkflows(owner, repo)
+		return github.GetWorkflows(ctx, owner, repo)
 
 	case "github_run_workflow":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		workflowID, _ := args["workflowID"].(string)
 		ref, _ := args["ref"].(string)
-		return s.Github.RunWorkflow(owner, repo, workflowID, ref)
+		return github.RunWorkflow(ctx, owner, repo, workflowID, ref)
 
 	case "github_add_comment":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		number, _ := args["number"].(float64)
 		body, _ := args["body"].(string)
-		return s.Github.AddComment(owner, repo, int(number), body)
+		return github.AddComment(ctx, owner, repo, int(number), body)
 
 	case "github_get_comments":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		number, _ := args["number"].(float64)
-		return s.Github.GetComments(owner, repo, int(number))
+		return github.GetComments(ctx, owner, repo, int(number))
 
 	case "github_assign_copilot":
 		owner, _ := args["owner"].(string)
@@ -680,98 +987,137 @@ func (s *MCPServer) executeTool(name string, args map[string]interface{}) (strin
 		for i, assignee := range assignees {
 			assigneeStrs[i], _ = assignee.(string)
 		}
-		return s.Github.AssignCopilot(owner, repo, int(number), assigneeStrs)
+		return github.AssignCopilot(ctx, owner, repo, int(number), assigneeStrs)
 
 	case "github_create_branch":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		branchName, _ := args["branchName"].(string)
 		sha, _ := args["sha"].(string)
-		return s.Github.CreateBranch(owner, repo, branchName, sha)
+		return github.CreateBranch(ctx, owner, repo, branchName, sha)
 
 	case "github_create_repository":
 		name, _ := args["name"].(string)
 		description, _ := args["description"].(string)
 		private, _ := args["private"].(bool)
-		return s.Github.CreateRepository(name, description, private)
+		return github.CreateRepository(ctx, name, description, private)
 
 	case "github_get_commit":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		sha, _ := args["sha"].(string)
-		return s.Github.GetCommit(owner, repo, sha)
+		return github.GetCommit(ctx, owner, repo, sha)
 
 	case "github_get_release_by_tag":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		tagName, _ := args["tagName"].(string)
-		return s.Github.GetReleaseByTag(owner, repo, tagName)
+		return github.GetReleaseByTag(ctx, owner, repo, tagName)
 
 	case "github_get_tag":
 		owner, _ := args["owner"].(string)
 		repo, _ := args["repo"].(string)
 		tagName, _ := args["tagName"].(string)
-		return s.Github.GetTag(owner, repo, tagName)
+		return github.GetTag(ctx, owner, repo, tagName)
 
 	case "github_search_code":
 		query, _ := args["query"].(string)
-		return s.Github.SearchCode(query)
+		return github.SearchCode(ctx, query)
 
 	case "github_search_pull_requests":
 		query, _ := args["query"].(string)
-		return s.Github.SearchPullRequests(query)
+		return github.SearchPullRequests(ctx, query)
+
+	default:
+		return nil, fmt.Errorf("unknown tool: %s", name)
+	}
+}
 
-	// Jira tools
+// executeJiraTool executes a Jira tool against the given client
+func executeJiraTool(ctx context.Context, jira tools.JiraTool, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
 	case "jira_get_ticket":
 		ticketID, _ := args["ticketID"].(string)
-		return s.Jira.GetTicketByID(ticketID)
+		return jira.GetTicketByID(ctx, ticketID)
 
 	case "jira_search_tickets":
 		jql, _ := args["jql"].(string)
-		return s.Jira.SearchTickets(jql)
+		return jira.SearchTickets(ctx, jql)
 
 	case "jira_create_ticket":
 		projectKey, _ := args["projectKey"].(string)
 		summary, _ := args["summary"].(string)
 		description, _ := args["description"].(string)
-		return s.Jira.CreateTicket(projectKey, summary, description)
+		return jira.CreateTicket(ctx, projectKey, summary, description)
 
-	// Notion tools
+	default:
+		return nil, fmt.Errorf("unknown tool: %s", name)
+	}
+}
+
+// executeNotionTool executes a Notion tool against the given client
+func executeNotionTool(ctx context.Context, notion tools.NotionTool, name string, args map[string]interface{}) (interface{}, error) {
+	switch name {
 	case "notion_search_pages":
 		title, _ := args["title"].(string)
-		return s.Notion.SearchPagesByTitle(title)
+		return notion.SearchPagesByTitle(ctx, title)
 
 	case "notion_get_page":
 		url, _ := args["url"].(string)
-		return s.Notion.GetPageByURL(url)
+		return notion.GetPageByURL(ctx, url)
 
 	case "notion_get_database":
 		databaseID, _ := args["databaseID"].(string)
-		return s.Notion.GetDatabase(databaseID)
+		return notion.GetDatabase(ctx, databaseID)
 
 	case "notion_create_page":
 		parentID, _ := args["parentID"].(string)
 		title, _ := args["title"].(string)
 		content, _ := args["content"].(string)
-		return s.Notion.CreatePage(parentID, title, content)
+		return notion.CreatePage(ctx, parentID, title, content)
 
 	case "notion_create_database":
 		parentPageID, _ := args["parentPageID"].(string)
 		title, _ := args["title"].(string)
-		return s.Notion.CreateDatabase(parentPageID, title)
+		return notion.CreateDatabase(ctx, parentPageID, title)
 
 	case "notion_update_page":
 		pageID, _ := args["pageID"].(string)
 		title, _ := args["title"].(string)
 		content, _ := args["content"].(string)
-		return s.Notion.UpdatePage(pageID, title, content)
+		return notion.UpdatePage(ctx, pageID, title, content)
 
 	case "notion_update_database":
 		databaseID, _ := args["databaseID"].(string)
 		title, _ := args["title"].(string)
-		return s.Notion.UpdateDatabase(databaseID, title)
+		return notion.UpdateDatabase(ctx, databaseID, title)
 
 	default:
-		return "", fmt.Errorf("unknown tool: %s", name)
+		return nil, fmt.Errorf("unknown tool: %s", name)
+	}
+}
+
+// rateLimitStatus describes the rate limit state of every upstream client
+func (s *MCPServer) rateLimitStatus() string {
+	if s.RateLimits == nil {
+		return "Rate limiting is not enabled."
+	}
+
+	var result string
+	for _, status := range s.RateLimits.Statuses() {
+		quota := "unknown"
+		if status.Remaining >= 0 {
+			quota = fmt.Sprintf("%d/%d remaining", status.Remaining, status.Limit)
+			if !status.Reset.IsZero() {
+				quota += ", resets " + status.Reset.Format(time.RFC3339)
+			}
+		}
+		result += fmt.Sprintf("Backend: %s\nQuota: %s\nRequests: %d\nThrottled: %d\nRetries: %d\n",
+			status.Name, quota, status.Requests, status.Throttled, status.Retries)
+		if status.BlockedUntil.After(time.Now()) {
+			result += fmt.Sprintf("Blocked until: %s\n", status.BlockedUntil.Format(time.RFC3339))
+		}
+		result += "\n"
 	}
+	return result
 }
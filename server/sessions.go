@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mcp-server/logging"
+	"mcp-server/tools"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultSessionIdleTimeout is how long an unused session keeps its clients
+const defaultSessionIdleTimeout = 30 * time.Minute
+
+// Clients holds the service accounts tool calls are executed against
+type Clients struct {
+	Github *Accounts[tools.GithubTool]
+	Jira   *Accounts[tools.JiraTool]
+	Notion *Accounts[tools.NotionTool]
+}
+
+// Credentials are the upstream credentials a user acts with.
+// Empty fields mean the user brought no credentials for that service.
+type Credentials struct {
+	GithubToken  string
+	JiraUsername string
+	JiraToken    string
+	NotionToken  string
+}
+
+// MultiUser configures per-user upstream credentials on the HTTP transport.
+// Each MCP session gets its own clients, built from the credentials sent in
+// the X-GitHub-Token, X-Jira-Username, X-Jira-Token and X-Notion-Token
+// headers or configured for the authenticated identity.
+type MultiUser struct {
+	// NewClients builds the clients of a session. Services without
+	// credentials are left nil.
+	NewClients func(creds Credentials) (*Clients, error)
+	// Users maps authenticated subjects to their credentials
+	Users map[string]Credentials
+	// RequireUserCredentials disables the fallback to the shared clients
+	// for services the user brought no credentials for
+	RequireUserCredentials bool
+	// IdleTimeout evicts sessions and their clients after this long without requests
+	IdleTimeout time.Duration
+	// Release drops what NewClients built for credentials once no session
+	// uses them anymore. The fields of the credentials still in use are empty.
+	Release func(creds Credentials)
+}
+
+// session is an MCP session of the HTTP transport
+type session struct {
+	id       string
+	subject  string
+	client   string
+	creds    Credentials
+	clients  *Clients
+	lastUsed time.Time
+}
+
+// sessionStore holds the live sessions of the HTTP transport
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+	// release drops what was built for the credentials of ended sessions
+	release func(creds Credentials)
+}
+
+// newSessionStore creates an empty sessionStore releasing the credentials
+// no session uses anymore with release
+func newSessionStore(release func(creds Credentials)) *sessionStore {
+	return &sessionStore{sessions: make(map[string]*session), release: release}
+}
+
+// create registers a new session for subject
+func (st *sessionStore) create(subject string) (*session, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	sess := &session{
+		id:       hex.EncodeToString(id),
+		subject:  subject,
+		lastUsed: time.Now(),
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.sessions[sess.id] = sess
+	return sess, nil
+}
+
+// get returns the session with the given ID if it belongs to subject
+func (st *sessionStore) get(id string, subject string) (*session, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sess, ok := st.sessions[id]
+	if !ok || sess.subject != subject {
+		return nil, false
+	}
+	sess.lastUsed = time.Now()
+	return sess, true
+}
+
+// remove ends the session with the given ID if it belongs to subject
+func (st *sessionStore) remove(id string, subject string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sess, ok := st.sessions[id]
+	if !ok || sess.subject != subject {
+		return false
+	}
+	delete(st.sessions, id)
+	st.releaseUnused(sess.creds)
+	return true
+}
+
+// evictIdle removes the sessions unused for longer than timeout, and
+// releases the credentials no remaining session uses
+func (st *sessionStore) evictIdle(timeout time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var evicted []*session
+	for id, sess := range st.sessions {
+		if time.Since(sess.lastUsed) > timeout {
+			delete(st.sessions, id)
+			evicted = append(evicted, sess)
+			logger.Info("Evicted idle session", "session", id)
+		}
+	}
+	for _, sess := range evicted {
+		st.releaseUnused(sess.creds)
+	}
+}
+
+// setCredentials records the credentials and clients of sess, and releases
+// the ones it used before when no other session uses them
+func (st *sessionStore) setCredentials(sess *session, creds Credentials, clients *Clients) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	previous := sess.creds
+	sess.creds = creds
+	sess.clients = clients
+	for _, token := range []string{creds.GithubToken, creds.JiraToken, creds.NotionToken} {
+		logging.AddSecret(token)
+	}
+	// The session may have been evicted while its clients were built
+	if st.sessions[sess.id] != sess {
+		st.releaseUnused(creds)
+	}
+	if previous != creds {
+		st.releaseUnused(previous)
+	}
+}
+
+// releaseUnused releases the credentials of creds no session uses, with
+// the tokens masked for them. The caller holds st.mu.
+func (st *sessionStore) releaseUnused(creds Credentials) {
+	for _, sess := range st.sessions {
+		if sess.creds.GithubToken == creds.GithubToken {
+			creds.GithubToken = ""
+		}
+		if sess.creds.JiraUsername == creds.JiraUsername && sess.creds.JiraToken == creds.JiraToken {
+			creds.JiraUsername, creds.JiraToken = "", ""
+		}
+		if sess.creds.NotionToken == creds.NotionToken {
+			creds.NotionToken = ""
+		}
+	}
+	if creds == (Credentials{}) {
+		return
+	}
+	for _, token := range []string{creds.GithubToken, creds.JiraToken, creds.NotionToken} {
+		logging.RemoveSecret(token)
+	}
+	if st.release != nil {
+		st.release(creds)
+	}
+}
+
+// runEviction periodically evicts idle sessions until ctx is done
+func (st *sessionStore) runEviction(ctx context.Context, timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			st.evictIdle(timeout)
+		}
+	}
+}
+
+// credentialsFromRequest returns the credentials of the caller: the given
+// ones, overridden by request headers
+func (m *MultiUser) credentialsFromRequest(r *http.Request, creds Credentials) Credentials {
+	if token := r.Header.Get("X-GitHub-Token"); token != "" {
+		creds.GithubToken = token
+	}
+	if username := r.Header.Get("X-Jira-Username"); username != "" {
+		creds.JiraUsername = username
+	}
+	if token := r.Header.Get("X-Jira-Token"); token != "" {
+		creds.JiraToken = token
+	}
+	if token := r.Header.Get("X-Notion-Token"); token != "" {
+		creds.NotionToken = token
+	}
+	return creds
+}
+
+// sessionClients returns the clients of sess. The first request of the
+// session sets its credentials, the ones configured for the subject
+// overridden by the request headers; later requests keep them, unless
+// their headers replace some. The clients are built outside the session
+// lock, so building them does not hold up the other sessions.
+func (s *MCPServer) sessionClients(sess *session, r *http.Request) (*Clients, error) {
+	s.sessions.mu.Lock()
+	current, clients := sess.creds, sess.clients
+	s.sessions.mu.Unlock()
+	if clients == nil {
+		current = s.MultiUser.Users[sess.subject]
+	}
+	creds := s.MultiUser.credentialsFromRequest(r, current)
+	if clients != nil && creds == current {
+		return clients, nil
+	}
+
+	clients, err := s.MultiUser.NewClients(creds)
+	if err != nil {
+		s.sessions.mu.Lock()
+		s.sessions.releaseUnused(creds)
+		s.sessions.mu.Unlock()
+		return nil, err
+	}
+	require := s.MultiUser.RequireUserCredentials
+	if clients.Github == nil {
+		clients.Github = fallbackAccounts(require, s.Github, "github", "X-GitHub-Token")
+	}
+	if clients.Jira == nil {
+		clients.Jira = fallbackAccounts(require, s.Jira, "jira", "X-Jira-Token")
+	}
+	if clients.Notion == nil {
+		clients.Notion = fallbackAccounts(require, s.Notion, "notion", "X-Notion-Token")
+	}
+
+	s.sessions.setCredentials(sess, creds, clients)
+	return clients, nil
+}
+
+// fallbackAccounts returns the shared accounts of a service, or no
+// accounts at all when users must bring their own credentials
+func fallbackAccounts[T any](require bool, shared *Accounts[T], service string, header string) *Accounts[T] {
+	if require {
+		accounts := NewAccounts[T](service)
+		accounts.hint = " for this session: send your credentials in the " + header + " header"
+		return accounts
+	}
+	return shared
+}
+
+type clientsKey struct{}
+
+// withClients returns a copy of ctx carrying the clients of the session
+func withClients(ctx context.Context, clients *Clients) context.Context {
+	return context.WithValue(ctx, clientsKey{}, clients)
+}
+
+// clients returns the clients tool calls of ctx are executed against:
+// the ones of the session, or the shared ones
+func (s *MCPServer) clients(ctx context.Context) *Clients {
+	if clients, ok := ctx.Value(clientsKey{}).(*Clients); ok {
+		return clients
+	}
+	return &s.Clients
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestMultiUser returns a server with per-user sessions whose built and
+// released credentials are recorded
+func newTestMultiUser(t *testing.T) (*MCPServer, *[]Credentials, *[]Credentials) {
+	t.Helper()
+	var mu sync.Mutex
+	var built, released []Credentials
+	s := &MCPServer{MultiUser: &MultiUser{
+		NewClients: func(creds Credentials) (*Clients, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			built = append(built, creds)
+			return &Clients{}, nil
+		},
+		Release: func(creds Credentials) {
+			released = append(released, creds)
+		},
+	}}
+	s.sessions = newSessionStore(s.MultiUser.Release)
+	return s, &built, &released
+}
+
+// request returns an MCP request with the given credential headers
+func request(headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	return r
+}
+
+func TestSessionKeepsCredentials(t *testing.T) {
+	s, built, _ := newTestMultiUser(t)
+	sess, _ := s.sessions.create("alice")
+
+	if _, err := s.sessionClients(sess, request(map[string]string{"X-GitHub-Token": "ghp-alice-token"})); err != nil {
+		t.Fatal(err)
+	}
+	// A later request without the header keeps the credentials of the session
+	if _, err := s.sessionClients(sess, request(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*built) != 1 || sess.creds.GithubToken != "ghp-alice-token" {
+		t.Fatalf("built %v, session credentials %+v, want the first credentials kept", *built, sess.creds)
+	}
+
+	// New headers replace the credentials they carry
+	if _, err := s.sessionClients(sess, request(map[string]string{"X-Notion-Token": "secret-notion-token"})); err != nil {
+		t.Fatal(err)
+	}
+	want := Credentials{GithubToken: "ghp-alice-token", NotionToken: "secret-notion-token"}
+	if len(*built) != 2 || (*built)[1] != want || sess.creds != want {
+		t.Errorf("built %v, session credentials %+v, want %+v", *built, sess.creds, want)
+	}
+}
+
+func TestSessionReleasesCredentials(t *testing.T) {
+	s, _, released := newTestMultiUser(t)
+	first, _ := s.sessions.create("alice")
+	second, _ := s.sessions.create("alice")
+	s.sessionClients(first, request(map[string]string{"X-GitHub-Token": "ghp-shared-token", "X-Notion-Token": "secret-notion-token"}))
+	s.sessionClients(second, request(map[string]string{"X-GitHub-Token": "ghp-shared-token"}))
+
+	// The GitHub token is still used by the second session
+	first.lastUsed = time.Now().Add(-time.Hour)
+	s.sessions.evictIdle(time.Minute)
+	if len(*released) != 1 || (*released)[0] != (Credentials{NotionToken: "secret-notion-token"}) {
+		t.Fatalf("released %v, want the Notion token only", *released)
+	}
+
+	if !s.sessions.remove(second.id, "alice") {
+		t.Fatal("second session not found")
+	}
+	if len(*released) != 2 || (*released)[1] != (Credentials{GithubToken: "ghp-shared-token"}) {
+		t.Errorf("released %v, want the GitHub token once no session uses it", *released)
+	}
+}
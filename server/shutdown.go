@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// abortGracePeriod is how long the requests canceled at the shutdown
+// deadline have to answer
+const abortGracePeriod = time.Second
+
+// lifecycle tracks the requests in flight, so the server can stop accepting
+// new ones and let the running ones finish before it exits
+type lifecycle struct {
+	once     sync.Once
+	mu       sync.Mutex
+	closing  bool
+	inFlight sync.WaitGroup
+	// requests is the base context of the requests, canceled when the
+	// shutdown deadline passes
+	requests      context.Context
+	abortRequests context.CancelFunc
+	// pollers is the context of the background pollers, canceled when the
+	// shutdown begins
+	pollers     context.Context
+	stopPollers context.CancelFunc
+	httpServer  *http.Server
+}
+
+// lifecycle returns the lifecycle of the server, initializing it on first use
+func (s *MCPServer) lifecycle() *lifecycle {
+	l := &s.life
+	l.once.Do(func() {
+		l.requests, l.abortRequests = context.WithCancel(context.Background())
+		l.pollers, l.stopPollers = context.WithCancel(context.Background())
+	})
+	return l
+}
+
+// acquire registers a request in flight. It returns false once the server
+// is shutting down; otherwise release must be called when the request is done.
+func (s *MCPServer) acquire() bool {
+	l := s.lifecycle()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return false
+	}
+	l.inFlight.Add(1)
+	return true
+}
+
+// release marks a request acquired with acquire as done
+func (s *MCPServer) release() {
+	s.lifecycle().inFlight.Done()
+}
+
+// setHTTPServer records the HTTP server to close on shutdown. It returns
+// false when the shutdown already began.
+func (s *MCPServer) setHTTPServer(server *http.Server) bool {
+	l := s.lifecycle()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.httpServer = server
+	return !l.closing
+}
+
+// Shutdown stops accepting requests, stops the background pollers, closes
+// the HTTP listener and waits for the requests in flight until ctx is done.
+// Requests still running then have their context canceled.
+func (s *MCPServer) Shutdown(ctx context.Context) error {
+	l := s.lifecycle()
+	l.mu.Lock()
+	l.closing = true
+	httpServer := l.httpServer
+	l.mu.Unlock()
+
+	logger.Info("Shutting down, waiting for in-flight requests")
+	l.stopPollers()
+	if httpServer != nil {
+		// Closes the listeners and idle connections, then waits for the handlers
+		httpServer.Shutdown(ctx)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		l.inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		logger.Info("Shutdown complete")
+		return nil
+	case <-ctx.Done():
+		// Let the canceled requests answer with their error
+		l.abortRequests()
+		select {
+		case <-drained:
+		case <-time.After(abortGracePeriod):
+		}
+		return fmt.Errorf("requests still in flight at the shutdown deadline: %w", ctx.Err())
+	}
+}
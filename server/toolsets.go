@@ -0,0 +1,82 @@
+package server
+
+import (
+	"mcp-server/auth"
+	"strings"
+)
+
+// writeTools lists the tools that create or modify upstream data.
+// Every other tool only reads.
+var writeTools = map[string]bool{
+	"github_create_issue":        true,
+	"github_create_pull_request": true,
+	"github_run_workflow":        true,
+	"github_add_comment":         true,
+	"github_assign_copilot":      true,
+	"github_create_branch":       true,
+	"github_create_repository":   true,
+	"jira_create_ticket":         true,
+	"notion_create_page":         true,
+	"notion_create_database":     true,
+	"notion_update_page":         true,
+	"notion_update_database":     true,
+	// Undoing an action is a write too: closing, deleting or archiving
+	"undo_last":   true,
+	"undo_action": true,
+}
+
+// serverTools lists the tools about the server itself rather than a service
+var serverTools = map[string]bool{
+	"rate_limit_status": true,
+	"audit_log":         true,
+	"policy_explain":    true,
+	"undo_last":         true,
+	"undo_action":       true,
+}
+
+// writeCall reports whether a call may change data: a call of a write
+// tool, except undo_action listing the recorded actions
+func writeCall(name string, args map[string]interface{}) bool {
+	if id, _ := args["id"].(string); name == "undo_action" && id == "" {
+		return false
+	}
+	return writeTools[name]
+}
+
+// toolService returns the service a tool belongs to, e.g. "github",
+// or "server" for the server tools
+func toolService(name string) string {
+	if serverTools[name] {
+		return "server"
+	}
+	service, _, _ := strings.Cut(name, "_")
+	return service
+}
+
+// toolScope returns the OAuth scope of the toolset a tool belongs to,
+// "<service>:read" or "<service>:write"
+func toolScope(name string) string {
+	if writeTools[name] {
+		return toolService(name) + ":write"
+	}
+	return toolService(name) + ":read"
+}
+
+// hasToolScope reports whether the caller may use a tool.
+// The write scope of a service also grants its read tools.
+func hasToolScope(info *auth.Info, name string) bool {
+	scope := toolScope(name)
+	if info.HasScope(scope) {
+		return true
+	}
+	return strings.HasSuffix(scope, ":read") && info.HasScope(toolService(name)+":write")
+}
+
+// adminScope lets a caller see the audit entries of every caller
+const adminScope = "server:admin"
+
+// toolScopes returns every toolset scope and the admin scope, for the
+// protected resource metadata
+func toolScopes() []string {
+	return []string{"github:read", "github:write", "jira:read", "jira:write", "notion:read", "notion:write", "server:read", "server:write", adminScope}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mcp-server/logging"
+	"mcp-server/tracing"
+)
+
+// startSpan starts the span of a JSON-RPC request, continuing the trace of
+// the client when its params carry _meta.traceparent
+func (s *MCPServer) startSpan(ctx context.Context, request MCPRequest) (context.Context, *tracing.Span) {
+	if s.Tracer == nil {
+		return ctx, nil
+	}
+
+	params, _ := request.Params.(map[string]interface{})
+	meta, _ := params["_meta"].(map[string]interface{})
+	if traceparent, _ := meta["traceparent"].(string); traceparent != "" {
+		if sc, ok := tracing.ParseTraceparent(traceparent); ok {
+			ctx = tracing.ContextWithRemoteParent(ctx, sc)
+		}
+	}
+
+	name := request.Method
+	tool, _ := params["name"].(string)
+	if request.Method == "tools/call" && tool != "" {
+		name += " " + tool
+	}
+	ctx, span := s.Tracer.Start(ctx, name, tracing.KindServer)
+	span.SetAttribute("rpc.system", "jsonrpc")
+	span.SetAttribute("rpc.method", request.Method)
+	if request.ID != nil {
+		span.SetAttribute("rpc.jsonrpc.request_id", fmt.Sprint(request.ID))
+	}
+	if tool != "" {
+		span.SetAttribute("mcp.tool.name", tool)
+	}
+	c := callerFrom(ctx)
+	span.SetAttribute("mcp.transport", c.Transport)
+	span.SetAttribute("mcp.request_id", logging.RequestID(ctx))
+	if c.Session != "" {
+		span.SetAttribute("mcp.session.id", c.Session)
+	}
+	return ctx, span
+}
+
+// endSpan ends the span of a JSON-RPC request, marking it failed on an
+// error response or a failed tool call
+func endSpan(span *tracing.Span, response *MCPResponse) {
+	switch {
+	case response == nil:
+	case response.Error != nil:
+		span.SetError(errors.New(response.Error.Message))
+	default:
+		if result, ok := response.Result.(ToolResult); ok && result.IsError && len(result.Content) > 0 {
+			span.SetError(errors.New(result.Content[0].Text))
+		}
+	}
+	span.End()
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"mcp-server/apierror"
+	"mcp-server/auth"
+	"mcp-server/dryrun"
+	"mcp-server/tools"
+	"mcp-server/undo"
+	"strings"
+	"time"
+)
+
+// irreversible explains why the calls of some write tools cannot be undone
+var irreversible = map[string]string{
+	"github_run_workflow":      "a workflow run cannot be taken back; cancel the run on GitHub while it is in progress",
+	"github_create_repository": "repositories are never deleted automatically; delete it in its settings on GitHub",
+}
+
+// undoMiddleware records the successful write calls in the undo journal,
+// with the step reverting them. The state a step restores is read before
+// the call.
+func (s *MCPServer) undoMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if s.Undo == nil || !writeTools[call.Name] || serverTools[call.Name] || dryrun.Enabled(ctx) {
+			return next(ctx, call)
+		}
+		before, readErr := s.readBefore(ctx, call)
+		result, err := next(ctx, call)
+		if err != nil {
+			return result, err
+		}
+
+		info, _ := auth.FromContext(ctx)
+		action := undo.Action{
+			Time:    time.Now().UTC(),
+			Caller:  subjectOf(info),
+			Tool:    call.Name,
+			Target:  auditTarget(call.Name, call.Args, result),
+			Account: call.Args.String("account"),
+		}
+		action.Undo, action.Irreversible = undoStep(call, result, before)
+		if readErr != nil {
+			action.Undo, action.Irreversible = nil, fmt.Sprintf("the previous state could not be read: %v", readErr)
+		}
+		action, err = s.Undo.Record(action)
+		if err != nil {
+			logger.ErrorContext(ctx, "Error writing undo journal", "error", err)
+			return result, nil
+		}
+
+		if action.Undo != nil {
+			call.SetMeta("undo", map[string]interface{}{"action_id": action.ID, "reversible": true, "undo": action.Undo.String()})
+			call.Note("Action %s can be undone with undo_action (%s).", action.ID, action.Undo)
+		} else {
+			call.SetMeta("undo", map[string]interface{}{"action_id": action.ID, "reversible": false, "reason": action.Irreversible})
+			call.Note("Action %s is irreversible: %s.", action.ID, action.Irreversible)
+		}
+		return result, nil
+	}
+}
+
+// readBefore reads the state a write call changes, when its undo step
+// restores it: the title of a page or a database, the assignees of an issue
+func (s *MCPServer) readBefore(ctx context.Context, call *Call) (interface{}, error) {
+	args := call.Args
+	clients := s.clients(ctx)
+	switch call.Name {
+	case "notion_update_database":
+		client, err := clients.Notion.Resolve(args.String("account"), "")
+		if err != nil {
+			return nil, err
+		}
+		return client.GetDatabase(ctx, args.String("databaseID"))
+	case "notion_update_page":
+		client, err := clients.Notion.Resolve(args.String("account"), "")
+		if err != nil {
+			return nil, err
+		}
+		return client.GetPage(ctx, args.String("pageID"))
+	case "github_assign_copilot":
+		client, err := clients.Github.Resolve(args.String("account"), githubRoutingKey(args))
+		if err != nil {
+			return nil, err
+		}
+		return client.GetIssue(ctx, args.String("owner"), args.String("repo"), args.Int("number"))
+	}
+	return nil, nil
+}
+
+// undoStep returns the step reverting a write call, or why it cannot be undone
+func undoStep(call *Call, result interface{}, before interface{}) (*undo.Step, string) {
+	args := call.Args
+	repo := args.String("owner") + "/" + args.String("repo")
+	switch result := result.(type) {
+	case *tools.Issue:
+		if call.Name != "github_assign_copilot" {
+			return &undo.Step{Kind: undo.CloseIssue, Repo: repo, Number: result.Number}, ""
+		}
+		// Only the assignees the call added are removed
+		previous, _ := before.(*tools.Issue)
+		var added []string
+		for _, assignee := range args.Strings("assignees") {
+			if previous == nil || !containsFold(previous.Assignees, assignee) {
+				added = append(added, assignee)
+			}
+		}
+		if len(added) == 0 {
+			return nil, "the assignees were already assigned, nothing changed"
+		}
+		return &undo.Step{Kind: undo.RemoveAssignees, Repo: repo, Number: result.Number, Assignees: added}, ""
+	case *tools.PullRequest:
+		return &undo.Step{Kind: undo.ClosePullRequest, Repo: repo, Number: result.Number}, ""
+	case *tools.Branch:
+		return &undo.Step{Kind: undo.DeleteBranch, Repo: repo, Branch: args.String("branchName")}, ""
+	case *tools.Comment:
+		return &undo.Step{Kind: undo.DeleteComment, Repo: repo, Number: args.Int("number"), CommentID: result.ID}, ""
+	case *tools.JiraIssue:
+		return &undo.Step{Kind: undo.DeleteTicket, Ticket: result.Key}, ""
+	case *tools.NotionPage:
+		if call.Name == "notion_create_page" {
+			return &undo.Step{Kind: undo.ArchivePage, ID: result.ID}, ""
+		}
+		if previous, ok := before.(*tools.NotionPage); ok && previous != nil {
+			if previous.Title == "" {
+				return nil, "the page had no title, which cannot be set back"
+			}
+			return &undo.Step{Kind: undo.RestorePageTitle, ID: result.ID, Title: previous.Title}, ""
+		}
+	case *tools.NotionDatabase:
+		if call.Name == "notion_create_database" {
+			return &undo.Step{Kind: undo.ArchiveDatabase, ID: result.ID}, ""
+		}
+		if previous, ok := before.(*tools.NotionDatabase); ok && previous != nil {
+			return &undo.Step{Kind: undo.RestoreTitle, ID: result.ID, Title: previous.Title}, ""
+		}
+	}
+	if reason, ok := irreversible[call.Name]; ok {
+		return nil, reason
+	}
+	return nil, "the server does not know how to revert it"
+}
+
+// containsFold reports whether list contains value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// undoAction reverts an action of the caller, the newest reversible one
+// not undone yet when id is empty
+func (s *MCPServer) undoAction(ctx context.Context, id string) (string, error) {
+	if s.Undo == nil {
+		return "The undo journal is not enabled.", nil
+	}
+	info, ok := auth.FromContext(ctx)
+	action, err := s.Undo.Claim(subjectOf(info), id)
+	if err != nil {
+		return "", err
+	}
+	// The caller must still be allowed to use the tool of the action
+	if ok && !hasToolScope(info, action.Tool) {
+		s.Undo.Finish(action.ID, true)
+		e := apierror.New("", apierror.Forbidden, fmt.Sprintf("undoing %s requires the %s scope", action.Tool, toolScope(action.Tool)))
+		e.Remediation = fmt.Sprintf("Authorize the client with the %s scope", toolScope(action.Tool))
+		return "", e
+	}
+
+	err = s.revert(ctx, action)
+	if finishErr := s.Undo.Finish(action.ID, err != nil); finishErr != nil {
+		logger.ErrorContext(ctx, "Error writing undo journal", "error", finishErr)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to undo action %s (%s): %w", action.ID, action.Undo, err)
+	}
+	logger.InfoContext(ctx, "Action undone", "action", action.ID, "undone_tool", action.Tool, "target", action.Target)
+	return fmt.Sprintf("Undid action %s: %s on %s.\nDone: %s.\n", action.ID, action.Tool, action.Target, action.Undo), nil
+}
+
+// revert runs the undo step of an action with the account of the action
+func (s *MCPServer) revert(ctx context.Context, action undo.Action) error {
+	step := action.Undo
+	clients := s.clients(ctx)
+	owner, repo, _ := strings.Cut(step.Repo, "/")
+
+	switch serviceOf(action.Tool) {
+	case "github":
+		client, err := clients.Github.Resolve(action.Account, owner)
+		if err != nil {
+			return err
+		}
+		switch step.Kind {
+		case undo.CloseIssue, undo.ClosePullRequest:
+			_, err = client.CloseIssue(ctx, owner, repo, step.Number)
+		case undo.DeleteBranch:
+			err = client.DeleteBranch(ctx, owner, repo, step.Branch)
+		case undo.DeleteComment:
+			err = client.DeleteComment(ctx, owner, repo, step.CommentID)
+		case undo.RemoveAssignees:
+			_, err = client.RemoveAssignees(ctx, owner, repo, step.Number, step.Assignees)
+		default:
+			err = fmt.Errorf("unknown undo step %s", step.Kind)
+		}
+		return err
+
+	case "jira":
+		client, err := clients.Jira.Resolve(action.Account, jiraRoutingKey(map[string]interface{}{"ticketID": step.Ticket}))
+		if err != nil {
+			return err
+		}
+		return client.DeleteTicket(ctx, step.Ticket)
+
+	case "notion":
+		client, err := clients.Notion.Resolve(action.Account, "")
+		if err != nil {
+			return err
+		}
+		switch step.Kind {
+		case undo.ArchivePage:
+			_, err = client.ArchivePage(ctx, step.ID)
+		case undo.ArchiveDatabase:
+			err = client.ArchiveDatabase(ctx, step.ID)
+		case undo.RestoreTitle:
+			_, err = client.UpdateDatabase(ctx, step.ID, step.Title)
+		case undo.RestorePageTitle:
+			_, err = client.UpdatePage(ctx, step.ID, step.Title, "")
+		default:
+			err = fmt.Errorf("unknown undo step %s", step.Kind)
+		}
+		return err
+	}
+	return fmt.Errorf("unknown undo step %s", step.Kind)
+}
+
+// undoHistory lists the recent actions of the caller and whether they can
+// be undone
+func (s *MCPServer) undoHistory(ctx context.Context) string {
+	if s.Undo == nil {
+		return "The undo journal is not enabled."
+	}
+	info, _ := auth.FromContext(ctx)
+	actions := s.Undo.Recent(subjectOf(info), 20)
+	if len(actions) == 0 {
+		return "No actions recorded."
+	}
+
+	var result string
+	for _, action := range actions {
+		result += fmt.Sprintf("Action: %s\nTime: %s\nTool: %s\nTarget: %s\n", action.ID, action.Time.Format(time.RFC3339), action.Tool, action.Target)
+		switch {
+		case action.UndoneAt != nil:
+			result += fmt.Sprintf("Undo: done at %s\n", action.UndoneAt.Format(time.RFC3339))
+		case action.Undo != nil:
+			result += fmt.Sprintf("Undo: %s\n", action.Undo)
+		default:
+			result += fmt.Sprintf("Undo: irreversible, %s\n", action.Irreversible)
+		}
+		result += "\n"
+	}
+	return result
+}
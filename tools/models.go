@@ -0,0 +1,159 @@
+package tools
+
+import "time"
+
+// The tools return the models below rather than raw API objects, so the
+// output only carries the fields worth showing and renders the same way
+// whatever client produced it.
+
+// Message is a plain status message, e.g. the result of triggering a workflow
+type Message string
+
+// Diff is a unified diff
+type Diff string
+
+// PullRequest is a GitHub pull request
+type PullRequest struct {
+	Number       int        `json:"number"`
+	Title        string     `json:"title"`
+	State        string     `json:"state"`
+	Draft        bool       `json:"draft,omitempty"`
+	Merged       bool       `json:"merged,omitempty"`
+	Author       string     `json:"author,omitempty"`
+	Head         string     `json:"head"`
+	Base         string     `json:"base"`
+	Labels       []string   `json:"labels,omitempty"`
+	Assignees    []string   `json:"assignees,omitempty"`
+	Reviewers    []string   `json:"reviewers,omitempty"`
+	Additions    int        `json:"additions,omitempty"`
+	Deletions    int        `json:"deletions,omitempty"`
+	ChangedFiles int        `json:"changed_files,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	MergedAt     *time.Time `json:"merged_at,omitempty"`
+	URL          string     `json:"url"`
+	Body         string     `json:"body,omitempty"`
+}
+
+// Issue is a GitHub issue, or a pull request found by an issue search
+type Issue struct {
+	Number        int        `json:"number"`
+	Title         string     `json:"title"`
+	State         string     `json:"state"`
+	IsPullRequest bool       `json:"is_pull_request,omitempty"`
+	Author        string     `json:"author,omitempty"`
+	Labels        []string   `json:"labels,omitempty"`
+	Assignees     []string   `json:"assignees,omitempty"`
+	Comments      int        `json:"comments,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ClosedAt      *time.Time `json:"closed_at,omitempty"`
+	URL           string     `json:"url"`
+	Body          string     `json:"body,omitempty"`
+}
+
+// Comment is a comment on a GitHub issue or pull request
+type Comment struct {
+	ID        int64     `json:"id"`
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Body      string    `json:"body"`
+}
+
+// Commit is a GitHub commit
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Author  string    `json:"author,omitempty"`
+	Date    time.Time `json:"date"`
+	URL     string    `json:"url,omitempty"`
+	Message string    `json:"message"`
+}
+
+// Branch is a GitHub branch
+type Branch struct {
+	Name      string `json:"name"`
+	SHA       string `json:"sha"`
+	Protected bool   `json:"protected,omitempty"`
+}
+
+// Repository is a GitHub repository
+type Repository struct {
+	FullName      string `json:"full_name"`
+	Description   string `json:"description,omitempty"`
+	Private       bool   `json:"private"`
+	DefaultBranch string `json:"default_branch,omitempty"`
+	Language      string `json:"language,omitempty"`
+	Stars         int    `json:"stars"`
+	URL           string `json:"url"`
+}
+
+// Workflow is a GitHub Actions workflow
+type Workflow struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Path  string `json:"path,omitempty"`
+	State string `json:"state"`
+	URL   string `json:"url,omitempty"`
+}
+
+// Release is a GitHub release
+type Release struct {
+	TagName     string     `json:"tag_name"`
+	Name        string     `json:"name,omitempty"`
+	Draft       bool       `json:"draft,omitempty"`
+	Prerelease  bool       `json:"prerelease,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	URL         string     `json:"url"`
+	Body        string     `json:"body,omitempty"`
+}
+
+// Tag is a GitHub tag
+type Tag struct {
+	Name string `json:"name"`
+	SHA  string `json:"sha"`
+}
+
+// CodeResult is a file found by a GitHub code search
+type CodeResult struct {
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	Repository string `json:"repository"`
+	URL        string `json:"url"`
+}
+
+// JiraIssue is a Jira issue
+type JiraIssue struct {
+	Key         string `json:"key"`
+	Summary     string `json:"summary"`
+	Status      string `json:"status,omitempty"`
+	Assignee    string `json:"assignee,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// NotionPage is a Notion page
+type NotionPage struct {
+	ID             string    `json:"id"`
+	Title          string    `json:"title,omitempty"`
+	URL            string    `json:"url"`
+	CreatedTime    time.Time `json:"created_time"`
+	LastEditedTime time.Time `json:"last_edited_time"`
+}
+
+// NotionDatabase is a Notion database
+type NotionDatabase struct {
+	ID             string           `json:"id"`
+	Title          string           `json:"title"`
+	URL            string           `json:"url"`
+	CreatedTime    time.Time        `json:"created_time"`
+	LastEditedTime time.Time        `json:"last_edited_time"`
+	Properties     []NotionProperty `json:"properties,omitempty"`
+}
+
+// NotionProperty is a property of a Notion database
+type NotionProperty struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
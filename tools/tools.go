@@ -1,50 +1,67 @@
 package tools
 
+import (
+	"context"
+	"time"
+)
+
 // NotionTool is the interface for the Notion tools
 // It defines the methods that can be used to interact with the Notion API.
 type NotionTool interface {
-	SearchPagesByTitle(title string) (string, error)
-	GetPageByURL(url string) (string, error)
-	GetDatabase(databaseID string) (string, error)
-	CreatePage(parentID string, title string, content string) (string, error)
-	CreateDatabase(parentPageID string, title string) (string, error)
-	UpdatePage(pageID string, title string, content string) (string, error)
-	UpdateDatabase(databaseID string, title string) (string, error)
+	SearchPagesByTitle(ctx context.Context, title string) ([]NotionPage, error)
+	GetPageByURL(ctx context.Context, url string) (*NotionPage, error)
+	GetPage(ctx context.Context, pageID string) (*NotionPage, error)
+	GetDatabase(ctx context.Context, databaseID string) (*NotionDatabase, error)
+	CreatePage(ctx context.Context, parentID string, title string, content string) (*NotionPage, error)
+	CreateDatabase(ctx context.Context, parentPageID string, title string) (*NotionDatabase, error)
+	UpdatePage(ctx context.Context, pageID string, title string, content string) (*NotionPage, error)
+	UpdateDatabase(ctx context.Context, databaseID string, title string) (*NotionDatabase, error)
+	ArchivePage(ctx context.Context, pageID string) (*NotionPage, error)
+	ArchiveDatabase(ctx context.Context, databaseID string) error
+	// Ancestors returns the IDs of the pages, databases and blocks containing
+	// a page or database ("page" or "database" kind), nearest first
+	Ancestors(ctx context.Context, kind string, id string) ([]string, error)
 }
 
 // JiraTool is the interface for the Jira tools
 // It defines the methods that can be used to interact with the Jira API.
 type JiraTool interface {
-	SearchTickets(query string) (string, error)
-	GetTicketByID(ticketID string) (string, error)
-	CreateTicket(projectKey string, summary string, description string) (string, error)
+	SearchTickets(ctx context.Context, query string) ([]JiraIssue, error)
+	GetTicketByID(ctx context.Context, ticketID string) (*JiraIssue, error)
+	CreateTicket(ctx context.Context, projectKey string, summary string, description string) (*JiraIssue, error)
+	DeleteTicket(ctx context.Context, ticketID string) error
 }
 
 // GithubTool is the interface for the Github tools
 // It defines the methods that can be used to interact with the Github API.
 type GithubTool interface {
-	GetPullRequest(owner string, repo string, pullRequestNumber int) (string, error)
-	GetPullRequestDiff(owner string, repo string, pullRequestNumber int) (string, error)
-	CreateIssue(owner string, repo string, title string, body string) (string, error)
-	CreatePullRequest(owner string, repo string, title string, body string, head string, base string) (string, error)
-	GetComments(owner string, repo string, issueNumber int) (string, error)
-	AddComment(owner string, repo string, issueNumber int, body string) (string, error)
-	AssignCopilot(owner string, repo string, issueNumber int, assignees []string) (string, error)
-	CreateBranch(owner string, repo string, branchName string, sha string) (string, error)
-	CreateRepository(name string, description string, private bool) (string, error)
-	GetCommit(owner string, repo string, sha string) (string, error)
-	GetIssue(owner string, repo string, issueNumber int) (string, error)
-	GetReleaseByTag(owner string, repo string, tagName string) (string, error)
-	GetTag(owner string, repo string, tagName string) (string, error)
-	ListBranches(owner string, repo string) (string, error)
-	ListCommits(owner string, repo string) (string, error)
-	GetWorkflows(owner string, repo string) (string, error)
-	RunWorkflow(owner string, repo string, workflowID string, ref string) (string, error)
-	RunFailedJobs(owner string, repo string, runID int64) (string, error)
-	CreateCommit(owner string, repo string, message string, tree string, parents []string) (string, error)
-	Push(owner string, repo string, ref string, sha string) (string, error)
-	SearchCode(query string) (string, error)
-	SearchIssues(query string) (string, error)
-	SearchPullRequests(query string) (string, error)
-	SearchRepositories(query string) (string, error)
+	GetPullRequest(ctx context.Context, owner string, repo string, pullRequestNumber int) (*PullRequest, error)
+	GetPullRequestDiff(ctx context.Context, owner string, repo string, pullRequestNumber int) (Diff, error)
+	CreateIssue(ctx context.Context, owner string, repo string, title string, body string) (*Issue, error)
+	CreatePullRequest(ctx context.Context, owner string, repo string, title string, body string, head string, base string) (*PullRequest, error)
+	GetComments(ctx context.Context, owner string, repo string, issueNumber int) ([]Comment, error)
+	AddComment(ctx context.Context, owner string, repo string, issueNumber int, body string) (*Comment, error)
+	DeleteComment(ctx context.Context, owner string, repo string, commentID int64) error
+	AssignCopilot(ctx context.Context, owner string, repo string, issueNumber int, assignees []string) (*Issue, error)
+	RemoveAssignees(ctx context.Context, owner string, repo string, issueNumber int, assignees []string) (*Issue, error)
+	CloseIssue(ctx context.Context, owner string, repo string, issueNumber int) (*Issue, error)
+	CreateBranch(ctx context.Context, owner string, repo string, branchName string, sha string) (*Branch, error)
+	DeleteBranch(ctx context.Context, owner string, repo string, branchName string) error
+	CreateRepository(ctx context.Context, name string, description string, private bool) (*Repository, error)
+	GetCommit(ctx context.Context, owner string, repo string, sha string) (*Commit, error)
+	GetIssue(ctx context.Context, owner string, repo string, issueNumber int) (*Issue, error)
+	ListRecentIssues(ctx context.Context, owner string, repo string, since time.Time) ([]Issue, error)
+	GetReleaseByTag(ctx context.Context, owner string, repo string, tagName string) (*Release, error)
+	GetTag(ctx context.Context, owner string, repo string, tagName string) (*Tag, error)
+	ListBranches(ctx context.Context, owner string, repo string) ([]Branch, error)
+	ListCommits(ctx context.Context, owner string, repo string) ([]Commit, error)
+	GetWorkflows(ctx context.Context, owner string, repo string) ([]Workflow, error)
+	RunWorkflow(ctx context.Context, owner string, repo string, workflowID string, ref string) (Message, error)
+	RunFailedJobs(ctx context.Context, owner string, repo string, runID int64) (Message, error)
+	CreateCommit(ctx context.Context, owner string, repo string, message string, tree string, parents []string) (*Commit, error)
+	Push(ctx context.Context, owner string, repo string, ref string, sha string) (Message, error)
+	SearchCode(ctx context.Context, query string) ([]CodeResult, error)
+	SearchIssues(ctx context.Context, query string) ([]Issue, error)
+	SearchPullRequests(ctx context.Context, query string) ([]Issue, error)
+	SearchRepositories(ctx context.Context, query string) ([]Repository, error)
 }
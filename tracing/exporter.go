@@ -0,0 +1,217 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mcp-server/logging"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logger is the logger of the tracing subsystem
+var logger = logging.For("tracing")
+
+const (
+	// maxBatch is the number of spans sent in one export request
+	maxBatch = 512
+	// maxQueue is the number of spans kept waiting for export, newer spans
+	// are dropped beyond it
+	maxQueue = 4096
+	// flushInterval is how often queued spans are exported
+	flushInterval = 5 * time.Second
+)
+
+// Exporter sends spans in batches to an OTLP/HTTP collector, JSON encoded
+type Exporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+
+	flush chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewExporter creates an exporter posting to the /v1/traces path of the
+// collector endpoint, e.g. http://localhost:4318, and starts its batching loop
+func NewExporter(endpoint string, headers map[string]string, service string) *Exporter {
+	e := &Exporter{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		headers:  headers,
+		service:  service,
+		// A client of its own, so exports are neither traced nor rate limited
+		client: &http.Client{Timeout: 10 * time.Second},
+		flush:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// export queues an ended span
+func (e *Exporter) export(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= maxQueue {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, span)
+	if len(e.queue) >= maxBatch {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run exports the queued spans periodically or when a batch is full
+func (e *Exporter) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.done:
+			return
+		}
+		e.send(context.Background())
+	}
+}
+
+// Shutdown stops the batching loop and exports the remaining spans
+func (e *Exporter) Shutdown(ctx context.Context) {
+	e.once.Do(func() {
+		close(e.done)
+		e.send(ctx)
+	})
+}
+
+// send exports the queued spans in batches
+func (e *Exporter) send(ctx context.Context) {
+	for {
+		e.mu.Lock()
+		n := len(e.queue)
+		if n > maxBatch {
+			n = maxBatch
+		}
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		dropped := e.dropped
+		e.dropped = 0
+		e.mu.Unlock()
+
+		if dropped > 0 {
+			logger.Warn("Dropped spans, the export queue is full", "spans", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.post(ctx, batch); err != nil {
+			logger.Warn("Error exporting spans", "spans", len(batch), "error", err)
+			return
+		}
+	}
+}
+
+// post sends one batch of spans
+func (e *Exporter) post(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// payload builds the OTLP ExportTraceServiceRequest of a batch
+func (e *Exporter) payload(spans []*Span) map[string]interface{} {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		encoded = append(encoded, encodeSpan(span))
+	}
+	return map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource": map[string]interface{}{
+				"attributes": []map[string]interface{}{encodeAttribute(attribute{"service.name", e.service})},
+			},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]interface{}{"name": "mcp-server"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+// encodeSpan encodes a span in the OTLP JSON mapping, with hex IDs
+func encodeSpan(span *Span) map[string]interface{} {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	attributes := make([]map[string]interface{}, 0, len(span.attributes))
+	for _, attr := range span.attributes {
+		attributes = append(attributes, encodeAttribute(attr))
+	}
+	encoded := map[string]interface{}{
+		"traceId":           hex.EncodeToString(span.sc.TraceID[:]),
+		"spanId":            hex.EncodeToString(span.sc.SpanID[:]),
+		"name":              span.name,
+		"kind":              int(span.kind),
+		"startTimeUnixNano": strconv.FormatInt(span.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(span.end.UnixNano(), 10),
+		"attributes":        attributes,
+	}
+	if span.parent != [8]byte{} {
+		encoded["parentSpanId"] = hex.EncodeToString(span.parent[:])
+	}
+	if span.failed {
+		encoded["status"] = map[string]interface{}{"code": 2, "message": span.err}
+	}
+	return encoded
+}
+
+// encodeAttribute encodes an attribute as an OTLP KeyValue
+func encodeAttribute(attr attribute) map[string]interface{} {
+	var value map[string]interface{}
+	switch v := attr.value.(type) {
+	case int64:
+		value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		value = map[string]interface{}{"doubleValue": v}
+	case bool:
+		value = map[string]interface{}{"boolValue": v}
+	default:
+		value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+	return map[string]interface{}{"key": attr.key, "value": value}
+}
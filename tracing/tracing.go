@@ -0,0 +1,200 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind is the role of a span in a request, as numbered by OTLP
+type SpanKind int
+
+// Span kinds
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// SpanContext identifies a span across processes
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether the trace and span IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats the span context as a W3C traceparent header
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// Tracer starts spans and hands the sampled ones to an exporter. A nil
+// Tracer starts no spans, so tracing can be left unconfigured.
+type Tracer struct {
+	exporter    *Exporter
+	sampleRatio float64
+}
+
+// NewTracer creates a tracer exporting with exporter and sampling the
+// given ratio of the traces it starts. Traces continued from a remote
+// parent follow the parent's sampling decision.
+func NewTracer(exporter *Exporter, sampleRatio float64) *Tracer {
+	return &Tracer{exporter: exporter, sampleRatio: sampleRatio}
+}
+
+// Span is an operation of a trace. The methods of a nil Span do nothing.
+type Span struct {
+	tracer *Tracer
+	name   string
+	kind   SpanKind
+	sc     SpanContext
+	parent [8]byte
+	start  time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []attribute
+	err        string
+	failed     bool
+}
+
+// attribute is a key and a string, int64, float64 or bool value
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithRemoteParent returns a copy of ctx whose next span continues
+// the trace of a remote caller
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFromContext returns the current span of ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start starts a span, child of the current span of ctx or of its remote
+// parent, and returns a copy of ctx carrying it
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.sc.TraceID = parent.sc.TraceID
+		span.sc.Sampled = parent.sc.Sampled
+		span.parent = parent.sc.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok && remote.IsValid() {
+		span.sc.TraceID = remote.TraceID
+		span.sc.Sampled = remote.Sampled
+		span.parent = remote.SpanID
+	} else {
+		rand.Read(span.sc.TraceID[:])
+		span.sc.Sampled = t.sample(span.sc.TraceID)
+	}
+	rand.Read(span.sc.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// sample decides whether a new trace is exported, from its trace ID so the
+// decision is stable
+func (t *Tracer) sample(traceID [16]byte) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>11)/(1<<53) < t.sampleRatio
+}
+
+// SpanContext returns the identity of the span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttribute records an attribute, a string, int, int64, float64 or bool
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	if i, ok := value.(int); ok {
+		value = int64(i)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, attribute{key, value})
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.err = err.Error()
+}
+
+// End ends the span and queues it for export when sampled
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sc.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.export(s)
+	}
+}
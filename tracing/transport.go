@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+// Transport is an http.RoundTripper recording a client span for each
+// request sent to an upstream backend, and propagating the trace context
+// in the traceparent header
+type Transport struct {
+	tracer  *Tracer
+	service string
+	base    http.RoundTripper
+}
+
+// NewTransport creates a new Transport for a service wrapping base
+func NewTransport(tracer *Tracer, service string, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{tracer: tracer, service: service, base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Only trace the upstream calls of a traced request
+	if SpanFromContext(req.Context()) == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, span := t.tracer.Start(req.Context(), req.Method+" "+t.service, KindClient)
+	defer span.End()
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", redactQuery(req))
+	span.SetAttribute("server.address", req.URL.Host)
+	span.SetAttribute("peer.service", t.service)
+
+	req = req.Clone(ctx)
+	req.Header.Set("traceparent", span.SpanContext().Traceparent())
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		span.SetError(&statusError{resp.Status})
+	}
+	return resp, nil
+}
+
+// redactQuery returns the request URL without its query, which may carry
+// search terms or credentials
+func redactQuery(req *http.Request) string {
+	u := *req.URL
+	u.RawQuery = ""
+	u.User = nil
+	return u.String()
+}
+
+// statusError marks a span failed on a server error response
+type statusError struct {
+	status string
+}
+
+// Error implements error
+func (e *statusError) Error() string {
+	return e.status
+}
@@ -0,0 +1,258 @@
+// Package undo keeps a journal of the write tool calls with what it takes
+// to revert each of them, so an agent can take back its recent actions.
+package undo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mcp-server/apierror"
+	"mcp-server/logging"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logger is the logger of the undo subsystem
+var logger = logging.For("undo")
+
+// Kind is the kind of write reverting an action
+type Kind string
+
+const (
+	CloseIssue       Kind = "close_issue"
+	ClosePullRequest Kind = "close_pull_request"
+	DeleteBranch     Kind = "delete_branch"
+	DeleteComment    Kind = "delete_comment"
+	RemoveAssignees  Kind = "remove_assignees"
+	DeleteTicket     Kind = "delete_ticket"
+	ArchivePage      Kind = "archive_page"
+	ArchiveDatabase  Kind = "archive_database"
+	RestoreTitle     Kind = "restore_database_title"
+	RestorePageTitle Kind = "restore_page_title"
+)
+
+// Step is the write reverting an action. The fields used depend on the kind.
+type Step struct {
+	Kind Kind `json:"kind"`
+	// Repo is the owner/repo of GitHub steps
+	Repo      string   `json:"repo,omitempty"`
+	Number    int      `json:"number,omitempty"`
+	Branch    string   `json:"branch,omitempty"`
+	CommentID int64    `json:"comment_id,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+	// Ticket is the key of the Jira ticket of a DeleteTicket step
+	Ticket string `json:"ticket,omitempty"`
+	// ID is the ID of the Notion page or database of Notion steps
+	ID string `json:"id,omitempty"`
+	// Title is the title a RestoreTitle or RestorePageTitle step restores
+	Title string `json:"title,omitempty"`
+}
+
+// String describes the step, e.g. "close issue acme/api#12"
+func (s Step) String() string {
+	switch s.Kind {
+	case CloseIssue:
+		return fmt.Sprintf("close issue %s#%d", s.Repo, s.Number)
+	case ClosePullRequest:
+		return fmt.Sprintf("close pull request %s#%d", s.Repo, s.Number)
+	case DeleteBranch:
+		return fmt.Sprintf("delete branch %s of %s", s.Branch, s.Repo)
+	case DeleteComment:
+		return fmt.Sprintf("delete comment %d of %s#%d", s.CommentID, s.Repo, s.Number)
+	case RemoveAssignees:
+		return fmt.Sprintf("unassign %s from %s#%d", strings.Join(s.Assignees, ", "), s.Repo, s.Number)
+	case DeleteTicket:
+		return "delete ticket " + s.Ticket
+	case ArchivePage:
+		return "archive page " + s.ID
+	case ArchiveDatabase:
+		return "archive database " + s.ID
+	case RestoreTitle:
+		return fmt.Sprintf("restore the title %q of database %s", s.Title, s.ID)
+	case RestorePageTitle:
+		return fmt.Sprintf("restore the title %q of page %s", s.Title, s.ID)
+	}
+	return string(s.Kind)
+}
+
+// Action is a write tool call recorded in the journal
+type Action struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Caller is the authenticated subject that made the call, the only
+	// one that may undo it
+	Caller string `json:"caller,omitempty"`
+	Tool   string `json:"tool"`
+	Target string `json:"target"`
+	// Account is the account argument of the call, to undo it with the
+	// same credentials
+	Account string `json:"account,omitempty"`
+	// Undo reverts the action, nil when it is irreversible
+	Undo *Step `json:"undo,omitempty"`
+	// Irreversible explains why an action cannot be undone
+	Irreversible string     `json:"irreversible,omitempty"`
+	UndoneAt     *time.Time `json:"undone_at,omitempty"`
+
+	// undoing is set while the action is being undone
+	undoing bool
+}
+
+// Journal records the recent actions, the oldest dropped beyond a maximum.
+// With a path, the journal is persisted to a JSON file rewritten on every
+// change, so actions can be undone after a restart.
+type Journal struct {
+	path string
+	max  int
+
+	mu      sync.Mutex
+	actions []*Action
+}
+
+// Open creates a Journal keeping max actions, loading the actions persisted
+// at path. An empty path keeps the journal in memory.
+func Open(path string, max int) (*Journal, error) {
+	if max <= 0 {
+		return nil, fmt.Errorf("the undo journal must keep at least one action")
+	}
+	j := &Journal{path: path, max: max}
+	if path == "" {
+		return j, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &j.actions); err != nil {
+		return nil, fmt.Errorf("invalid undo journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// Record appends an action under a new ID
+func (j *Journal) Record(action Action) (Action, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return Action{}, fmt.Errorf("failed to generate action ID: %w", err)
+	}
+	action.ID = hex.EncodeToString(buf)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	stored := action
+	j.actions = append(j.actions, &stored)
+	if len(j.actions) > j.max {
+		j.actions = j.actions[len(j.actions)-j.max:]
+	}
+	return action, j.save()
+}
+
+// Recent returns the actions of a caller, newest first
+func (j *Journal) Recent(caller string, limit int) []Action {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var actions []Action
+	for i := len(j.actions) - 1; i >= 0 && len(actions) < limit; i-- {
+		if j.actions[i].Caller == caller {
+			actions = append(actions, *j.actions[i])
+		}
+	}
+	return actions
+}
+
+// Claim marks an action of a caller as being undone and returns it. An
+// empty id claims the newest reversible action not undone yet. It fails for
+// unknown, irreversible and already undone actions.
+func (j *Journal) Claim(caller string, id string) (Action, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var action *Action
+	for i := len(j.actions) - 1; i >= 0; i-- {
+		a := j.actions[i]
+		if a.Caller != caller {
+			continue
+		}
+		if id == "" && a.UndoneAt == nil && a.Undo != nil || a.ID == id {
+			action = a
+			break
+		}
+	}
+	switch {
+	case action == nil && id == "":
+		e := apierror.New("", apierror.NotFound, "no action to undo")
+		e.Remediation = "Only the reversible write calls made through this server by the same caller are recorded; call undo_action without an id to list them"
+		return Action{}, e
+	case action == nil:
+		e := apierror.New("", apierror.NotFound, fmt.Sprintf("unknown action %q", id))
+		e.Remediation = "Call undo_action without an id to list the recent actions"
+		return Action{}, e
+	case action.UndoneAt != nil:
+		e := apierror.New("", apierror.Conflict, fmt.Sprintf("action %s (%s on %s) was already undone at %s", action.ID, action.Tool, action.Target, action.UndoneAt.Format(time.RFC3339)))
+		e.Remediation = "Nothing left to undo for this action"
+		return Action{}, e
+	case action.undoing:
+		e := apierror.New("", apierror.Conflict, fmt.Sprintf("action %s is already being undone", action.ID))
+		e.Remediation = "Wait for the other undo call to finish"
+		return Action{}, e
+	case action.Undo == nil:
+		e := apierror.New("", apierror.Validation, fmt.Sprintf("action %s (%s on %s) is irreversible: %s", action.ID, action.Tool, action.Target, action.Irreversible))
+		e.Remediation = "Revert it by hand, or call undo_action without an id to list the actions that can be undone"
+		return Action{}, e
+	}
+	action.undoing = true
+	return *action, nil
+}
+
+// Finish ends undoing a claimed action, marking it undone unless it failed
+func (j *Journal) Finish(id string, failed bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, action := range j.actions {
+		if action.ID != id {
+			continue
+		}
+		action.undoing = false
+		if failed {
+			return nil
+		}
+		now := time.Now().UTC()
+		action.UndoneAt = &now
+		return j.save()
+	}
+	return nil
+}
+
+// save writes the journal to a temporary file renamed over the previous
+// one. It is called with the lock held.
+func (j *Journal) save() error {
+	if j.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(j.actions)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return err
+	}
+	logger.Debug("Saved undo journal", "path", j.path, "actions", len(j.actions))
+	return nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"mcp-server/cache"
+	"mcp-server/config"
+	"mcp-server/dryrun"
+	"mcp-server/logging"
+	"mcp-server/metrics"
+	"mcp-server/ratelimit"
+	"mcp-server/resilience"
+	"mcp-server/tracing"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// upstreams builds the HTTP clients of the service accounts, wrapping
+// their transports in the shared upstream middleware
+type upstreams struct {
+	cfg        *config.Config
+	rateLimits *ratelimit.Registry
+	cache      cache.Store
+	// backends protect each service, shared by all its accounts
+	backends map[string]*resilience.Backend
+
+	mu     sync.Mutex
+	caches map[string]*cache.Transport
+	// userClients are the clients of the per-user credentials, by service
+	// and credential hash
+	userClients map[string]*http.Client
+
+	// responses and latency record the upstream requests when metrics are enabled
+	responses *metrics.Counter
+	latency   *metrics.Histogram
+	// tracer records a span per upstream request when tracing is enabled
+	tracer *tracing.Tracer
+}
+
+// newUpstreams creates the upstream client builder
+func newUpstreams(cfg *config.Config) *upstreams {
+	u := &upstreams{
+		cfg:        cfg,
+		rateLimits: ratelimit.NewRegistry(),
+		cache:      newCacheStore(cfg.Cache),
+		backends:   make(map[string]*resilience.Backend),
+
+		caches:      make(map[string]*cache.Transport),
+		userClients: make(map[string]*http.Client),
+	}
+	for _, service := range []string{"github", "jira", "notion"} {
+		r := cfg.ResilienceFor(service)
+		u.backends[service] = resilience.NewBackend(service, resilience.Policy{
+			MaxConcurrent:    max(r.MaxConcurrent, 0),
+			FailureThreshold: max(r.FailureThreshold, 0),
+			Cooldown:         r.Cooldown,
+		})
+	}
+	return u
+}
+
+// newCacheStore creates the response cache shared by all accounts, or nil
+// when caching is disabled
+func newCacheStore(cfg config.Cache) cache.Store {
+	if cfg.Disabled {
+		return nil
+	}
+	maxBytes := cfg.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = config.DefaultCacheMaxBytes
+	}
+	memory := cache.NewLRU(maxBytes)
+	if cfg.Dir == "" {
+		return memory
+	}
+	dirMaxBytes := cfg.DirMaxBytes
+	if dirMaxBytes <= 0 {
+		dirMaxBytes = config.DefaultCacheDirMaxBytes
+	}
+	tiered, err := cache.NewTiered(memory, cfg.Dir, dirMaxBytes)
+	if err != nil {
+		logger.Warn("Error opening cache directory, caching in memory only", "error", err)
+		return memory
+	}
+	return tiered
+}
+
+// instrument registers the upstream metrics, recorded by the clients created afterwards
+func (u *upstreams) instrument(registry *metrics.Registry) {
+	u.responses = registry.Counter("mcp_upstream_responses_total", "Upstream HTTP responses by backend and status code.", "service", "account", "code")
+	u.latency = registry.Histogram("mcp_upstream_request_duration_seconds", "Upstream HTTP request latency.", metrics.DefaultBuckets, "service")
+
+	registry.Collect("mcp_upstream_rate_limit_remaining", "Last remaining request quota reported by the backend.", "gauge",
+		[]string{"service", "account"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, status := range u.rateLimits.Statuses() {
+				if status.Remaining < 0 {
+					continue
+				}
+				service, account, _ := strings.Cut(status.Name, "/")
+				samples = append(samples, metrics.Sample{Values: []string{service, account}, Value: float64(status.Remaining)})
+			}
+			return samples
+		})
+	registry.Collect("mcp_upstream_circuit_state", "Circuit breaker state by backend: 0 closed, 1 half-open, 2 open.", "gauge",
+		[]string{"service"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, service := range []string{"github", "jira", "notion"} {
+				state := u.backends[service].State()
+				samples = append(samples, metrics.Sample{Values: []string{service}, Value: float64(state)})
+			}
+			return samples
+		})
+	registry.Collect("mcp_upstream_in_flight", "Upstream requests holding a concurrency slot by backend.", "gauge",
+		[]string{"service"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, service := range []string{"github", "jira", "notion"} {
+				samples = append(samples, metrics.Sample{Values: []string{service}, Value: float64(u.backends[service].InFlight())})
+			}
+			return samples
+		})
+	registry.Collect("mcp_cache_requests_total", "Cacheable upstream reads by result.", "counter",
+		[]string{"service", "account", "result"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			names, caches := u.cacheTransports()
+			for i, name := range names {
+				service, account, _ := strings.Cut(name, "/")
+				stats := caches[i].Stats()
+				samples = append(samples,
+					metrics.Sample{Values: []string{service, account, "hit"}, Value: float64(stats.Hits)},
+					metrics.Sample{Values: []string{service, account, "revalidated"}, Value: float64(stats.Revalidated)},
+					metrics.Sample{Values: []string{service, account, "miss"}, Value: float64(stats.Misses)})
+			}
+			return samples
+		})
+	registry.Collect("mcp_cache_hit_ratio", "Share of cacheable reads served without a full upstream response.", "gauge",
+		[]string{"service", "account"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			names, caches := u.cacheTransports()
+			for i, name := range names {
+				service, account, _ := strings.Cut(name, "/")
+				stats := caches[i].Stats()
+				total := stats.Hits + stats.Revalidated + stats.Misses
+				if total == 0 {
+					continue
+				}
+				ratio := float64(stats.Hits+stats.Revalidated) / float64(total)
+				samples = append(samples, metrics.Sample{Values: []string{service, account}, Value: ratio})
+			}
+			return samples
+		})
+}
+
+// cacheTransports returns the names of the cached clients, sorted, and
+// their cache transports
+func (u *upstreams) cacheTransports() ([]string, []*cache.Transport) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	names := make([]string, 0, len(u.caches))
+	for name := range u.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	caches := make([]*cache.Transport, len(names))
+	for i, name := range names {
+		caches[i] = u.caches[name]
+	}
+	return names, caches
+}
+
+// cacheOptions returns how the responses of a service are cached
+func (u *upstreams) cacheOptions(service string) cache.Options {
+	options := cache.Options{
+		Mode:   cache.TTL,
+		MinTTL: u.cfg.Cache.MinTTL,
+		MaxTTL: u.cfg.Cache.MaxTTL,
+	}
+	switch service {
+	case "github":
+		options.Mode = cache.Revalidate
+		options.Invalidate = cache.GithubInvalidation
+	case "jira":
+		options.Invalidate = cache.JiraInvalidation
+	case "notion":
+		options.Invalidate = cache.NotionInvalidation
+	}
+	return options
+}
+
+// httpClient returns a new HTTP client for an account of a service
+func (u *upstreams) httpClient(service string, account string) *http.Client {
+	name := service + "/" + account
+	limit := u.cfg.RateLimitFor(service)
+	// Innermost, so every attempt of a retried request is counted. It also
+	// records the upstream statuses failed tool calls are classified by.
+	base := http.RoundTripper(metrics.NewTransport(service, account, http.DefaultTransport, u.responses, u.latency))
+	if u.tracer != nil {
+		base = tracing.NewTransport(u.tracer, service, base)
+	}
+	base = logging.NewTransport(logging.For(service), base)
+	limiter := ratelimit.NewTransport(name, base, ratelimit.Policy{
+		RequestsPerSecond: limit.RequestsPerSecond,
+		Burst:             limit.Burst,
+		MaxRetries:        limit.MaxRetries,
+		MaxDelay:          limit.MaxDelay,
+	})
+	u.rateLimits.Register(limiter)
+
+	// Outside the rate limiter, so a request retried until it fails counts
+	// as one failure, and inside the cache, so cached reads are still
+	// served while the circuit is open
+	var transport http.RoundTripper = resilience.NewTransport(u.backends[service], limiter)
+	if u.cache != nil {
+		cached := cache.NewTransport(transport, u.cache, u.cacheOptions(service))
+		u.mu.Lock()
+		u.caches[name] = cached
+		u.mu.Unlock()
+		transport = cached
+	}
+
+	// Outermost, so intercepted dry-run writes neither invalidate the cache
+	// nor spend rate limit tokens
+	client := &http.Client{Transport: dryrun.NewTransport(transport)}
+	if timeout := u.cfg.ResilienceFor(service).Timeout; timeout > 0 {
+		client.Timeout = timeout
+	}
+	return client
+}
+
+// userHTTPClient returns the HTTP client of per-user credentials of a
+// service. Each credential gets its own client, so one user's quota and
+// backoff do not throttle the others, and the same credential shares its
+// client across sessions until releaseUserClient drops it.
+func (u *upstreams) userHTTPClient(service string, credential ...string) *http.Client {
+	name := service + "/" + userAccount(credential)
+
+	u.mu.Lock()
+	client, ok := u.userClients[name]
+	u.mu.Unlock()
+	if ok {
+		return client
+	}
+	client = u.httpClient(service, userAccount(credential))
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	// Another session may have built it meanwhile
+	if existing, ok := u.userClients[name]; ok {
+		return existing
+	}
+	u.userClients[name] = client
+	return client
+}
+
+// releaseUserClient drops the client of per-user credentials no session
+// uses anymore, with its cache statistics, rate limit state and metrics
+func (u *upstreams) releaseUserClient(service string, credential ...string) {
+	account := userAccount(credential)
+	name := service + "/" + account
+
+	u.mu.Lock()
+	delete(u.userClients, name)
+	delete(u.caches, name)
+	u.mu.Unlock()
+	u.rateLimits.Unregister(name)
+	if u.responses != nil {
+		u.responses.Delete("account", account)
+	}
+}
+
+// userAccount returns the account name of per-user credentials, a hash of
+// the credentials
+func userAccount(credential []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(credential, "\x00")))
+	return "user-" + hex.EncodeToString(sum[:4])
+}